@@ -0,0 +1,234 @@
+package hack
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+ast.go is a structured model of a Hack assembly file. A Program is the list of its lines as nodes.
+
+	// draw a line    -> *Comment
+	                  -> *Blank
+	(LOOP)            -> *Label
+	@SCREEN+1 // addr -> *AInstruction with the trailing comment " addr"
+	D=M;JGT           -> *CInstruction
+	#macro INC x      -> *Directive
+	INC R1            -> *Directive (macro call)
+
+Instructions are not checked. Invalid mnemonics are reported when the program is assembled. [WriteProgram] prints a program back to text.
+*/
+
+// Node is a line of a Program. String returns the line without the trailing comment.
+type Node interface {
+	Pos() Position
+	String() string
+}
+
+// NodeInfo is a struct that represents the position and the trailing comment of a node. Comment is the text after "//" without the slashes. Example: " push constant 7"
+type NodeInfo struct {
+	Position Position
+	Comment  string
+}
+
+// Pos returns the position of the first character of the node.
+func (n NodeInfo) Pos() Position {
+	return n.Position
+}
+
+// AInstruction is a struct that represents an A instruction. Value is a symbol, a constant or a constant expression without spaces. Example: @LOOP -> "LOOP"
+type AInstruction struct {
+	NodeInfo
+	Value SymbolOrConstant
+}
+
+func (a *AInstruction) String() string {
+	return "@" + string(a.Value)
+}
+
+// CInstruction is a struct that represents a C instruction dest=comp;jump. Dest and Jump are empty if they are omitted. Example: D;JGT -> Dest "", Comp "D", Jump "JGT"
+type CInstruction struct {
+	NodeInfo
+	Dest Mnemonic
+	Comp Mnemonic
+	Jump Mnemonic
+}
+
+func (c *CInstruction) String() string {
+	s := string(c.Comp)
+	if c.Dest != "" {
+		s = string(c.Dest) + "=" + s
+	}
+	if c.Jump != "" {
+		s += ";" + string(c.Jump)
+	}
+	return s
+}
+
+// Label is a struct that represents an L instruction. Example: (LOOP) -> "LOOP"
+type Label struct {
+	NodeInfo
+	Name SymbolOrConstant
+}
+
+func (l *Label) String() string {
+	return "(" + string(l.Name) + ")"
+}
+
+// Directive is a struct that represents a line for the preprocessor: a line that starts with "#" or a macro call. Text is the line without surrounding spaces and the trailing comment. Example: "#macro INC x", "INC R1"
+type Directive struct {
+	NodeInfo
+	Text string
+}
+
+func (d *Directive) String() string {
+	return d.Text
+}
+
+// Comment is a struct that represents a line that has only a comment. Text is the text after "//". Example: "// loop" -> " loop"
+type Comment struct {
+	Position Position
+	Text     string
+}
+
+func (c *Comment) Pos() Position {
+	return c.Position
+}
+
+func (c *Comment) String() string {
+	return "//" + c.Text
+}
+
+// Blank is a struct that represents an empty line.
+type Blank struct {
+	Position Position
+}
+
+func (b *Blank) Pos() Position {
+	return b.Position
+}
+
+func (b *Blank) String() string {
+	return ""
+}
+
+// Program is a struct that represents a Hack assembly file as a list of nodes, one node per line.
+type Program struct {
+	File  string
+	Nodes []Node
+}
+
+// Instructions returns the A and C instructions of the program.
+func (p *Program) Instructions() []Node {
+	var insts []Node
+	for _, n := range p.Nodes {
+		switch n.(type) {
+		case *AInstruction, *CInstruction:
+			insts = append(insts, n)
+		}
+	}
+	return insts
+}
+
+// ParseProgram parses a Hack assembly file. fileName is used in the positions of the nodes. A line is a macro call if its first word is a macro defined before it, or if it has more than one word and is not a C instruction. Example: "INC R1"
+func ParseProgram(asmFile io.Reader, fileName string) (*Program, error) {
+	prog := &Program{File: fileName}
+	macros := map[string]bool{}
+	scanner := bufio.NewScanner(asmFile)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		raw := scanner.Text()
+		code, comment, hasComment := cutComment(raw)
+		text := strings.TrimSpace(code)
+		pos := Position{File: fileName, Line: lineNum, Column: 1}
+		if text == "" {
+			if hasComment {
+				pos.Column = len(code) + 1
+				prog.Nodes = append(prog.Nodes, &Comment{Position: pos, Text: comment})
+			} else {
+				prog.Nodes = append(prog.Nodes, &Blank{Position: pos})
+			}
+			continue
+		}
+		pos.Column = strings.Index(raw, text) + 1
+		info := NodeInfo{Position: pos, Comment: comment}
+
+		fields := strings.Fields(text)
+		if text[0] == '#' || macros[fields[0]] || len(fields) > 1 && isValidSymbol(SymbolOrConstant(fields[0])) && !isCInstruction(text, nil) {
+			if fields[0] == "#macro" && len(fields) > 1 {
+				macros[fields[1]] = true
+			}
+			prog.Nodes = append(prog.Nodes, &Directive{NodeInfo: info, Text: text})
+			continue
+		}
+		prog.Nodes = append(prog.Nodes, instructionNode(Instruction(removeSpaces(text)), info))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return prog, nil
+}
+
+// instructionNode converts an instruction without spaces to a node.
+func instructionNode(inst Instruction, info NodeInfo) Node {
+	p := Parser{currentInstruction: inst, currentType: getInstructionType(inst)}
+	switch p.currentType {
+	case A_Instruction:
+		value, _ := p.symbol()
+		return &AInstruction{NodeInfo: info, Value: value}
+	case L_Instruction:
+		name, _ := p.symbol()
+		return &Label{NodeInfo: info, Name: name}
+	default:
+		c := &CInstruction{NodeInfo: info}
+		c.Dest, _ = p.dest()
+		c.Comp, _ = p.comp()
+		c.Jump, _ = p.jump()
+		if c.Dest == "null" {
+			c.Dest = ""
+		}
+		if c.Jump == "null" {
+			c.Jump = ""
+		}
+		return c
+	}
+}
+
+// removeSpaces removes spaces and tabs from the text. Example: "D = M ; JGT" -> "D=M;JGT"
+func removeSpaces(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// WriteProgram prints the program. Each node is printed on its own line followed by its trailing comment if any.
+func WriteProgram(w io.Writer, prog *Program) error {
+	bw := bufio.NewWriter(w)
+	for _, n := range prog.Nodes {
+		fmt.Fprint(bw, n.String())
+		if comment := trailingComment(n); comment != "" {
+			fmt.Fprint(bw, " //"+comment)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// trailingComment returns the trailing comment of the node or "" if it has none.
+func trailingComment(n Node) string {
+	switch n := n.(type) {
+	case *AInstruction:
+		return n.Comment
+	case *CInstruction:
+		return n.Comment
+	case *Label:
+		return n.Comment
+	case *Directive:
+		return n.Comment
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package hack
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseProgram(t *testing.T) {
+	asmCode := `// count down
+
+(LOOP) // start
+	@SCREEN + 1
+  D = M ; JGT // jump
+0;JMP
+#macro INC x
+@%x
+M=M+1
+#endmacro
+INC R1 // call
+`
+	pos := func(line, column int) Position { return Position{"Prog.asm", line, column} }
+	expected := []Node{
+		&Comment{Position: pos(1, 1), Text: " count down"},
+		&Blank{Position: pos(2, 1)},
+		&Label{NodeInfo: NodeInfo{pos(3, 1), " start"}, Name: "LOOP"},
+		&AInstruction{NodeInfo: NodeInfo{Position: pos(4, 2)}, Value: "SCREEN+1"},
+		&CInstruction{NodeInfo: NodeInfo{pos(5, 3), " jump"}, Dest: "D", Comp: "M", Jump: "JGT"},
+		&CInstruction{NodeInfo: NodeInfo{Position: pos(6, 1)}, Comp: "0", Jump: "JMP"},
+		&Directive{NodeInfo: NodeInfo{Position: pos(7, 1)}, Text: "#macro INC x"},
+		&AInstruction{NodeInfo: NodeInfo{Position: pos(8, 1)}, Value: "%x"},
+		&CInstruction{NodeInfo: NodeInfo{Position: pos(9, 1)}, Dest: "M", Comp: "M+1"},
+		&Directive{NodeInfo: NodeInfo{Position: pos(10, 1)}, Text: "#endmacro"},
+		&Directive{NodeInfo: NodeInfo{pos(11, 1), " call"}, Text: "INC R1"},
+	}
+	prog, err := ParseProgram(strings.NewReader(asmCode), "Prog.asm")
+	if err != nil {
+		t.Fatalf("ParseProgram failed: %v", err)
+	}
+	if diff := cmp.Diff(expected, prog.Nodes); diff != "" {
+		t.Errorf("ParseProgram mismatch (-want +got):\n%s", diff)
+	}
+	if n := len(prog.Instructions()); n != 5 {
+		t.Errorf("len(Instructions()) = %d, want 5", n)
+	}
+
+	printed := `// count down
+
+(LOOP) // start
+@SCREEN+1
+D=M;JGT // jump
+0;JMP
+#macro INC x
+@%x
+M=M+1
+#endmacro
+INC R1 // call
+`
+	buf := &bytes.Buffer{}
+	if err := WriteProgram(buf, prog); err != nil {
+		t.Fatalf("WriteProgram failed: %v", err)
+	}
+	if diff := cmp.Diff(printed, buf.String()); diff != "" {
+		t.Errorf("WriteProgram mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteProgramAssemblesTheSame(t *testing.T) {
+	for _, fileName := range []string{"../asm_files/rect/Rect.asm", "../asm_files/max/Max.asm", "../asm_files/Prog.asm"} {
+		src, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog, err := ParseProgram(bytes.NewReader(src), fileName)
+		if err != nil {
+			t.Fatalf("ParseProgram(%s) failed: %v", fileName, err)
+		}
+		printed := &bytes.Buffer{}
+		if err := WriteProgram(printed, prog); err != nil {
+			t.Fatalf("WriteProgram(%s) failed: %v", fileName, err)
+		}
+		expected, actual := &bytes.Buffer{}, &bytes.Buffer{}
+		if err := Hack(bytes.NewReader(src), expected); err != nil {
+			t.Fatalf("Hack(%s) failed: %v", fileName, err)
+		}
+		if err := Hack(printed, actual); err != nil {
+			t.Fatalf("Hack(printed %s) failed: %v", fileName, err)
+		}
+		if expected.String() != actual.String() {
+			t.Errorf("%s: the printed program assembles differently", fileName)
+		}
+	}
+}
+
+func TestHackTrailingComments(t *testing.T) {
+	hackFile := &bytes.Buffer{}
+	if err := Hack(strings.NewReader("@2 // two\n\tD=A\t// D = 2\n"), hackFile); err != nil {
+		t.Fatalf("Hack failed: %v", err)
+	}
+	if expected := "0000000000000010\n1110110000010000\n"; hackFile.String() != expected {
+		t.Errorf("Hack = %q, want %q", hackFile.String(), expected)
+	}
+}
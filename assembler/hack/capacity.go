@@ -0,0 +1,64 @@
+package hack
+
+import "fmt"
+
+/*
+capacity.go checks that the program fits in the memory of the Hack computer.
+
+  - ROM has 32768 words. A program with more instructions is an error reported at the first instruction that does not fit.
+  - Variables are allocated in RAM from address 16 upward. A variable at SCREEN or above overflows into the memory map and is reported as a warning with the rule "memory-map".
+  - A variable above Options.VariableLimit is reported as a warning with the rule "variable-limit". Example: 255 for programs translated from VM code, whose stack starts at 256.
+*/
+
+// romSize is the number of words in ROM.
+const romSize = 32768
+
+// checkVariables reports warnings for the variables allocated by the current A instruction. from is the next RAM address for variables before the instruction was converted. A limit of 0 or less means no limit.
+func (p *Parser) checkVariables(diags *Diagnostics, symbolTable *SymbolTable, symOrConst SymbolOrConstant, from int, limit int) {
+	if symbolTable.variableCount == from {
+		return
+	}
+	for _, name := range symbolsOf(symOrConst) {
+		sym, ok := symbolTable.Lookup(name)
+		if !ok || sym.Kind != SymbolVariable || sym.Value < from {
+			continue
+		}
+		switch {
+		case sym.Value >= predefinedSymbols["SCREEN"]:
+			p.warnf(diags, 1, "memory-map", "variable %s at RAM address %d overflows into the memory map", name, sym.Value)
+		case limit > 0 && sym.Value > limit:
+			p.warnf(diags, 1, "variable-limit", "variable %s at RAM address %d is above the limit %d", name, sym.Value, limit)
+		}
+	}
+}
+
+// warnf adds a warning at the given offset of the current instruction to diags.
+func (p *Parser) warnf(diags *Diagnostics, offset int, rule string, format string, args ...any) {
+	d := p.origin().diagnostic(p.column(offset), format, args...)
+	d.Severity, d.Rule = SeverityWarning, rule
+	*diags = append(*diags, d)
+}
+
+// romOverflow is a struct that records the first instruction that does not fit in ROM.
+type romOverflow struct {
+	diag  Diagnostic
+	found bool
+}
+
+// check records the current instruction if its address is the first one outside ROM.
+func (o *romOverflow) check(p *Parser, address int) {
+	if address == romSize && !o.found {
+		o.diag = p.origin().diagnostic(p.column(0), "")
+		o.found = true
+	}
+}
+
+// report adds an error to diags if the program has more instructions than ROM. count is the number of instructions.
+func (o *romOverflow) report(diags *Diagnostics, count int) {
+	if !o.found {
+		return
+	}
+	d := o.diag
+	d.Message = fmt.Sprintf("program of %d instructions exceeds ROM size %d", count, romSize)
+	*diags = append(*diags, d)
+}
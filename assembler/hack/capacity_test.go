@@ -0,0 +1,78 @@
+package hack
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestROMOverflow(t *testing.T) {
+	asmCode := strings.Repeat("D=0\n", romSize) + "@0\n0;JMP\n"
+	expected := Diagnostics{
+		{Pos: Position{"Prog.asm", romSize + 1, 1}, Message: "program of 32770 instructions exceeds ROM size 32768"},
+	}
+	for name, assemble := range map[string]func(io.Reader, Options) (Result, error){"Assemble": Assemble, "AssembleStream": AssembleStream} {
+		t.Run(name, func(t *testing.T) {
+			_, err := assemble(strings.NewReader(asmCode), Options{FileName: "Prog.asm"})
+			diags, ok := err.(Diagnostics)
+			if !ok {
+				t.Fatalf("%s returned %v, want Diagnostics", name, err)
+			}
+			if diff := cmp.Diff(expected, diags); diff != "" {
+				t.Errorf("%s diagnostics mismatch (-want +got):\n%s", name, diff)
+			}
+		})
+	}
+}
+
+func TestVariableWarnings(t *testing.T) {
+	asmCode := `@a
+M=0
+@b
+M=0
+@a+c
+D=M
+`
+	expected := Diagnostics{
+		{Pos: Position{"Prog.asm", 5, 2}, Message: "variable c at RAM address 18 is above the limit 17", Severity: SeverityWarning, Rule: "variable-limit"},
+	}
+	opts := Options{FileName: "Prog.asm", VariableLimit: 17}
+	result, err := Assemble(strings.NewReader(asmCode), opts)
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+	if diff := cmp.Diff(expected, result.Warnings); diff != "" {
+		t.Errorf("Assemble warnings mismatch (-want +got):\n%s", diff)
+	}
+	streamed, err := AssembleStream(strings.NewReader(asmCode), opts)
+	if err != nil {
+		t.Fatalf("AssembleStream failed: %v", err)
+	}
+	if diff := cmp.Diff(expected, streamed.Warnings); diff != "" {
+		t.Errorf("AssembleStream warnings mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(expected, Lint(strings.NewReader(asmCode+"(END)\n@END\n0;JMP\n"), opts)); diff != "" {
+		t.Errorf("Lint warnings mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestVariableInMemoryMap(t *testing.T) {
+	var sb strings.Builder
+	n := predefinedSymbols["SCREEN"] - 16 + 1
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "@v%d\n", i)
+	}
+	result, err := Assemble(strings.NewReader(sb.String()), Options{FileName: "Prog.asm"})
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+	expected := Diagnostics{
+		{Pos: Position{"Prog.asm", n, 2}, Message: fmt.Sprintf("variable v%d at RAM address 16384 overflows into the memory map", n-1), Severity: SeverityWarning, Rule: "memory-map"},
+	}
+	if diff := cmp.Diff(expected, result.Warnings); diff != "" {
+		t.Errorf("Assemble warnings mismatch (-want +got):\n%s", diff)
+	}
+}
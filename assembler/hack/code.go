@@ -11,28 +11,45 @@ Description: code.go は、アセンブリ言語の命令をバイナリコー
 - Functions:
 | functions | arguments | return values | description |
 |-----------|-----------|---------------|-------------|
-| decimalToBinary | string | BinaryCode, error | `string`で表された10進数を15ビットのバイナリコードに変換する。例: "100" -> "000000001100100" |
-| symbol | SymbolOrConstant, *SymbolTable | BinaryCode, error | シンボルまたは定数を15ビットのバイナリコードに変換する。新しい変数が見つかった場合は、シンボルテーブルに追加する。例: "100" -> "000000001100100", "LOOP" -> symbolTable.table["LOOP"]->"000000000000001" |
-| dest | Mnemonic | BinaryCode, error | destニーモニックのバイナリコードを返す。 |
-| comp | Mnemonic | BinaryCode, error | compニーモニックのバイナリコードを返す。 |
-| jump | Mnemonic | BinaryCode, error | jumpニーモニックのバイナリコードを返す。 |
+| decimalToBinary | string | BinaryCode, error | `string`で表された10進数を15ビットのバイナリコードに変換する。0から32767の範囲外の場合はエラーを返す。例: "100" -> "000000001100100" |
+| intToBinary | int | BinaryCode, error | 整数を15ビットのバイナリコードに変換する。0から32767の範囲外の場合はエラーを返す。例: 100 -> "000000001100100" |
+| symbol | SymbolOrConstant, *SymbolTable | BinaryCode, error | シンボル、定数または定数式を15ビットのバイナリコードに変換する。新しい変数が見つかった場合は、シンボルテーブルに追加する。例: "100" -> "000000001100100", "LOOP" -> symbolTable.table["LOOP"]->"000000000000001", "0x4000" -> "100000000000000", "SCREEN+32*2" -> "100000001000000" |
+| canonicalDest | Mnemonic | Mnemonic | destニーモニックを標準の表記にする。例: "DM" -> "MD", "ADM" -> "AMD" |
+| canonicalComp | Mnemonic | Mnemonic | compニーモニックを標準の表記にする。例: "A+D" -> "D+A", "1+M" -> "M+1" |
+
+dest、comp、jumpニーモニックのバイナリコードは isa.go の命令セットの表 (ISA) から求める。拡張したCPUの命令セットは Options.ISA で指定する。
 
 */
 
 import (
-	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 )
 
 // BinaryCode is a string that represents a 15-bit binary number
 type BinaryCode string
 
-// decimalToBinary converts a decimal number to a 15-bit binary number. Example: "100" -> "000000001100100"
+// word returns the binary code as a 16-bit word. Example: "000000001100100" -> 100
+func (b BinaryCode) word() uint16 {
+	w, _ := strconv.ParseUint(string(b), 2, 16)
+	return uint16(w)
+}
+
+// decimalToBinary converts a decimal number to a 15-bit binary number. It returns an error if the number is out of 0..32767. Example: "100" -> "000000001100100"
 func decimalToBinary(decimalExp string) (BinaryCode, error) {
 	i, err := strconv.Atoi(decimalExp)
 	if err != nil {
 		return "", err
 	}
+	return intToBinary(i)
+}
+
+// intToBinary converts an integer to a 15-bit binary number. It returns an error if the number is out of 0..32767. Example: 100 -> "000000001100100"
+func intToBinary(i int) (BinaryCode, error) {
+	if i < 0 || i > 32767 {
+		return "", fmt.Errorf("constant %d is out of range 0..32767", i)
+	}
 	n_digits := 15
 	bin_exp := strconv.FormatInt(int64(i), 2)
 	for len(bin_exp) < n_digits {
@@ -41,120 +58,47 @@ func decimalToBinary(decimalExp string) (BinaryCode, error) {
 	return BinaryCode(bin_exp), nil
 }
 
-// symbol converts a symbol or constant to a 15-bit binary number. if new variable is found, add it to the symbol table. Example: "100" -> "000000001100100", "LOOP" -> symbolTable.table["LOOP"]->"000000000000001"
+// symbol converts a symbol, constant or constant expression to a 15-bit binary number. if new variable is found, add it to the symbol table. Example: "100" -> "000000001100100", "LOOP" -> symbolTable.table["LOOP"]->"000000000000001", "SCREEN+32*2" -> "100000001000000"
 func symbol(symOrConst SymbolOrConstant, symbolTable *SymbolTable) (BinaryCode, error) {
-	table, count := symbolTable.table, symbolTable.variableCount
-	// if it is a constant
+	// if it is a decimal constant
 	if isConst(symOrConst) {
 		return decimalToBinary(string(symOrConst))
-	} else if val, ok := table[symOrConst]; ok {
-		// if it is a registered symbol
-		return decimalToBinary(strconv.Itoa(val))
-	} else {
-		// add a new variable to the symbol table
-		symbolTable.addVariable(symOrConst)
-		return decimalToBinary(strconv.Itoa(count))
 	}
-}
-
-// dest return the binary code of the dest mnemonic
-func dest(mnemonic Mnemonic) (BinaryCode, error) {
-	switch mnemonic {
-	case "null":
-		return "000", nil
-	case "M":
-		return "001", nil
-	case "D":
-		return "010", nil
-	case "MD":
-		return "011", nil
-	case "A":
-		return "100", nil
-	case "AM":
-		return "101", nil
-	case "AD":
-		return "110", nil
-	case "AMD":
-		return "111", nil
+	value, err := evalExpression(string(symOrConst), symbolTable.resolve)
+	if err != nil {
+		return "", err
 	}
-	return "", errors.New("invalid dest mnemonic")
+	return intToBinary(value)
 }
 
-// comp return the binary code of the comp mnemonic
-func comp(mnemonic Mnemonic) (BinaryCode, error) {
-	a := ""
-	cccccc := ""
-	switch mnemonic {
-	case "0", "1", "-1", "D", "A", "!D", "!A", "-D", "-A", "D+1", "A+1", "D-1", "A-1", "D+A", "D-A", "A-D", "D&A", "D|A":
-		a = "0"
-	case "M", "!M", "-M", "M+1", "M-1", "D+M", "D-M", "M-D", "D&M", "D|M":
-		a = "1"
-	default:
-		return "", errors.New("invalid comp mnemonic")
+// canonicalDest returns the standard spelling of a dest mnemonic. The registers can be written in any order. Example: "DM" -> "MD", "MA" -> "AM", "ADM" -> "AMD". Mnemonics with other characters or repeated registers are returned as they are.
+func canonicalDest(mnemonic Mnemonic) Mnemonic {
+	if len(mnemonic) == 0 || len(mnemonic) > 3 {
+		return mnemonic
 	}
-	switch mnemonic {
-	case "0":
-		cccccc = "101010"
-	case "1":
-		cccccc = "111111"
-	case "-1":
-		cccccc = "111010"
-	case "D":
-		cccccc = "001100"
-	case "A", "M":
-		cccccc = "110000"
-	case "!D":
-		cccccc = "001101"
-	case "!A", "!M":
-		cccccc = "110001"
-	case "-D":
-		cccccc = "001111"
-	case "-A", "-M":
-		cccccc = "110011"
-	case "D+1":
-		cccccc = "011111"
-	case "A+1", "M+1":
-		cccccc = "110111"
-	case "D-1":
-		cccccc = "001110"
-	case "A-1", "M-1":
-		cccccc = "110010"
-	case "D+A", "D+M":
-		cccccc = "000010"
-	case "D-A", "D-M":
-		cccccc = "010011"
-	case "A-D", "M-D":
-		cccccc = "000111"
-	case "D&A", "D&M":
-		cccccc = "000000"
-	case "D|A", "D|M":
-		cccccc = "010101"
-	default:
-		return "", errors.New("invalid comp mnemonic")
+	has := map[rune]bool{}
+	for _, c := range mnemonic {
+		if !strings.ContainsRune("AMD", c) || has[c] {
+			return mnemonic
+		}
+		has[c] = true
+	}
+	canonical := ""
+	for _, c := range "AMD" {
+		if has[c] {
+			canonical += string(c)
+		}
 	}
-	return BinaryCode(a + cccccc), nil
+	return Mnemonic(canonical)
 }
 
-// jump return the binary code of the jump mnemonic
-func jump(mnemonic Mnemonic) (BinaryCode, error) {
+// canonicalComp returns the standard spelling of a comp mnemonic. The operands of commutative operations can be written in any order. Example: "A+D" -> "D+A", "M&D" -> "D&M", "1+M" -> "M+1"
+func canonicalComp(mnemonic Mnemonic) Mnemonic {
 	switch mnemonic {
-	case "null":
-		return "000", nil
-	case "JGT":
-		return "001", nil
-	case "JEQ":
-		return "010", nil
-	case "JGE":
-		return "011", nil
-	case "JLT":
-		return "100", nil
-	case "JNE":
-		return "101", nil
-	case "JLE":
-		return "110", nil
-	case "JMP":
-		return "111", nil
-	default:
-		return "", errors.New("invalid jump mnemonic")
+	case "A+D", "M+D", "A&D", "M&D", "A|D", "M|D":
+		return mnemonic[2:] + mnemonic[1:2] + mnemonic[:1]
+	case "1+D", "1+A", "1+M":
+		return mnemonic[2:] + "+1"
 	}
+	return mnemonic
 }
@@ -1,6 +1,7 @@
 package hack
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -34,9 +35,12 @@ func TestSymbol(t *testing.T) {
 		expected string
 		hasError bool
 	}{
-		{"100", "000000001100100", false},     // Constant
-		{"LABEL", "000000000001000", false},   // Existing symbol
-		{"NEW_VAR", "000000000010000", false}, // New variable
+		{"100", "000000001100100", false},       // Constant
+		{"LABEL", "000000000001000", false},     // Existing symbol
+		{"NEW_VAR", "000000000010000", false},   // New variable
+		{"LABEL+0x2", "000000000001010", false}, // Constant expression
+		{"40000", "", true},                     // Out of range
+		{"LABEL-9", "", true},                   // Negative value
 	}
 
 	for _, test := range tests {
@@ -61,13 +65,16 @@ func TestDest(t *testing.T) {
 		{"AM", "101", false},
 		{"AD", "110", false},
 		{"AMD", "111", false},
+		{"DM", "011", false},  // Any order
+		{"ADM", "111", false}, // Any order
+		{"MM", "", true},      // Repeated register
 		{"INVALID", "", true}, // Invalid mnemonic
 	}
 
 	for _, test := range tests {
-		code, err := dest(test.input)
-		if (err != nil) != test.hasError || string(code) != test.expected {
-			t.Errorf(`dest("%s") = %q, %v, want %q, error: %v`, test.input, code, err, test.expected, test.hasError)
+		code, err := DefaultISA().dest(test.input)
+		if (err != nil) != test.hasError || err == nil && fmt.Sprintf("%03b", code) != test.expected {
+			t.Errorf(`dest("%s") = %03b, %v, want %q, error: %v`, test.input, code, err, test.expected, test.hasError)
 		}
 	}
 }
@@ -106,13 +113,17 @@ func TestComp(t *testing.T) {
 		{"D&M", "1000000", false},
 		{"D|A", "0010101", false},
 		{"D|M", "1010101", false},
-		{"INVALID", "", true}, // Invalid mnemonic
+		{"A+D", "0000010", false}, // Commuted operands
+		{"M|D", "1010101", false}, // Commuted operands
+		{"1+M", "1110111", false}, // Commuted operands
+		{"A-D+", "", true},        // Invalid mnemonic
+		{"INVALID", "", true},     // Invalid mnemonic
 	}
 
 	for _, test := range tests {
-		code, err := comp(test.input)
-		if (err != nil) != test.hasError || string(code) != test.expected {
-			t.Errorf(`comp("%s") = %q, %v, want %q, error: %v`, test.input, code, err, test.expected, test.hasError)
+		code, err := DefaultISA().comp(test.input)
+		if (err != nil) != test.hasError || err == nil && fmt.Sprintf("%07b", code&0b1111111) != test.expected {
+			t.Errorf(`comp("%s") = %07b, %v, want %q, error: %v`, test.input, code&0b1111111, err, test.expected, test.hasError)
 		}
 	}
 }
@@ -135,9 +146,9 @@ func TestJump(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		code, err := jump(test.input)
-		if (err != nil) != test.hasError || string(code) != test.expected {
-			t.Errorf(`jump("%s") = %q, %v, want %q, error: %v`, test.input, code, err, test.expected, test.hasError)
+		code, err := DefaultISA().jump(test.input)
+		if (err != nil) != test.hasError || err == nil && fmt.Sprintf("%03b", code) != test.expected {
+			t.Errorf(`jump("%s") = %03b, %v, want %q, error: %v`, test.input, code, err, test.expected, test.hasError)
 		}
 	}
 }
@@ -0,0 +1,156 @@
+package hack
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+/*
+conditional.go handles the defines and the conditional blocks of the preprocessor.
+
+#define NAME VALUE defines a name. After the definition, the name is replaced by its value in instructions and macro calls. A name defined without a value is only a flag for #ifdef. Names can also be defined by Options.Defines before the file is read.
+
+#ifdef NAME and #ifndef NAME start a block that is processed only if the name is defined (or not defined). #else starts the other branch and #endif ends the block. Blocks can be nested. A block must end in the file or the macro body where it starts, so an included file or a macro cannot close a block of its includer or caller. The lines of a disabled branch are removed before the label pass, so they take no ROM.
+
+	#define SCREEN_BASE 16384
+	#ifdef DEBUG
+	@R15
+	M=-1
+	#else
+	@SCREEN_BASE
+	#endif
+*/
+
+// conditional is a struct that represents an #ifdef or #ifndef block.
+type conditional struct {
+	pos     Position
+	cond    bool // true if the first branch is taken
+	parent  bool // true if the lines around the block are processed
+	active  bool // true if the lines of the current branch are processed
+	hasElse bool
+}
+
+// isConditional returns true if the directive starts, switches or ends a conditional block.
+func isConditional(directive string) bool {
+	switch directive {
+	case "#ifdef", "#ifndef", "#else", "#endif":
+		return true
+	}
+	return false
+}
+
+// active returns true if the current line is not in a disabled branch.
+func (pp *preprocessor) active() bool {
+	return len(pp.conditionals) == 0 || pp.conditionals[len(pp.conditionals)-1].active
+}
+
+// conditional processes #ifdef, #ifndef, #else and #endif. fields are the words of the line.
+func (pp *preprocessor) conditional(l sourceLine, fields []string) {
+	switch fields[0] {
+	case "#ifdef", "#ifndef":
+		c := conditional{pos: l.origin.pos, parent: pp.active()}
+		if len(fields) != 2 || !isValidSymbol(SymbolOrConstant(fields[1])) {
+			if c.parent {
+				pp.errorf(l, "invalid %s: want %s NAME", fields[0], fields[0])
+			}
+		} else {
+			_, defined := pp.defines[fields[1]]
+			c.cond = defined == (fields[0] == "#ifdef")
+		}
+		c.active = c.parent && c.cond
+		pp.conditionals = append(pp.conditionals, c)
+	case "#else":
+		if len(pp.conditionals) <= pp.outer {
+			pp.errorf(l, "#else without #ifdef")
+			return
+		}
+		c := &pp.conditionals[len(pp.conditionals)-1]
+		if c.hasElse {
+			pp.errorf(l, "#else after #else of the block at %v", c.pos)
+			return
+		}
+		c.hasElse = true
+		c.active = c.parent && !c.cond
+	case "#endif":
+		if len(pp.conditionals) <= pp.outer {
+			pp.errorf(l, "#endif without #ifdef")
+			return
+		}
+		pp.conditionals = pp.conditionals[:len(pp.conditionals)-1]
+	}
+}
+
+// closeConditionals reports the blocks opened in the current file or macro expansion that are not closed, and closes them. It is called at the end of each file and expansion.
+func (pp *preprocessor) closeConditionals() {
+	for _, c := range pp.conditionals[pp.outer:] {
+		pp.diags.add(c.pos, "conditional block is not closed with #endif")
+	}
+	pp.conditionals = pp.conditionals[:pp.outer]
+}
+
+// DefineFlags is a set of defines that can be given as command line flags like Options.Defines. Each flag is a name and an optional value separated by "=". Example: flag.Var(defines, "D", "define a name"), then "-D DEBUG -D SCREEN_BASE=16384"
+type DefineFlags map[string]string
+
+// String returns the defines sorted by name. Example: "DEBUG=,SCREEN_BASE=16384"
+func (d DefineFlags) String() string {
+	var defs []string
+	for _, name := range slices.Sorted(maps.Keys(d)) {
+		defs = append(defs, name+"="+d[name])
+	}
+	return strings.Join(defs, ",")
+}
+
+// Set adds a define given as "NAME" or "NAME=VALUE".
+func (d DefineFlags) Set(s string) error {
+	name, value, _ := strings.Cut(s, "=")
+	if name == "" {
+		return fmt.Errorf("invalid define %q", s)
+	}
+	d[name] = value
+	return nil
+}
+
+// define processes a #define directive. fields are the words of the line. Example: ["#define", "SCREEN_BASE", "16384"]
+func (pp *preprocessor) define(l sourceLine, fields []string) {
+	if len(fields) < 2 || len(fields) > 3 || !isValidSymbol(SymbolOrConstant(fields[1])) {
+		pp.errorf(l, "invalid #define: want #define NAME or #define NAME VALUE")
+		return
+	}
+	value := ""
+	if len(fields) == 3 {
+		value = fields[2]
+	}
+	pp.defines[fields[1]] = value
+}
+
+// replaceDefines replaces the defined names in the line with their values. Comments, names without a value and the words that start with a digit are kept. Example: "@SCREEN_BASE+1" -> "@16384+1"
+func (pp *preprocessor) replaceDefines(text string) string {
+	if len(pp.defines) == 0 {
+		return text
+	}
+	code, comment, hasComment := cutComment(text)
+	var b strings.Builder
+	for i := 0; i < len(code); {
+		if !isSymbolChar(rune(code[i])) {
+			b.WriteByte(code[i])
+			i++
+			continue
+		}
+		end := i
+		for end < len(code) && isSymbolChar(rune(code[end])) {
+			end++
+		}
+		word := code[i:end]
+		if value := pp.defines[word]; value != "" && isValidSymbol(SymbolOrConstant(word)) {
+			word = value
+		}
+		b.WriteString(word)
+		i = end
+	}
+	if hasComment {
+		b.WriteString("//" + comment)
+	}
+	return b.String()
+}
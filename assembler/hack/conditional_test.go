@@ -0,0 +1,172 @@
+package hack
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConditionalAssembly(t *testing.T) {
+	asmCode := `#define BASE 100
+#ifdef DEBUG
+@R15 // debug only
+M=-1
+#ifndef QUIET
+@R14
+#endif
+#else
+@BASE+1
+#endif
+#ifndef BASE
+@1
+#endif
+(END)
+@END
+0;JMP
+`
+	tests := []struct {
+		name     string
+		defines  map[string]string
+		expected []uint16
+	}{
+		{name: "release", expected: []uint16{101, 1, 0xEA87}},
+		{name: "debug", defines: map[string]string{"DEBUG": ""}, expected: []uint16{15, 0xEE88, 14, 3, 0xEA87}},
+		{name: "quiet debug", defines: map[string]string{"DEBUG": "", "QUIET": ""}, expected: []uint16{15, 0xEE88, 2, 0xEA87}},
+		{name: "define in the file wins", defines: map[string]string{"BASE": "7"}, expected: []uint16{101, 1, 0xEA87}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, assemble := range map[string]func(io.Reader, Options) (Result, error){"Assemble": Assemble, "AssembleStream": AssembleStream} {
+				result, err := assemble(strings.NewReader(asmCode), Options{Defines: test.defines})
+				if err != nil {
+					t.Fatalf("%s failed: %v", name, err)
+				}
+				if diff := cmp.Diff(test.expected, result.Words); diff != "" {
+					t.Errorf("%s words mismatch (-want +got):\n%s", name, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestConditionalDiagnostics(t *testing.T) {
+	asmCode := `#ifdef
+#endif
+#else
+#endif
+#ifdef A
+#else
+#else
+#endif
+#define 1X 2
+#ifndef B
+`
+	expected := Diagnostics{
+		{Pos: Position{"Prog.asm", 1, 1}, Message: `invalid #ifdef: want #ifdef NAME`},
+		{Pos: Position{"Prog.asm", 3, 1}, Message: `#else without #ifdef`},
+		{Pos: Position{"Prog.asm", 4, 1}, Message: `#endif without #ifdef`},
+		{Pos: Position{"Prog.asm", 7, 1}, Message: `#else after #else of the block at Prog.asm:5:1`},
+		{Pos: Position{"Prog.asm", 9, 1}, Message: `invalid #define: want #define NAME or #define NAME VALUE`},
+		{Pos: Position{"Prog.asm", 10, 1}, Message: `conditional block is not closed with #endif`},
+	}
+	_, err := Assemble(strings.NewReader(asmCode), Options{FileName: "Prog.asm"})
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("Assemble returned %v, want Diagnostics", err)
+	}
+	if diff := cmp.Diff(expected, diags); diff != "" {
+		t.Errorf("Assemble diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestConditionalScope tests that an included file or a macro body cannot switch or close the blocks around it, in both passes.
+func TestConditionalScope(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "Lib.asm")
+	if err := os.WriteFile(lib, []byte("@2\n#else\n#endif\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, "Main.asm")
+	asmCode := `#macro CLOSE
+#endif
+@3
+#ifdef Y
+#endmacro
+#ifndef X
+#include "Lib.asm"
+CLOSE
+@1
+#endif
+`
+	expected := Diagnostics{
+		{Pos: Position{lib, 2, 1}, Message: `#else without #ifdef`},
+		{Pos: Position{lib, 3, 1}, Message: `#endif without #ifdef`},
+		{Pos: Position{main, 2, 1}, Message: `#endif without #ifdef`, Expansion: []Position{{main, 8, 1}}},
+		{Pos: Position{main, 4, 1}, Message: `conditional block is not closed with #endif`},
+	}
+	for name, assemble := range map[string]func(io.Reader, Options) (Result, error){"Assemble": Assemble, "AssembleStream": AssembleStream} {
+		_, err := assemble(strings.NewReader(asmCode), Options{FileName: main})
+		var diags Diagnostics
+		if !errors.As(err, &diags) {
+			t.Fatalf("%s returned %v, want Diagnostics", name, err)
+		}
+		if diff := cmp.Diff(expected, diags); diff != "" {
+			t.Errorf("%s diagnostics mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+
+	// the blocks are closed where they start
+	if err := os.WriteFile(lib, []byte("#ifdef X\n@2\n#else\n@3\n#endif\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, assemble := range map[string]func(io.Reader, Options) (Result, error){"Assemble": Assemble, "AssembleStream": AssembleStream} {
+		result, err := assemble(strings.NewReader("#ifndef X\n#include \"Lib.asm\"\n@1\n#endif\n"), Options{FileName: main})
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		if diff := cmp.Diff([]uint16{3, 1}, result.Words); diff != "" {
+			t.Errorf("%s words mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+}
+
+// TestDefineToNothing tests that a line that a define rewrites to nothing or to a comment is kept as an empty line, and that invalid define values are reported.
+func TestDefineToNothing(t *testing.T) {
+	for name, assemble := range map[string]func(io.Reader, Options) (Result, error){"Assemble": Assemble, "AssembleStream": AssembleStream} {
+		result, err := assemble(strings.NewReader("#define X /\nX/\n@1\n"), Options{})
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		if diff := cmp.Diff([]uint16{1}, result.Words); diff != "" {
+			t.Errorf("%s words mismatch (-want +got):\n%s", name, diff)
+		}
+		for _, value := range []string{" ", "a b", "1//2"} {
+			_, err := assemble(strings.NewReader("X\n"), Options{FileName: "Prog.asm", Defines: map[string]string{"X": value}})
+			var diags Diagnostics
+			if !errors.As(err, &diags) || !strings.Contains(diags[0].Message, "invalid value") {
+				t.Errorf("%s with X=%q returned %v, want an invalid value diagnostic", name, value, err)
+			}
+		}
+	}
+}
+
+func TestDefineFlags(t *testing.T) {
+	defines := DefineFlags{}
+	fs := flag.NewFlagSet("asm", flag.ContinueOnError)
+	fs.Var(defines, "D", "")
+	if err := fs.Parse([]string{"-D", "DEBUG", "-D", "SCREEN_BASE=16384"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if want := "DEBUG=,SCREEN_BASE=16384"; defines.String() != want {
+		t.Errorf("String() = %q, want %q", defines.String(), want)
+	}
+	if err := defines.Set("=1"); err == nil {
+		t.Errorf("Set(\"=1\") returned no error")
+	}
+}
@@ -0,0 +1,198 @@
+package hack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+data.go handles the data directives. A data directive reserves a block of RAM and binds a symbol to its first word. The blocks are allocated from RAM address 16 in the order of the directives, before the variables.
+
+	.data  buffer 32          // reserves 32 words. They are not initialized
+	.word  table 1, -1, 0x10  // reserves 3 words initialized with the values
+	.word  jumps LOOP, END    // values can be symbols and constant expressions
+	.string msg "Hi\n"        // reserves one word for each character and a terminating 0
+
+The assembler inserts the code that writes the initial values at the entry point, before the first instruction of the program. Each word takes 2 instructions if its value is 0, 1 or -1 and 4 instructions otherwise. The directives can be anywhere in the file, except in a single pass where they must come before the first instruction.
+*/
+
+// dataBlock is a struct that represents a block of RAM reserved by a data directive.
+type dataBlock struct {
+	name   SymbolOrConstant
+	size   int
+	values []string // the values of the A instructions that load the initial values. A negative constant has the form "!n" for D=!A. It is nil for .data
+	origin lineOrigin
+}
+
+// DataReport is a struct that represents the RAM reserved by data directives and the size of the code that initializes it.
+type DataReport struct {
+	Words        int // the number of reserved words of RAM
+	Instructions int // the number of instructions inserted at the entry point
+}
+
+// String returns the report. Example: "data: 12 words of RAM initialized by 40 instructions"
+func (r DataReport) String() string {
+	return fmt.Sprintf("data: %d words of RAM initialized by %d instructions", r.Words, r.Instructions)
+}
+
+// newDataReport counts the words and the initialization instructions of the blocks.
+func newDataReport(blocks []dataBlock) DataReport {
+	var r DataReport
+	for _, b := range blocks {
+		r.Words += b.size
+		r.Instructions += len(b.initCode())
+	}
+	return r
+}
+
+// dataDirective processes .data, .word and .string. rest is the text after the directive. Example: "table 1, 2, 3"
+func (pp *preprocessor) dataDirective(l sourceLine, directive, rest string) {
+	if pp.sink != nil && pp.dataEmitted {
+		pp.errorf(l, "%s after the first instruction cannot be assembled in a single pass", directive)
+		return
+	}
+	name, args := "", ""
+	if fields := strings.Fields(rest); len(fields) > 0 {
+		name = fields[0]
+		args = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest), name))
+	}
+	b := dataBlock{name: SymbolOrConstant(name), origin: l.origin}
+	if !isValidSymbol(b.name) {
+		pp.errorf(l, "invalid %s name %q", directive, name)
+		return
+	}
+	for _, other := range pp.data {
+		if other.name == b.name {
+			pp.errorf(l, "data %s is already defined at %v", name, other.origin.pos)
+			return
+		}
+	}
+
+	switch directive {
+	case ".data":
+		size, err := parseNumber(removeSpaces(pp.replaceDefines(args)))
+		if err != nil || size <= 0 {
+			pp.errorf(l, "invalid .data size %q: want a positive number", args)
+			return
+		}
+		b.size = size
+	case ".word":
+		values := splitArgs(pp.replaceDefines(args))
+		if len(values) == 0 {
+			pp.errorf(l, ".word %s has no values", name)
+			return
+		}
+		for _, v := range values {
+			value, err := dataValue(removeSpaces(v))
+			if err != nil {
+				pp.errorf(l, "%v", err)
+				return
+			}
+			b.values = append(b.values, value)
+		}
+		b.size = len(b.values)
+	case ".string":
+		s, err := strconv.Unquote(args)
+		if err != nil || !strings.HasPrefix(args, `"`) {
+			pp.errorf(l, `invalid .string %s: want .string NAME "text"`, args)
+			return
+		}
+		for _, r := range s {
+			if r > 32767 {
+				pp.errorf(l, "character %q of .string %s is out of range 0..32767", r, name)
+				return
+			}
+			b.values = append(b.values, strconv.Itoa(int(r)))
+		}
+		b.values = append(b.values, "0")
+		b.size = len(b.values)
+	}
+	pp.data = append(pp.data, b)
+}
+
+// dataValue converts a value of .word to the value of an A instruction. Constants are 16-bit words from -32768 to 65535, and a negative word is loaded with D=!A. Other values are left to the assembler. Example: "-1" -> "!0", "0xFFFE" -> "!1", "LOOP+1" -> "LOOP+1"
+func dataValue(v string) (string, error) {
+	if v == "" {
+		return "", fmt.Errorf("empty .word value")
+	}
+	digits, negative := strings.CutPrefix(v, "-")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' {
+		return v, nil
+	}
+	n, err := parseNumber(digits)
+	if err != nil {
+		return "", err
+	}
+	if negative {
+		n = -n
+	}
+	if n < -32768 || n > 65535 {
+		return "", fmt.Errorf(".word value %s is out of range -32768..65535", v)
+	}
+	if w := int(int16(uint16(n))); w < 0 {
+		return "!" + strconv.Itoa(^w), nil
+	}
+	return strconv.Itoa(n), nil
+}
+
+// initCode returns the instructions that write the initial values of the block.
+func (b dataBlock) initCode() []string {
+	var code []string
+	for i, v := range b.values {
+		addr := "@" + string(b.name)
+		if i > 0 {
+			addr += "+" + strconv.Itoa(i)
+		}
+		switch v {
+		case "0", "1":
+			code = append(code, addr, "M="+v)
+		case "!0":
+			code = append(code, addr, "M=-1")
+		default:
+			load := "D=A"
+			if strings.HasPrefix(v, "!") {
+				v, load = v[1:], "D=!A"
+			}
+			code = append(code, "@"+v, load, addr, "M=D")
+		}
+	}
+	return code
+}
+
+// dataInit returns the initialization code of the blocks. Each line comes from its data directive.
+func (pp *preprocessor) dataInit() []sourceLine {
+	var lines []sourceLine
+	for _, b := range pp.data {
+		for _, inst := range b.initCode() {
+			lines = append(lines, sourceLine{text: inst, origin: b.origin})
+		}
+	}
+	return lines
+}
+
+// flushData passes the initialization code to the sink once. After that, no more data directives are accepted.
+func (pp *preprocessor) flushData() {
+	if pp.dataEmitted {
+		return
+	}
+	pp.dataEmitted = true
+	for _, l := range pp.dataInit() {
+		pp.sink(l)
+	}
+}
+
+// bindData reserves the RAM of the blocks in the symbol table. Blocks in the memory map are reported as warnings.
+func bindData(symbolTable *SymbolTable, blocks []dataBlock, diags *Diagnostics) {
+	for _, b := range blocks {
+		if err := symbolTable.addData(b.name, b.size); err != nil {
+			*diags = append(*diags, b.origin.diagnostic(1, "%v", err))
+			continue
+		}
+		if last := symbolTable.table[b.name] + b.size - 1; last >= predefinedSymbols["SCREEN"] {
+			d := b.origin.diagnostic(1, "data %s at RAM addresses %d..%d overflows into the memory map", b.name, symbolTable.table[b.name], last)
+			d.Severity, d.Rule = SeverityWarning, "memory-map"
+			*diags = append(*diags, d)
+		}
+	}
+}
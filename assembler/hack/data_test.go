@@ -0,0 +1,206 @@
+package hack
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDataDirectives(t *testing.T) {
+	asmCode := `.word table 1, -2, 0x10
+.string msg "Hi"
+.data buf 2
+.word jumps LOOP
+(LOOP)
+@table+1
+D=M
+@i
+M=D
+@LOOP
+0;JMP
+`
+	// the directives can be anywhere if the file is read twice
+	dataAtEnd := `(LOOP)
+@table+1
+D=M
+.word table 1, -2, 0x10
+@i
+M=D
+@LOOP
+0;JMP
+.string msg "Hi"
+.data buf 2
+.word jumps LOOP
+`
+	// the same program with the initialization code written by hand
+	handWritten := `@16
+M=1
+@1
+D=!A
+@17
+M=D
+@16
+D=A
+@18
+M=D
+@72
+D=A
+@19
+M=D
+@105
+D=A
+@20
+M=D
+@21
+M=0
+@24
+D=A
+@24
+M=D
+@17
+D=M
+@25
+M=D
+@24
+0;JMP
+`
+	want, err := Assemble(strings.NewReader(handWritten), Options{})
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+	tests := []struct {
+		name     string
+		assemble func(io.Reader, Options) (Result, error)
+		asmCode  string
+	}{
+		{"Assemble", Assemble, asmCode},
+		{"AssembleStream", AssembleStream, asmCode},
+		{"Assemble with data at the end", Assemble, dataAtEnd},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := test.name
+			result, err := test.assemble(strings.NewReader(test.asmCode), Options{})
+			if err != nil {
+				t.Fatalf("%s failed: %v", name, err)
+			}
+			if diff := cmp.Diff(want.Words, result.Words); diff != "" {
+				t.Errorf("%s words mismatch (-want +got):\n%s", name, diff)
+			}
+			if diff := cmp.Diff(DataReport{Words: 9, Instructions: 24}, result.Data); diff != "" {
+				t.Errorf("%s data report mismatch (-want +got):\n%s", name, diff)
+			}
+			for _, sym := range []Symbol{{"table", SymbolData, 16}, {"msg", SymbolData, 19}, {"buf", SymbolData, 22}, {"jumps", SymbolData, 24}, {"i", SymbolVariable, 25}} {
+				if got, _ := result.SymbolTable.Lookup(sym.Name); got != sym {
+					t.Errorf("%s Lookup(%s) = %v, want %v", name, sym.Name, got, sym)
+				}
+			}
+		})
+	}
+}
+
+// TestDataStringWithSlashes tests that "//" in the text of .string is not a comment.
+func TestDataStringWithSlashes(t *testing.T) {
+	want, err := Assemble(strings.NewReader(".word url 97, 47, 47, 98, 34, 47, 47, 0\n@url\n"), Options{})
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+	tests := []struct {
+		name    string
+		asmCode string
+	}{
+		{"direct", `.string url "a//b\"//" // the comment is removed
+@url
+`},
+		// the parameters after "//" in the quoted text are replaced
+		{"macro", `#macro STRING name, text, end
+.string %name "%text//%end\"//" // the comment is removed
+#endmacro
+STRING url, a, b
+@url
+`},
+		// the define after the quoted text is replaced
+		{"define", `#define NAME url
+#macro STRING text, name
+.string %name %text
+#endmacro
+STRING "a//b\"//", NAME
+@url
+`},
+	}
+	for _, test := range tests {
+		for name, assemble := range map[string]func(io.Reader, Options) (Result, error){"Assemble": Assemble, "AssembleStream": AssembleStream} {
+			result, err := assemble(strings.NewReader(test.asmCode), Options{})
+			if err != nil {
+				t.Fatalf("%s %s failed: %v", test.name, name, err)
+			}
+			if diff := cmp.Diff(want.Words, result.Words); diff != "" {
+				t.Errorf("%s %s words mismatch (-want +got):\n%s", test.name, name, diff)
+			}
+		}
+	}
+}
+
+func TestDataValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"0", "0"},
+		{"-1", "!0"},
+		{"-32768", "!32767"},
+		{"0xFFFE", "!1"},
+		{"32767", "32767"},
+		{"LOOP+1", "LOOP+1"},
+	}
+	for _, test := range tests {
+		got, err := dataValue(test.value)
+		if err != nil || got != test.expected {
+			t.Errorf("dataValue(%q) = %q, %v, want %q", test.value, got, err, test.expected)
+		}
+	}
+	if _, err := dataValue("65536"); err == nil {
+		t.Errorf("dataValue(%q) returned no error", "65536")
+	}
+}
+
+func TestDataDiagnostics(t *testing.T) {
+	asmCode := `.word 1x 1
+.word t
+.data t 0
+.string s Hi
+.word t 1, 70000
+.word t 1
+.data t 2
+.data R0 1
+`
+	expected := Diagnostics{
+		{Pos: Position{"Prog.asm", 1, 1}, Message: `invalid .word name "1x"`},
+		{Pos: Position{"Prog.asm", 2, 1}, Message: `.word t has no values`},
+		{Pos: Position{"Prog.asm", 3, 1}, Message: `invalid .data size "0": want a positive number`},
+		{Pos: Position{"Prog.asm", 4, 1}, Message: `invalid .string Hi: want .string NAME "text"`},
+		{Pos: Position{"Prog.asm", 5, 1}, Message: `.word value 70000 is out of range -32768..65535`},
+		{Pos: Position{"Prog.asm", 7, 1}, Message: `data t is already defined at Prog.asm:6:1`},
+		{Pos: Position{"Prog.asm", 8, 1}, Message: `data R0 conflicts with the predefined symbol`},
+	}
+	_, err := Assemble(strings.NewReader(asmCode), Options{FileName: "Prog.asm"})
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("Assemble returned %v, want Diagnostics", err)
+	}
+	if diff := cmp.Diff(expected, diags); diff != "" {
+		t.Errorf("Assemble diagnostics mismatch (-want +got):\n%s", diff)
+	}
+
+	// a single pass needs the data before the first instruction
+	_, err = AssembleStream(strings.NewReader("@0\n.word t 1\n"), Options{FileName: "Prog.asm"})
+	if err == nil || !strings.Contains(err.Error(), "Prog.asm:2:1: .word after the first instruction cannot be assembled in a single pass") {
+		t.Errorf("AssembleStream returned %v", err)
+	}
+	if _, err := AssembleObject(strings.NewReader(".word t 1\n"), Options{}); err == nil {
+		t.Error("AssembleObject with data returned no error")
+	}
+}
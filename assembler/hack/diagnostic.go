@@ -0,0 +1,112 @@
+package hack
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Position is a struct that represents a position in an assembly file. Line and Column are 1-based. Example: Position{"Prog.asm", 3, 1} -> "Prog.asm:3:1"
+type Position struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// String returns the position in the form "file:line:column". The file name is omitted if it is empty.
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Severity is the severity of a diagnostic. The zero value is SeverityError.
+type Severity int
+
+const (
+	SeverityError   Severity = iota // the file cannot be assembled
+	SeverityWarning                 // the file can be assembled but the code is suspicious
+)
+
+// String returns the name of the severity. Example: "warning"
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Diagnostic is a struct that represents a problem found in an assembly file and its position. If the problem is in a macro body, Pos is the position in the body and Expansion lists the macro call sites, innermost first. Rule is the name of the check that reported a warning. Example: "unused-label"
+type Diagnostic struct {
+	Pos       Position
+	Message   string
+	Expansion []Position
+	Severity  Severity
+	Rule      string
+}
+
+// Error returns the diagnostic in the form "file:line:column: message". Warnings have the form "file:line:column: warning: message [rule]". The macro call sites are appended in the form " (expanded from file:line:column, ...)".
+func (d Diagnostic) Error() string {
+	s := d.Pos.String() + ": " + d.Message
+	if d.Severity != SeverityError {
+		s = d.Pos.String() + ": " + d.Severity.String() + ": " + d.Message
+		if d.Rule != "" {
+			s += " [" + d.Rule + "]"
+		}
+	}
+	if len(d.Expansion) > 0 {
+		sites := make([]string, len(d.Expansion))
+		for i, pos := range d.Expansion {
+			sites[i] = pos.String()
+		}
+		s += " (expanded from " + strings.Join(sites, ", ") + ")"
+	}
+	return s
+}
+
+// Diagnostics is a list of diagnostics. It implements the error interface so that all problems in a file can be returned at once.
+type Diagnostics []Diagnostic
+
+// Error returns all diagnostics separated by newlines.
+func (ds Diagnostics) Error() string {
+	lines := make([]string, len(ds))
+	for i, d := range ds {
+		lines[i] = d.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Err returns nil if there are no errors, otherwise it returns the diagnostics sorted by position. Warnings alone are not an error.
+func (ds Diagnostics) Err() error {
+	if !ds.HasErrors() {
+		return nil
+	}
+	ds.sort()
+	return ds
+}
+
+// HasErrors returns true if any diagnostic has SeverityError.
+func (ds Diagnostics) HasErrors() bool {
+	return slices.ContainsFunc(ds, func(d Diagnostic) bool { return d.Severity == SeverityError })
+}
+
+// add appends a new diagnostic at the given position.
+func (ds *Diagnostics) add(pos Position, format string, args ...any) {
+	*ds = append(*ds, Diagnostic{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// sort sorts the diagnostics by file, line and column. Diagnostics at the same position keep their order.
+func (ds Diagnostics) sort() {
+	slices.SortStableFunc(ds, func(a, b Diagnostic) int {
+		return cmp.Or(
+			cmp.Compare(a.Pos.File, b.Pos.File),
+			cmp.Compare(a.Pos.Line, b.Pos.Line),
+			cmp.Compare(a.Pos.Column, b.Pos.Column),
+		)
+	})
+}
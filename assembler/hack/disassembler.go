@@ -0,0 +1,155 @@
+package hack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DisassembleOptions is a struct that controls how Disassemble names the values of A instructions.
+type DisassembleOptions struct {
+	// Labels makes Disassemble synthesize a label for every jump target. Example: "@7\n0;JMP" -> "@LABEL_7\n0;JMP" and "(LABEL_7)" before ROM[7]
+	Labels bool
+	// PredefinedSymbols makes Disassemble use the predefined symbols of [NewSymbolTable]. SCREEN and KBD are always used. SP, LCL, ARG, THIS, THAT and R5-R15 are used only when the next instruction accesses M.
+	PredefinedSymbols bool
+	// Format is the format of the binary code file. The default is FormatHack
+	Format Format
+	// ISA is the instruction set of the C instructions. The default is the standard Hack instruction set
+	ISA *ISA
+}
+
+// Disassemble converts a Hack binary code file to an assembly language file. Assembling the output with [Hack] reproduces hackFile bit for bit.
+func Disassemble(hackFile io.Reader, asmFile io.Writer, opts DisassembleOptions) error {
+	prog, err := DisassembleProgram(hackFile, opts)
+	if err != nil {
+		return err
+	}
+	return WriteProgram(asmFile, prog)
+}
+
+// DisassembleProgram converts a Hack binary code file to a [Program]. The position of each node is the line of the node in the printed program.
+func DisassembleProgram(hackFile io.Reader, opts DisassembleOptions) (*Program, error) {
+	codes, err := readBinaryCodes(hackFile, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	// find jump targets
+	labels := map[int]string{}
+	if opts.Labels {
+		for i := range codes {
+			if target, ok := jumpTarget(codes, i); ok && target <= len(codes) {
+				labels[target] = "LABEL_" + strconv.Itoa(target)
+			}
+		}
+	}
+	predefined := predefinedSymbolNames()
+
+	prog := &Program{}
+	add := func(inst Instruction) {
+		info := NodeInfo{Position: Position{Line: len(prog.Nodes) + 1, Column: 1}}
+		prog.Nodes = append(prog.Nodes, instructionNode(inst, info))
+	}
+	for i, code := range codes {
+		if label, ok := labels[i]; ok {
+			add(Instruction("(" + label + ")"))
+		}
+		inst, err := disassembleInstruction(code, opts.ISA)
+		if err != nil {
+			return nil, fmt.Errorf("instruction %d: %w", i, err)
+		}
+		if code[0] == '0' {
+			value, _ := strconv.ParseInt(string(code[1:]), 2, 64)
+			if target, ok := jumpTarget(codes, i); ok && labels[target] != "" {
+				inst = Instruction("@" + labels[target])
+			} else if name, ok := predefined[int(value)]; ok && opts.PredefinedSymbols && (name == "SCREEN" || name == "KBD" || accessesM(codes, i+1)) {
+				inst = Instruction("@" + name)
+			}
+		}
+		add(inst)
+	}
+	// a jump target may be the address right after the last instruction
+	if label, ok := labels[len(codes)]; ok {
+		add(Instruction("(" + label + ")"))
+	}
+	return prog, nil
+}
+
+// readBinaryCodes reads a Hack binary code file in the given format and converts each word to a 16-bit binary code.
+func readBinaryCodes(hackFile io.Reader, f Format) ([]BinaryCode, error) {
+	words, err := ReadWords(hackFile, f)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]BinaryCode, len(words))
+	for i, word := range words {
+		codes[i] = BinaryCode(fmt.Sprintf("%016b", word))
+	}
+	return codes, nil
+}
+
+// jumpTarget returns the value of the A instruction codes[i] if the next instruction is a C instruction that may jump.
+func jumpTarget(codes []BinaryCode, i int) (int, bool) {
+	if i+1 >= len(codes) || codes[i][0] != '0' || codes[i+1][0] != '1' || codes[i+1][13:] == "000" {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(string(codes[i][1:]), 2, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int(value), true
+}
+
+// accessesM returns true if codes[i] is a C instruction that reads or writes M
+func accessesM(codes []BinaryCode, i int) bool {
+	if i >= len(codes) || codes[i][0] != '1' {
+		return false
+	}
+	// a bit or the M bit of dest
+	return codes[i][3] == '1' || codes[i][12] == '1'
+}
+
+// predefinedSymbolNames returns a map of addresses to the predefined symbols of [NewSymbolTable]. If several symbols share an address, the one other than R0-R15 is used. Example: 0 -> "SP", 5 -> "R5"
+func predefinedSymbolNames() map[int]string {
+	names := map[int]string{}
+	isRegister := func(s string) bool {
+		_, err := strconv.Atoi(strings.TrimPrefix(s, "R"))
+		return strings.HasPrefix(s, "R") && err == nil
+	}
+	for sym, addr := range predefinedSymbols {
+		name := string(sym)
+		if old, ok := names[addr]; ok && (!isRegister(old) || isRegister(name) && old < name) {
+			continue
+		}
+		names[addr] = name
+	}
+	return names
+}
+
+// disassembleInstruction converts a 16-bit binary code to an instruction of the given instruction set. Example: "0000000000000010" -> "@2", "1110110000010000" -> "D=A"
+func disassembleInstruction(code BinaryCode, isa *ISA) (Instruction, error) {
+	if len(code) != 16 {
+		return "", errors.New("binary code must be 16 bits")
+	}
+	if code[0] == '0' {
+		value, err := strconv.ParseInt(string(code[1:]), 2, 64)
+		if err != nil {
+			return "", err
+		}
+		return Instruction("@" + strconv.FormatInt(value, 10)), nil
+	}
+	compMnemonic, destMnemonic, jumpMnemonic, err := isa.Decode(code.word())
+	if err != nil {
+		return "", fmt.Errorf("invalid C instruction %q: %w", code, err)
+	}
+	inst := string(compMnemonic)
+	if destMnemonic != "null" {
+		inst = string(destMnemonic) + "=" + inst
+	}
+	if jumpMnemonic != "null" {
+		inst += ";" + string(jumpMnemonic)
+	}
+	return Instruction(inst), nil
+}
@@ -0,0 +1,123 @@
+package hack
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	hackCode := `0000000000000000
+1111110000010000
+0000000000000101
+1110001100000001
+0100000000000000
+1110110000010000
+0000000000000101
+1110101010000111
+`
+	tests := []struct {
+		opts     DisassembleOptions
+		expected string
+	}{
+		{DisassembleOptions{}, "@0\nD=M\n@5\nD;JGT\n@16384\nD=A\n@5\n0;JMP\n"},
+		{DisassembleOptions{Labels: true}, "@0\nD=M\n@LABEL_5\nD;JGT\n@16384\n(LABEL_5)\nD=A\n@LABEL_5\n0;JMP\n"},
+		{DisassembleOptions{PredefinedSymbols: true}, "@SP\nD=M\n@5\nD;JGT\n@SCREEN\nD=A\n@5\n0;JMP\n"},
+	}
+	for _, test := range tests {
+		asmFile := &bytes.Buffer{}
+		if err := Disassemble(strings.NewReader(hackCode), asmFile, test.opts); err != nil {
+			t.Fatalf("Disassemble failed: %v", err)
+		}
+		if asmFile.String() != test.expected {
+			t.Errorf("Disassemble(%+v) = %q, want %q", test.opts, asmFile.String(), test.expected)
+		}
+	}
+}
+
+func TestDisassembleErrors(t *testing.T) {
+	tests := []string{
+		"000000000000001\n",  // 15 bits
+		"1010101010101010\n", // C instruction must start with 111
+		"1110000001000000\n", // invalid comp bits
+		"1111101010000000\n", // a=1 with a comp that does not use M
+		"00000000000000a0\n", // invalid character
+	}
+	for _, test := range tests {
+		if err := Disassemble(strings.NewReader(test), &bytes.Buffer{}, DisassembleOptions{}); err == nil {
+			t.Errorf("Disassemble(%q) expected an error", test)
+		}
+	}
+}
+
+// TestDisassembleRoundTrip checks that assembling the disassembled code reproduces the original binary code.
+func TestDisassembleRoundTrip(t *testing.T) {
+	hackFilePaths := []string{
+		"../asm_files/Prog.hack",
+		"../asm_files/add/Add.hack",
+		"../asm_files/max/MaxL.hack",
+		"../asm_files/rect/Rect.hack",
+		"../asm_files/rect/RectL.hack",
+	}
+	optsList := []DisassembleOptions{
+		{},
+		{Labels: true},
+		{PredefinedSymbols: true},
+		{Labels: true, PredefinedSymbols: true},
+	}
+	for _, hackFilePath := range hackFilePaths {
+		hackCode, err := os.ReadFile(hackFilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, opts := range optsList {
+			asmFile := &bytes.Buffer{}
+			if err := Disassemble(bytes.NewReader(hackCode), asmFile, opts); err != nil {
+				t.Fatalf("%s: Disassemble failed: %v", hackFilePath, err)
+			}
+			hackFile := &bytes.Buffer{}
+			if err := Hack(asmFile, hackFile); err != nil {
+				t.Fatalf("%s: Hack failed: %v", hackFilePath, err)
+			}
+			if hackFile.String() != string(hackCode) {
+				t.Errorf("%s %+v: round trip = %q, want %q", hackFilePath, opts, hackFile.String(), hackCode)
+			}
+		}
+	}
+}
+
+func TestCompMnemonic(t *testing.T) {
+	// every valid comp mnemonic must be reproduced from its binary code
+	mnemonics := []Mnemonic{"0", "1", "-1", "D", "A", "!D", "!A", "-D", "-A", "D+1", "A+1", "D-1", "A-1", "D+A", "D-A", "A-D", "D&A", "D|A",
+		"M", "!M", "-M", "M+1", "M-1", "D+M", "D-M", "M-D", "D&M", "D|M"}
+	isa := DefaultISA()
+	for _, m := range mnemonics {
+		code, err := isa.comp(m)
+		if err != nil {
+			t.Fatalf("comp(%q) failed: %v", m, err)
+		}
+		got, _, _, err := isa.Decode(code << 6)
+		if err != nil || got != m {
+			t.Errorf("Decode(%016b) = %q, %v, want comp %q", code<<6, got, err, m)
+		}
+	}
+}
+
+func TestDestJumpMnemonic(t *testing.T) {
+	isa := DefaultISA()
+	// the C instruction "0" whose dest and jump fields are null
+	const zero = 0b1110101010000000
+	for _, m := range []Mnemonic{"null", "M", "D", "MD", "A", "AM", "AD", "AMD"} {
+		code, _ := isa.dest(m)
+		if _, got, _, err := isa.Decode(zero | code<<3); err != nil || got != m {
+			t.Errorf("Decode(%016b) = %q, %v, want dest %q", zero|code<<3, got, err, m)
+		}
+	}
+	for _, m := range []Mnemonic{"null", "JGT", "JEQ", "JGE", "JLT", "JNE", "JLE", "JMP"} {
+		code, _ := isa.jump(m)
+		if _, _, got, err := isa.Decode(zero | code); err != nil || got != m {
+			t.Errorf("Decode(%016b) = %q, %v, want jump %q", zero|code, got, err, m)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package hack
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+expression.go evaluates constant expressions of A instructions at assembly time.
+
+	expr    = term { ("+" | "-") term }
+	term    = unary { ("*" | "/" | "%") unary }
+	unary   = "-" unary | primary
+	primary = number | symbol | "(" expr ")"
+	number  = decimal | "0x" hex | "0b" binary
+
+Example: @0x4000, @0b101, @LOOP+3, @SCREEN+32*5, @-(-3)
+Every intermediate value must be a 32-bit signed integer like the numbers, so a product that is too large is an error instead of wrapping around.
+Spaces are removed by the parser before evaluation. Symbols are resolved by the symbol table, so an undefined symbol becomes a new variable as in @symbol.
+*/
+
+// exprError is an error in an expression. offset is the byte offset of the error in the expression.
+type exprError struct {
+	offset int
+	msg    string
+}
+
+func (e *exprError) Error() string {
+	return e.msg
+}
+
+// exprParser is a struct that represents a recursive descent parser of an expression. resolve returns the value of a symbol.
+type exprParser struct {
+	s       string
+	i       int
+	resolve func(SymbolOrConstant) (int, error)
+}
+
+// evalExpression evaluates the given expression. It returns an [*exprError] that has the offset of the problem.
+func evalExpression(s string, resolve func(SymbolOrConstant) (int, error)) (int, error) {
+	p := &exprParser{s: s, resolve: resolve}
+	v, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	if p.i < len(s) {
+		return 0, p.errorf(p.i, "unexpected %q in expression %q", s[p.i], s)
+	}
+	return v, nil
+}
+
+func (p *exprParser) errorf(offset int, format string, args ...any) error {
+	return &exprError{offset: offset, msg: fmt.Sprintf(format, args...)}
+}
+
+// peek returns the current byte or 0 at the end of the expression
+func (p *exprParser) peek() byte {
+	if p.i < len(p.s) {
+		return p.s[p.i]
+	}
+	return 0
+}
+
+func (p *exprParser) expr() (int, error) {
+	v, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		opOffset := p.i
+		p.i++
+		w, err := p.term()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			v += w
+		} else {
+			v -= w
+		}
+		if err := p.checkOverflow(v, opOffset); err != nil {
+			return 0, err
+		}
+	}
+	return v, nil
+}
+
+func (p *exprParser) term() (int, error) {
+	v, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for op := p.peek(); op == '*' || op == '/' || op == '%'; op = p.peek() {
+		opOffset := p.i
+		p.i++
+		w, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case op == '*':
+			v *= w
+		case w == 0:
+			return 0, p.errorf(opOffset, "division by zero in expression %q", p.s)
+		case op == '/':
+			v /= w
+		default:
+			v %= w
+		}
+		if err := p.checkOverflow(v, opOffset); err != nil {
+			return 0, err
+		}
+	}
+	return v, nil
+}
+
+// checkOverflow returns an error at the offset of the operator if the result of the operation is not a 32-bit signed integer. The operands are 32-bit, so the result of an operation never wraps around before the check.
+func (p *exprParser) checkOverflow(v, offset int) error {
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		return p.errorf(offset, "expression %q overflows", p.s)
+	}
+	return nil
+}
+
+func (p *exprParser) unary() (int, error) {
+	if p.peek() == '-' {
+		offset := p.i
+		p.i++
+		v, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		if err := p.checkOverflow(-v, offset); err != nil {
+			return 0, err
+		}
+		return -v, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (int, error) {
+	start := p.i
+	switch c := p.peek(); {
+	case c == '(':
+		p.i++
+		v, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, p.errorf(p.i, "missing ) in expression %q", p.s)
+		}
+		p.i++
+		return v, nil
+	case '0' <= c && c <= '9':
+		for p.i < len(p.s) && isSymbolChar(rune(p.s[p.i])) {
+			p.i++
+		}
+		v, err := parseNumber(p.s[start:p.i])
+		if err != nil {
+			return 0, p.errorf(start, "%v", err)
+		}
+		return v, nil
+	case isSymbolChar(rune(c)):
+		for p.i < len(p.s) && isSymbolChar(rune(p.s[p.i])) {
+			p.i++
+		}
+		v, err := p.resolve(SymbolOrConstant(p.s[start:p.i]))
+		if err != nil {
+			return 0, p.errorf(start, "%v", err)
+		}
+		return v, nil
+	case c == 0:
+		return 0, p.errorf(start, "missing operand in expression %q", p.s)
+	default:
+		return 0, p.errorf(start, "unexpected %q in expression %q", c, p.s)
+	}
+}
+
+// parseNumber parses a decimal, hexadecimal (0x) or binary (0b) number. Example: "100" -> 100, "0x4000" -> 16384, "0b101" -> 5
+func parseNumber(s string) (int, error) {
+	base, digits := 10, s
+	if len(s) > 2 && s[0] == '0' {
+		switch strings.ToLower(s[1:2]) {
+		case "x":
+			base, digits = 16, s[2:]
+		case "b":
+			base, digits = 2, s[2:]
+		}
+	}
+	v, err := strconv.ParseInt(digits, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return int(v), nil
+}
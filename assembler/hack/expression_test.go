@@ -0,0 +1,108 @@
+package hack
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEvalExpression(t *testing.T) {
+	st := NewSymbolTable()
+	st.table["LOOP"] = 10
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"100", 100},
+		{"0x4000", 16384},
+		{"0X1f", 31},
+		{"0b101", 5},
+		{"LOOP+3", 13},
+		{"SCREEN+32*2", 16448},
+		{"(LOOP+2)*2", 24},
+		{"LOOP-11", -1},
+		{"-(-3)", 3},
+		{"7/2+7%2", 4},
+		{"KBD-SCREEN", 8192},
+	}
+	for _, test := range tests {
+		got, err := evalExpression(test.input, st.resolve)
+		if err != nil || got != test.expected {
+			t.Errorf("evalExpression(%q) = %d, %v, want %d", test.input, got, err, test.expected)
+		}
+	}
+}
+
+func TestEvalExpressionErrors(t *testing.T) {
+	st := NewSymbolTable()
+	tests := []struct {
+		input  string
+		offset int
+	}{
+		{"", 0},
+		{"1+", 2},
+		{"0x", 0},
+		{"3+0b12", 2},
+		{"(1+2", 4},
+		{"1/0", 1},
+		{"1)", 1},
+		{"SCREEN#1", 6},
+		{"65536*65536*65536*65536", 5},
+		{"0x7FFFFFFF+1", 10},
+		{"-0x7FFFFFFF-2", 11},
+		{"1-(-0x7FFFFFFF-1)", 1},
+	}
+	for _, test := range tests {
+		_, err := evalExpression(test.input, st.resolve)
+		var e *exprError
+		if !errors.As(err, &e) || e.offset != test.offset {
+			t.Errorf("evalExpression(%q) = %v, want an error at offset %d", test.input, err, test.offset)
+		}
+	}
+}
+
+func TestHackExpressions(t *testing.T) {
+	asmCode := `@0x4000
+@0b101
+@row
+@SCREEN+32*2
+(END)
+@END+1
+`
+	expected := `0100000000000000
+0000000000000101
+0000000000010000
+0100000001000000
+0000000000000101
+`
+	hackFile := &bytes.Buffer{}
+	if err := Hack(strings.NewReader(asmCode), hackFile); err != nil {
+		t.Fatalf("Hack failed: %v", err)
+	}
+	if diff := cmp.Diff(expected, hackFile.String()); diff != "" {
+		t.Errorf("Hack mismatch (-want +got):\n%s", diff)
+	}
+
+	asmCode = `@SCREEN+0x4000
+@LOOP + 0x
+@1/0
+@65536*65536*65536*65536
+`
+	expectedDiags := Diagnostics{
+		{Pos: Position{"Prog.asm", 1, 2}, Message: `constant 32768 is out of range 0..32767`},
+		{Pos: Position{"Prog.asm", 2, 9}, Message: `invalid number "0x"`},
+		{Pos: Position{"Prog.asm", 3, 3}, Message: `division by zero in expression "1/0"`},
+		{Pos: Position{"Prog.asm", 4, 7}, Message: `expression "65536*65536*65536*65536" overflows`},
+	}
+	err := HackWithOptions(strings.NewReader(asmCode), &bytes.Buffer{}, Options{FileName: "Prog.asm"})
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("HackWithOptions returned %v, want Diagnostics", err)
+	}
+	if diff := cmp.Diff(expectedDiags, diags); diff != "" {
+		t.Errorf("HackWithOptions diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,306 @@
+package hack
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Format is an enum that represents a file format of Hack binary code.
+type Format int
+
+const (
+	FormatHack     Format = iota // 16-bit binary numbers written with "0" and "1", one per line. This is the default format of the assembler
+	FormatBinary                 // raw 16-bit big-endian words
+	FormatIntelHex               // Intel HEX records. Each word takes 2 bytes in big-endian order, so ROM[i] is at byte address 2*i
+	FormatReadmemb               // Verilog $readmemb memory image. One 16-bit binary number per line
+	FormatReadmemh               // Verilog $readmemh memory image. One 4-digit hexadecimal number per line
+	FormatLogisim                // Logisim "v2.0 raw" ROM image
+)
+
+// formatInfo is the name and the file extension of each format.
+var formatInfo = map[Format]struct{ name, ext string }{
+	FormatHack:     {"hack", ".hack"},
+	FormatBinary:   {"bin", ".bin"},
+	FormatIntelHex: {"ihex", ".hex"},
+	FormatReadmemb: {"memb", ".memb"},
+	FormatReadmemh: {"memh", ".memh"},
+	FormatLogisim:  {"logisim", ".rom"},
+}
+
+// String returns the name of the format. Example: FormatIntelHex -> "ihex"
+func (f Format) String() string {
+	if info, ok := formatInfo[f]; ok {
+		return info.name
+	}
+	return "Format(" + strconv.Itoa(int(f)) + ")"
+}
+
+// Ext returns the file extension of the format. Example: FormatIntelHex -> ".hex"
+func (f Format) Ext() string {
+	return formatInfo[f].ext
+}
+
+// ParseFormat returns the format with the given name. Example: "ihex" -> FormatIntelHex
+func ParseFormat(name string) (Format, error) {
+	for f, info := range formatInfo {
+		if info.name == name {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown format %q", name)
+}
+
+// FormatFromPath returns the format of the file from its extension. Example: "Prog.hex" -> FormatIntelHex
+func FormatFromPath(path string) (Format, error) {
+	ext := filepath.Ext(path)
+	for f, info := range formatInfo {
+		if info.ext == ext {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown file extension %q", ext)
+}
+
+// WriteWords writes the words of a program in the given format.
+func WriteWords(w io.Writer, words []uint16, f Format) error {
+	bw := bufio.NewWriter(w)
+	switch f {
+	case FormatHack, FormatReadmemb:
+		for _, word := range words {
+			fmt.Fprintf(bw, "%016b\n", word)
+		}
+	case FormatReadmemh:
+		for _, word := range words {
+			fmt.Fprintf(bw, "%04x\n", word)
+		}
+	case FormatBinary:
+		if err := binary.Write(bw, binary.BigEndian, words); err != nil {
+			return err
+		}
+	case FormatIntelHex:
+		writeIntelHex(bw, words)
+	case FormatLogisim:
+		writeLogisim(bw, words)
+	default:
+		return fmt.Errorf("unknown format %v", f)
+	}
+	return bw.Flush()
+}
+
+// ReadWords reads the words of a program in the given format.
+func ReadWords(r io.Reader, f Format) ([]uint16, error) {
+	switch f {
+	case FormatHack:
+		return readHack(r)
+	case FormatBinary:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return bytesToWords(data)
+	case FormatIntelHex:
+		return readIntelHex(r)
+	case FormatReadmemb:
+		return readReadmem(r, 2)
+	case FormatReadmemh:
+		return readReadmem(r, 16)
+	case FormatLogisim:
+		return readLogisim(r)
+	default:
+		return nil, fmt.Errorf("unknown format %v", f)
+	}
+}
+
+// readHack reads 16-bit binary numbers, one per line. Empty lines are ignored.
+func readHack(r io.Reader) ([]uint16, error) {
+	scanner := bufio.NewScanner(r)
+	var words []uint16
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) != 16 || strings.Trim(line, "01") != "" {
+			return nil, fmt.Errorf("line %d: invalid binary code %q", lineNum, line)
+		}
+		word, _ := strconv.ParseUint(line, 2, 16)
+		words = append(words, uint16(word))
+	}
+	return words, scanner.Err()
+}
+
+// writeIntelHex writes data records of 16 bytes and an end of file record.
+func writeIntelHex(w io.Writer, words []uint16) {
+	data := make([]byte, 2*len(words))
+	for i, word := range words {
+		binary.BigEndian.PutUint16(data[2*i:], word)
+	}
+	for addr := 0; addr < len(data); addr += 16 {
+		end := min(addr+16, len(data))
+		writeIntelHexRecord(w, addr, 0x00, data[addr:end])
+	}
+	writeIntelHexRecord(w, 0, 0x01, nil)
+}
+
+// writeIntelHexRecord writes a record in the form ":LLAAAATTDD...CC".
+func writeIntelHexRecord(w io.Writer, addr int, recordType byte, data []byte) {
+	record := []byte{byte(len(data)), byte(addr >> 8), byte(addr), recordType}
+	record = append(record, data...)
+	var sum byte
+	for _, b := range record {
+		sum += b
+	}
+	record = append(record, -sum)
+	fmt.Fprintf(w, ":%s\n", strings.ToUpper(hex.EncodeToString(record)))
+}
+
+// readIntelHex reads data records until the end of file record. Only 16-bit addresses are supported.
+func readIntelHex(r io.Reader) ([]uint16, error) {
+	scanner := bufio.NewScanner(r)
+	var data []byte
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		record, err := hex.DecodeString(strings.TrimPrefix(line, ":"))
+		if !strings.HasPrefix(line, ":") || err != nil || len(record) < 5 || len(record) != int(record[0])+5 {
+			return nil, fmt.Errorf("line %d: invalid Intel HEX record %q", lineNum, line)
+		}
+		var sum byte
+		for _, b := range record {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, fmt.Errorf("line %d: checksum mismatch", lineNum)
+		}
+		addr, recordType, payload := int(record[1])<<8|int(record[2]), record[3], record[4:len(record)-1]
+		switch recordType {
+		case 0x00:
+			if end := addr + len(payload); end > len(data) {
+				data = append(data, make([]byte, end-len(data))...)
+			}
+			copy(data[addr:], payload)
+		case 0x01:
+			return bytesToWords(data)
+		default:
+			return nil, fmt.Errorf("line %d: unsupported record type %02X", lineNum, recordType)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("missing end of file record")
+}
+
+// bytesToWords converts big-endian bytes to words.
+func bytesToWords(data []byte) ([]uint16, error) {
+	if len(data)%2 != 0 {
+		return nil, errors.New("data must have an even number of bytes")
+	}
+	words := make([]uint16, len(data)/2)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	return words, nil
+}
+
+// readReadmem reads a Verilog memory image with numbers in the given base. It supports "//" comments, "@addr" address directives in hexadecimal and "_" in numbers.
+func readReadmem(r io.Reader, base int) ([]uint16, error) {
+	scanner := bufio.NewScanner(r)
+	var words []uint16
+	addr := 0
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		code, _, _ := strings.Cut(scanner.Text(), "//")
+		for _, field := range strings.Fields(code) {
+			if a, ok := strings.CutPrefix(field, "@"); ok {
+				n, err := strconv.ParseUint(a, 16, 16)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid address %q", lineNum, field)
+				}
+				addr = int(n)
+				continue
+			}
+			n, err := strconv.ParseUint(strings.ReplaceAll(field, "_", ""), base, 16)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid value %q", lineNum, field)
+			}
+			if addr >= len(words) {
+				words = append(words, make([]uint16, addr+1-len(words))...)
+			}
+			words[addr] = uint16(n)
+			addr++
+		}
+	}
+	return words, scanner.Err()
+}
+
+// logisimHeader is the first line of a Logisim memory image.
+const logisimHeader = "v2.0 raw"
+
+// writeLogisim writes a Logisim memory image with 8 words per line. Runs of the same word are written as "count*value".
+func writeLogisim(w io.Writer, words []uint16) {
+	fmt.Fprintln(w, logisimHeader)
+	var fields []string
+	for i := 0; i < len(words); {
+		j := i
+		for j < len(words) && words[j] == words[i] {
+			j++
+		}
+		if n := j - i; n >= 4 {
+			fields = append(fields, fmt.Sprintf("%d*%x", n, words[i]))
+		} else {
+			for range n {
+				fields = append(fields, fmt.Sprintf("%x", words[i]))
+			}
+		}
+		i = j
+	}
+	for i := 0; i < len(fields); i += 8 {
+		fmt.Fprintln(w, strings.Join(fields[i:min(i+8, len(fields))], " "))
+	}
+}
+
+// readLogisim reads a Logisim memory image. It supports "#" comments and "count*value" runs. An image of more than romSize words is an error.
+func readLogisim(r io.Reader) ([]uint16, error) {
+	scanner := bufio.NewScanner(r)
+	var words []uint16
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		code, _, _ := strings.Cut(scanner.Text(), "#")
+		if lineNum == 1 {
+			if strings.TrimSpace(code) != logisimHeader {
+				return nil, fmt.Errorf("line 1: missing header %q", logisimHeader)
+			}
+			continue
+		}
+		for _, field := range strings.Fields(code) {
+			count, value := "1", field
+			if c, v, ok := strings.Cut(field, "*"); ok {
+				count, value = c, v
+			}
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("line %d: invalid count %q", lineNum, field)
+			}
+			word, err := strconv.ParseUint(value, 16, 16)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid value %q", lineNum, field)
+			}
+			// check the size before the run is expanded, so a huge count does not allocate memory
+			if len(words)+n > romSize {
+				return nil, fmt.Errorf("line %d: %q exceeds ROM size %d", lineNum, field, romSize)
+			}
+			for range n {
+				words = append(words, uint16(word))
+			}
+		}
+	}
+	return words, scanner.Err()
+}
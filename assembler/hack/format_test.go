@@ -0,0 +1,130 @@
+package hack
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteWords(t *testing.T) {
+	words := []uint16{0x0002, 0xEC10, 0x0003, 0xE090}
+	tests := []struct {
+		format   Format
+		expected string
+	}{
+		{FormatHack, "0000000000000010\n1110110000010000\n0000000000000011\n1110000010010000\n"},
+		{FormatBinary, "\x00\x02\xec\x10\x00\x03\xe0\x90"},
+		{FormatIntelHex, ":080000000002EC100003E09087\n:00000001FF\n"},
+		{FormatReadmemb, "0000000000000010\n1110110000010000\n0000000000000011\n1110000010010000\n"},
+		{FormatReadmemh, "0002\nec10\n0003\ne090\n"},
+		{FormatLogisim, "v2.0 raw\n2 ec10 3 e090\n"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		if err := WriteWords(buf, words, test.format); err != nil {
+			t.Fatalf("WriteWords(%v) failed: %v", test.format, err)
+		}
+		if buf.String() != test.expected {
+			t.Errorf("WriteWords(%v) = %q, want %q", test.format, buf.String(), test.expected)
+		}
+	}
+}
+
+func TestReadWordsRoundTrip(t *testing.T) {
+	// 40 words with a long run of zeros to exercise Intel HEX records and Logisim runs
+	words := make([]uint16, 40)
+	words[0], words[1], words[38], words[39] = 0x7FFF, 0xFC10, 0x1234, 0xE987
+	for f := range formatInfo {
+		buf := &bytes.Buffer{}
+		if err := WriteWords(buf, words, f); err != nil {
+			t.Fatalf("WriteWords(%v) failed: %v", f, err)
+		}
+		got, err := ReadWords(buf, f)
+		if err != nil {
+			t.Fatalf("ReadWords(%v) failed: %v", f, err)
+		}
+		if !slices.Equal(got, words) {
+			t.Errorf("ReadWords(%v) = %v, want %v", f, got, words)
+		}
+	}
+}
+
+func TestReadWords(t *testing.T) {
+	tests := []struct {
+		format   Format
+		input    string
+		expected []uint16
+	}{
+		{FormatReadmemh, "// image\n@2 ab_cd\n1 // one\n", []uint16{0, 0, 0xABCD, 1}},
+		{FormatReadmemb, "0000_0000_0000_0101\n", []uint16{5}},
+		{FormatLogisim, "v2.0 raw\n# comment\n3*a b\n", []uint16{10, 10, 10, 11}},
+		{FormatIntelHex, ":020002001234B6\n:00000001FF\n", []uint16{0, 0x1234}},
+	}
+	for _, test := range tests {
+		got, err := ReadWords(strings.NewReader(test.input), test.format)
+		if err != nil {
+			t.Fatalf("ReadWords(%v, %q) failed: %v", test.format, test.input, err)
+		}
+		if !slices.Equal(got, test.expected) {
+			t.Errorf("ReadWords(%v, %q) = %v, want %v", test.format, test.input, got, test.expected)
+		}
+	}
+}
+
+func TestReadWordsErrors(t *testing.T) {
+	tests := []struct {
+		format Format
+		input  string
+	}{
+		{FormatHack, "0101\n"},
+		{FormatBinary, "\x00"},
+		{FormatIntelHex, ":0200000012349B\n:00000001FF\n"}, // checksum mismatch
+		{FormatIntelHex, ":020000001234"},                  // invalid record
+		{FormatIntelHex, ":020000001234B8\n"},              // missing end of file record
+		{FormatReadmemh, "12345\n"},                        // more than 16 bits
+		{FormatLogisim, "0 1 2\n"},                         // missing header
+		{FormatLogisim, "v2.0 raw\n99999999*0\n"},          // a run larger than ROM
+		{FormatLogisim, "v2.0 raw\n32767*0 1 2\n"},         // more words than ROM
+	}
+	for _, test := range tests {
+		if _, err := ReadWords(strings.NewReader(test.input), test.format); err == nil {
+			t.Errorf("ReadWords(%v, %q) expected an error", test.format, test.input)
+		}
+	}
+}
+
+func TestFormatNames(t *testing.T) {
+	for f, info := range formatInfo {
+		if got, err := ParseFormat(info.name); err != nil || got != f {
+			t.Errorf("ParseFormat(%q) = %v, %v, want %v", info.name, got, err, f)
+		}
+		if got, err := FormatFromPath("Prog" + info.ext); err != nil || got != f {
+			t.Errorf("FormatFromPath(%q) = %v, %v, want %v", "Prog"+info.ext, got, err, f)
+		}
+	}
+	if _, err := ParseFormat("elf"); err == nil {
+		t.Errorf("ParseFormat(%q) expected an error", "elf")
+	}
+}
+
+func TestHackFormat(t *testing.T) {
+	hackFile := &bytes.Buffer{}
+	err := HackWithOptions(strings.NewReader("@2\nD=A\n"), hackFile, Options{Format: FormatReadmemh})
+	if err != nil {
+		t.Fatalf("HackWithOptions failed: %v", err)
+	}
+	if expected := "0002\nec10\n"; hackFile.String() != expected {
+		t.Errorf("HackWithOptions = %q, want %q", hackFile.String(), expected)
+	}
+
+	// the disassembler reads other formats
+	asmFile := &bytes.Buffer{}
+	err = Disassemble(strings.NewReader(hackFile.String()), asmFile, DisassembleOptions{Format: FormatReadmemh})
+	if err != nil {
+		t.Fatalf("Disassemble failed: %v", err)
+	}
+	if expected := "@2\nD=A\n"; asmFile.String() != expected {
+		t.Errorf("Disassemble = %q, want %q", asmFile.String(), expected)
+	}
+}
@@ -0,0 +1,176 @@
+package hack
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+)
+
+/*
+formatter.go prints a Program in the standard style.
+
+  - Labels and lines that start with "#" are not indented. Instructions and macro calls are indented.
+  - A comment line is indented like the line after it. Comments followed by an empty line are not indented.
+  - C instructions have no spaces and the standard spelling. Example: "DM = M + 1" -> "MD=M+1", "D=A+D" -> "D=D+A"
+  - Trailing comments of consecutive lines are aligned.
+  - Consecutive empty lines are merged into one, and empty lines at the beginning and the end of the file are removed.
+
+	    // sum = 0
+	    @sum
+	    M=0
+	(LOOP)
+	    @i  // the counter
+	    D=M // D = i
+*/
+
+// FormatterOptions is a struct that controls the style of the formatter.
+type FormatterOptions struct {
+	Indent string // the indentation of instructions. The default is 4 spaces
+}
+
+// formattedLine is a struct that represents a line of the formatted program before the trailing comments are aligned.
+type formattedLine struct {
+	code    string
+	comment string // the trailing comment. It is empty if the line has none
+}
+
+// FormatProgram writes the program in the standard style.
+func FormatProgram(w io.Writer, prog *Program, opts FormatterOptions) error {
+	indent := opts.Indent
+	if indent == "" {
+		indent = "    "
+	}
+
+	// remove empty lines at the beginning and the end, and merge consecutive empty lines
+	nodes := prog.Nodes
+	for len(nodes) > 0 && isBlank(nodes[0]) {
+		nodes = nodes[1:]
+	}
+	for len(nodes) > 0 && isBlank(nodes[len(nodes)-1]) {
+		nodes = nodes[:len(nodes)-1]
+	}
+
+	var lines []formattedLine
+	for i, n := range nodes {
+		if isBlank(n) && i > 0 && isBlank(nodes[i-1]) {
+			continue
+		}
+		switch n := n.(type) {
+		case *Blank:
+			lines = append(lines, formattedLine{})
+		case *Comment:
+			prefix := ""
+			if next := nextCode(nodes[i+1:]); next != nil && isIndented(next) {
+				prefix = indent
+			}
+			lines = append(lines, formattedLine{code: prefix + n.String()})
+		default:
+			code := normalize(n).String()
+			if isIndented(n) {
+				code = indent + code
+			}
+			lines = append(lines, formattedLine{code: code, comment: trailingComment(n)})
+		}
+	}
+
+	// align the trailing comments of consecutive lines
+	for start := 0; start < len(lines); {
+		if lines[start].comment == "" {
+			start++
+			continue
+		}
+		end, width := start, 0
+		for ; end < len(lines) && lines[end].comment != ""; end++ {
+			width = max(width, len(lines[end].code))
+		}
+		for i := start; i < end; i++ {
+			lines[i].code += strings.Repeat(" ", width-len(lines[i].code)) + " //" + lines[i].comment
+		}
+		start = end
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, l := range lines {
+		bw.WriteString(l.code + "\n")
+	}
+	return bw.Flush()
+}
+
+// FormatSource formats an assembly file and returns the formatted file.
+func FormatSource(asmFile io.Reader, fileName string, opts FormatterOptions) ([]byte, error) {
+	prog, err := ParseProgram(asmFile, fileName)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := FormatProgram(&buf, prog, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FormatFile formats the assembly file in place. It returns true if the file was not formatted. If check is true, the file is not written. This is the check mode for CI.
+func FormatFile(fileName string, opts FormatterOptions, check bool) (bool, error) {
+	src, err := os.ReadFile(fileName)
+	if err != nil {
+		return false, err
+	}
+	formatted, err := FormatSource(bytes.NewReader(src), fileName, opts)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(src, formatted) {
+		return false, nil
+	}
+	if !check {
+		if err := os.WriteFile(fileName, formatted, 0o644); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// normalize returns the node with the standard spelling of C instructions. Invalid mnemonics are kept as they are.
+func normalize(n Node) Node {
+	c, ok := n.(*CInstruction)
+	if !ok {
+		return n
+	}
+	normalized := *c
+	normalized.Dest = canonicalDest(c.Dest)
+	normalized.Comp = canonicalComp(c.Comp)
+	return &normalized
+}
+
+// isIndented returns true if the node is indented: an instruction or a macro call.
+func isIndented(n Node) bool {
+	switch n := n.(type) {
+	case *Label:
+		return false
+	case *Directive:
+		return !strings.HasPrefix(n.Text, "#")
+	}
+	return true
+}
+
+// isBlank returns true if the node is an empty line.
+func isBlank(n Node) bool {
+	_, ok := n.(*Blank)
+	return ok
+}
+
+// nextCode returns the first node in rest that is not a comment, or nil if an empty line or the end of the file comes first.
+func nextCode(rest []Node) Node {
+	for _, n := range rest {
+		switch n.(type) {
+		case *Comment:
+			continue
+		case *Blank:
+			return nil
+		}
+		return n
+	}
+	return nil
+}
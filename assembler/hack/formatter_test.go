@@ -0,0 +1,121 @@
+package hack
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormatSource(t *testing.T) {
+	asmCode := `
+
+// sum = 0
+@sum
+  M = 0
+
+
+(LOOP)
+   // D = i
+	@i  // the counter
+DM=M+1 // i++
+D = A+D;JGT
+#macro INC x
+@%x
+MA=1+M
+#endmacro
+INC R1 // call
+X=Y
+.string url "a//b"  // link
+`
+	expected := `    // sum = 0
+    @sum
+    M=0
+
+(LOOP)
+    // D = i
+    @i     // the counter
+    MD=M+1 // i++
+    D=D+A;JGT
+#macro INC x
+    @%x
+    AM=M+1
+#endmacro
+    INC R1 // call
+    X=Y
+    .string url "a//b" // link
+`
+	got, err := FormatSource(strings.NewReader(asmCode), "Prog.asm", FormatterOptions{})
+	if err != nil {
+		t.Fatalf("FormatSource failed: %v", err)
+	}
+	if diff := cmp.Diff(expected, string(got)); diff != "" {
+		t.Errorf("FormatSource mismatch (-want +got):\n%s", diff)
+	}
+
+	// formatting is idempotent
+	again, err := FormatSource(bytes.NewReader(got), "Prog.asm", FormatterOptions{})
+	if err != nil {
+		t.Fatalf("FormatSource failed: %v", err)
+	}
+	if diff := cmp.Diff(string(got), string(again)); diff != "" {
+		t.Errorf("FormatSource is not idempotent (-want +got):\n%s", diff)
+	}
+
+	got, err = FormatSource(strings.NewReader("(L)\n@L\n"), "Prog.asm", FormatterOptions{Indent: "\t"})
+	if err != nil {
+		t.Fatalf("FormatSource failed: %v", err)
+	}
+	if expected := "(L)\n\t@L\n"; string(got) != expected {
+		t.Errorf("FormatSource = %q, want %q", got, expected)
+	}
+}
+
+func TestFormatKeepsBinaryCode(t *testing.T) {
+	for _, fileName := range []string{"../asm_files/rect/Rect.asm", "../asm_files/max/Max.asm", "../asm_files/Prog.asm"} {
+		src, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		formatted, err := FormatSource(bytes.NewReader(src), fileName, FormatterOptions{})
+		if err != nil {
+			t.Fatalf("FormatSource(%s) failed: %v", fileName, err)
+		}
+		expected, actual := &bytes.Buffer{}, &bytes.Buffer{}
+		if err := Hack(bytes.NewReader(src), expected); err != nil {
+			t.Fatalf("Hack(%s) failed: %v", fileName, err)
+		}
+		if err := Hack(bytes.NewReader(formatted), actual); err != nil {
+			t.Fatalf("Hack(formatted %s) failed: %v", fileName, err)
+		}
+		if expected.String() != actual.String() {
+			t.Errorf("%s: the formatted program assembles differently", fileName)
+		}
+	}
+}
+
+func TestFormatFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "Prog.asm")
+	if err := os.WriteFile(fileName, []byte("@2\nD = A\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := FormatFile(fileName, FormatterOptions{}, true)
+	if err != nil || !changed {
+		t.Fatalf("FormatFile(check) = %v, %v, want true", changed, err)
+	}
+	if src, _ := os.ReadFile(fileName); string(src) != "@2\nD = A\n" {
+		t.Errorf("FormatFile(check) wrote %q", src)
+	}
+	if changed, err := FormatFile(fileName, FormatterOptions{}, false); err != nil || !changed {
+		t.Fatalf("FormatFile = %v, %v, want true", changed, err)
+	}
+	if src, _ := os.ReadFile(fileName); string(src) != "    @2\n    D=A\n" {
+		t.Errorf("FormatFile wrote %q", src)
+	}
+	if changed, err := FormatFile(fileName, FormatterOptions{}, true); err != nil || changed {
+		t.Errorf("FormatFile(check) = %v, %v, want false for a formatted file", changed, err)
+	}
+}
@@ -8,31 +8,154 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/progress"
 )
 
+// Options is a struct that controls how the assembler converts an assembly language file.
+type Options struct {
+	FileName   string            // the name of the assembly file used in diagnostics. Example: "Prog.asm"
+	MacroFiles []string          // files whose macro definitions are available in the assembly file
+	Defines    map[string]string // names defined before the assembly file is read, like #define. An empty value only defines the name. Example: {"DEBUG": ""}
+	Format     Format            // the format of the binary code file. The default is FormatHack
+	Listing    io.Writer         // if not nil, a listing of addresses, binary code, source lines and symbol values is written to it
+	SourceMap  io.Writer         // if not nil, a JSON source map from ROM addresses to source lines is written to it
+	Symbols    io.Writer         // if not nil, the final symbol table is written to it in the .sym format
+	Optimize   bool              // if true, the peephole optimizer removes redundant instructions before assembling
+	Stream     bool              // if true, the file is read once by the single-pass assembler. Listing, SourceMap and Optimize are not supported
+	ISA        *ISA              // the instruction set of the C instructions. The default is the standard Hack instruction set
+	Progress   progress.Reporter // receives the progress events of HackWithOptions and HackFromFileWithOptions. The default prints the messages to stdout. progress.Discard prints nothing
+
+	VariableLimit int // if positive, a variable above this RAM address is reported as a warning. Example: 255 keeps variables below the VM stack
+}
+
+// Result is a struct that represents an assembled program: the binary code and the final symbol table with the labels and the variables.
+type Result struct {
+	Words       []uint16       // the binary code of the instructions
+	SymbolTable SymbolTable    // the symbol table after the second pass
+	Optimized   OptimizeReport // the number of instructions before and after the optimization if Options.Optimize is true
+	Data        DataReport     // the RAM reserved by data directives and the size of its initialization code
+	Warnings    Diagnostics    // the warnings about the capacity of RAM sorted by position
+	lines       []assembledLine
+}
+
+// SourceMap returns the source map of the program.
+func (r Result) SourceMap() SourceMap {
+	return newSourceMap(r.lines)
+}
+
 // Hack converts an assembly language file to a binary code file. The file name is passed as a command line argument. The output file has the same name as the input file but with a .hack extension.
 func Hack(asmFile io.Reader, hackFile io.Writer) error {
-	var buf bytes.Buffer
-	tee := io.TeeReader(asmFile, &buf)
-	// first pass looks for only L instructions and add them to the symbol table
+	return HackWithOptions(asmFile, hackFile, Options{})
+}
 
-	symbolTable, err := firstPass(tee)
+// HackWithOptions converts an assembly language file to a binary code file with the given options. If the assembly file has problems, it returns [Diagnostics] that lists all of them with their positions and writes nothing to hackFile. The reports, the warnings and "done" are reported to opts.Progress.
+func HackWithOptions(asmFile io.Reader, hackFile io.Writer, opts Options) error {
+	r := progress.OrStdout(opts.Progress)
+	start := time.Now()
+	r.Report(progress.Event{Kind: progress.FileStarted, Tool: progress.ToolAssembler, File: opts.FileName})
+	result, err := AssembleTo(asmFile, hackFile, opts)
 	if err != nil {
 		return err
 	}
+	if opts.Optimize {
+		r.Report(progress.Event{Kind: progress.Report, Tool: progress.ToolAssembler, Message: fmt.Sprint(result.Optimized)})
+	}
+	if result.Data.Words > 0 {
+		r.Report(progress.Event{Kind: progress.Report, Tool: progress.ToolAssembler, Message: fmt.Sprint(result.Data)})
+	}
+	for _, w := range result.Warnings {
+		r.Report(progress.Event{Kind: progress.Warning, Tool: progress.ToolAssembler, File: opts.FileName, Message: w.Error()})
+	}
+	elapsed := time.Since(start)
+	r.Report(progress.Event{Kind: progress.FileFinished, Tool: progress.ToolAssembler, File: opts.FileName, Count: len(result.Words), Elapsed: elapsed})
+	r.Report(progress.Event{Kind: progress.Finished, Tool: progress.ToolAssembler, Elapsed: elapsed, Message: "done"})
+	return nil
+}
 
-	// second pass looks for A and C instructions and convert them to binary code
-	// reset the asmFile reader to the beginning
-	err = secondPass(&buf, hackFile, symbolTable)
+// AssembleTo converts an assembly language file to a binary code file like [HackWithOptions], but reports nothing. The reports and the warnings are returned in the result.
+func AssembleTo(asmFile io.Reader, hackFile io.Writer, opts Options) (Result, error) {
+	assemble := Assemble
+	if opts.Stream {
+		if opts.Listing != nil || opts.SourceMap != nil {
+			return Result{}, errors.New("listings and source maps cannot be written in a single pass")
+		}
+		assemble = AssembleStream
+	}
+	result, err := assemble(asmFile, opts)
 	if err != nil {
-		return err
+		return Result{}, err
 	}
-	fmt.Println("done")
-	return nil
+	if err := WriteWords(hackFile, result.Words, opts.Format); err != nil {
+		return Result{}, err
+	}
+	if opts.Listing != nil {
+		if err := writeListing(opts.Listing, result.lines); err != nil {
+			return Result{}, err
+		}
+	}
+	if opts.SourceMap != nil {
+		if err := WriteSourceMap(opts.SourceMap, result.SourceMap()); err != nil {
+			return Result{}, err
+		}
+	}
+	if opts.Symbols != nil {
+		if err := WriteSymbols(opts.Symbols, result.SymbolTable.Symbols()); err != nil {
+			return Result{}, err
+		}
+	}
+	return result, nil
+}
+
+// Assemble converts an assembly language file to binary code without writing it. The result keeps the final symbol table. If the assembly file has problems, it returns [Diagnostics] that lists all of them with their positions. opts.Format and the writers in opts are not used.
+func Assemble(asmFile io.Reader, opts Options) (Result, error) {
+	// expand macros and remove disabled blocks before the label pass
+	buf, origins, data, diags := preprocess(asmFile, opts)
+	var report OptimizeReport
+	if opts.Optimize && len(diags) == 0 {
+		buf, origins, report = optimize(buf, origins)
+	}
+
+	// first pass looks for only L instructions and add them to the symbol table
+	symbolTable, firstDiags := firstPass(bytes.NewReader(buf), origins, data)
+	diags = append(diags, firstDiags...)
+
+	// second pass looks for A and C instructions and convert them to binary code
+	lines, secondDiags := secondPass(bytes.NewReader(buf), &symbolTable, origins, opts)
+	diags = append(diags, secondDiags...)
+	if err := diags.Err(); err != nil {
+		return Result{}, err
+	}
+	diags.sort()
+	return Result{Words: words(lines), SymbolTable: symbolTable, Optimized: report, Data: newDataReport(data), Warnings: diags, lines: lines}, nil
+}
+
+// preprocess expands the directives of the assembly file. It returns the expanded program with the initialization code of the data at the beginning, the origin of each line and the data blocks.
+func preprocess(asmFile io.Reader, opts Options) ([]byte, []lineOrigin, []dataBlock, Diagnostics) {
+	var buf bytes.Buffer
+	pp := newPreprocessor(&buf)
+	pp.configure(opts)
+	pp.process(asmFile, opts.FileName)
+	var init bytes.Buffer
+	var origins []lineOrigin
+	for _, l := range pp.dataInit() {
+		init.WriteString(l.text + "\n")
+		origins = append(origins, l.origin)
+	}
+	init.Write(buf.Bytes())
+	return init.Bytes(), append(origins, pp.origins...), pp.data, pp.diags
 }
 
 func HackFromFile(fileName string) error {
-	fmt.Println("Hack")
+	return HackFromFileWithOptions(fileName, Options{})
+}
+
+// HackFromFileWithOptions converts an assembly language file to a binary code file with the given options. The output file has the same name as the input file but with the extension of opts.Format. opts.FileName is set to fileName.
+func HackFromFileWithOptions(fileName string, opts Options) error {
+	progress.OrStdout(opts.Progress).Report(progress.Event{Kind: progress.Started, Tool: progress.ToolAssembler, Message: "Hack"})
 	if fileName[len(fileName)-4:] != ".asm" {
 		return errors.New("invalid file extension")
 	}
@@ -42,93 +165,177 @@ func HackFromFile(fileName string) error {
 	}
 	defer asmFile.Close()
 
-	// create a new file with the same name as the input file but with .hack extension
-	hackFile, err := os.Create(fileName[:len(fileName)-4] + ".hack")
+	// create a new file with the same name as the input file but with the extension of the format. Example: .hack
+	hackFile, err := os.Create(fileName[:len(fileName)-4] + opts.Format.Ext())
 	if err != nil {
 		return err
 	}
 
 	defer hackFile.Close()
-	return Hack(asmFile, hackFile)
+	opts.FileName = fileName
+	return HackWithOptions(asmFile, hackFile, opts)
 }
 
-// firstPass looks for L instructions and add them to the symbol table.
-func firstPass(asmFile io.Reader) (SymbolTable, error) {
-	fmt.Println("first pass")
+// firstPass reserves the RAM of the data blocks, and looks for L instructions and add them to the symbol table. It reports invalid and duplicate labels and a program that does not fit in ROM.
+func firstPass(asmFile io.Reader, origins []lineOrigin, data []dataBlock) (SymbolTable, Diagnostics) {
 	p := NewParser(bufio.NewScanner(asmFile))
+	p.origins = origins
 	symbolTable := NewSymbolTable()
+	var diags Diagnostics
+	bindData(&symbolTable, data, &diags)
+	// labelPos keeps the position of each label to report duplicates
+	labelPos := map[SymbolOrConstant]Position{}
+	var overflow romOverflow
 
 	// first pass: build symbol table and add labels to it
-	for count := 0; p.advance(); {
+	count := 0
+	for p.advance() {
 		if p.currentType == L_Instruction {
 			labelSymbol, err := p.symbol()
 			if err != nil {
-				return SymbolTable{}, err
+				p.errorf(&diags, 0, "%v", err)
+				continue
+			}
+			if !isValidSymbol(labelSymbol) {
+				p.errorf(&diags, 1, "invalid label %q", labelSymbol)
+				continue
 			}
 			// add label to the symbol table
-			symbolTable.addLabel(labelSymbol, count)
+			if err := symbolTable.addLabel(labelSymbol, count); err != nil {
+				if prev, ok := labelPos[labelSymbol]; ok {
+					p.errorf(&diags, 1, "%v at %v", err, prev)
+				} else {
+					p.errorf(&diags, 1, "%v", err)
+				}
+				continue
+			}
+			labelPos[labelSymbol] = p.pos(1)
 		} else if p.currentType == A_Instruction || p.currentType == C_Instruction {
+			overflow.check(p, count)
 			count++
 		} else {
-			return SymbolTable{}, errors.New("invalid instruction type")
+			p.errorf(&diags, 0, "invalid instruction type")
 		}
 	}
-	return symbolTable, nil
+	overflow.report(&diags, count)
+	return symbolTable, diags
 }
 
-// secondPass looks for A and C instructions and convert them to binary code.
-func secondPass(asmFile io.Reader, hackFile io.Writer, symbolTable SymbolTable) error {
-	fmt.Println("second pass")
-	p := Parser{scanner: bufio.NewScanner(asmFile)}
+// assembledLine is a struct that represents a line of the program after the second pass: an instruction converted to binary code or a label.
+type assembledLine struct {
+	address int              // the ROM address of the instruction or the label
+	code    BinaryCode       // the 16-bit binary code. It is empty for labels
+	text    string           // the source line without surrounding spaces
+	origin  lineOrigin       // where the source line comes from
+	symbol  SymbolOrConstant // the symbol of an A instruction or a label. It is empty for constants and C instructions
+	value   int              // the value of the symbol
+}
+
+// words returns the binary code of the instructions as words.
+func words(lines []assembledLine) []uint16 {
+	var ws []uint16
+	for _, l := range lines {
+		if l.code != "" {
+			ws = append(ws, l.code.word())
+		}
+	}
+	return ws
+}
+
+// secondPass looks for A and C instructions and convert them to binary code. New variables are added to the symbol table. It reports every invalid instruction and keeps going, and warns about variables above opts.VariableLimit or in the memory map.
+func secondPass(asmFile io.Reader, symbolTable *SymbolTable, origins []lineOrigin, opts Options) ([]assembledLine, Diagnostics) {
+	p := Parser{scanner: bufio.NewScanner(asmFile), origins: origins, isa: opts.ISA}
+	var diags Diagnostics
+	var lines []assembledLine
+	address := 0
 	// second pass
 	for p.advance() {
+		line := assembledLine{address: address, text: strings.TrimSpace(p.scanner.Text()), origin: p.origin()}
 		instType := p.currentType
 		switch instType {
 		case A_Instruction:
 			symOrConst, err := p.symbol()
 			if err != nil {
-				return err
+				p.errorf(&diags, 0, "%v", err)
+				continue
 			}
-			symbolCode, err := symbol(symOrConst, &symbolTable)
+			variableCount := symbolTable.variableCount
+			symbolCode, err := symbol(symOrConst, symbolTable)
 			if err != nil {
-				return err
+				// point at the part of the expression that has the problem
+				offset := 1
+				if e, ok := err.(*exprError); ok {
+					offset += e.offset
+				}
+				p.errorf(&diags, offset, "%v", err)
+				continue
 			}
-			code := "0" + string(symbolCode)
-			_, err = io.WriteString(hackFile, code+"\n")
-			if err != nil {
-				return err
+			p.checkVariables(&diags, symbolTable, symOrConst, variableCount, opts.VariableLimit)
+			line.code = "0" + symbolCode
+			if !isConst(symOrConst) {
+				value, _ := strconv.ParseInt(string(symbolCode), 2, 16)
+				line.symbol, line.value = symOrConst, int(value)
 			}
 		case C_Instruction:
-			destMnemonic, err := p.dest()
-			if err != nil {
-				return err
-			}
-			compMnemonic, err := p.comp()
-			if err != nil {
-				return err
-			}
-			jumpMnemonic, err := p.jump()
-			if err != nil {
-				return err
-			}
-			destCode, err := dest(destMnemonic)
-			if err != nil {
-				return err
-			}
-			compCode, err := comp(compMnemonic)
-			if err != nil {
-				return err
-			}
-			jumpCode, err := jump(jumpMnemonic)
-			if err != nil {
-				return err
-			}
-			code := "111" + string(compCode) + string(destCode) + string(jumpCode)
-			_, err = io.WriteString(hackFile, code+"\n")
-			if err != nil {
-				return err
+			code, ok := p.cInstructionCode(&diags)
+			if !ok {
+				continue
 			}
+			line.code = BinaryCode(code)
+		case L_Instruction:
+			label, _ := p.symbol()
+			line.symbol, line.value = label, address
+			lines = append(lines, line)
+			continue
 		}
+		lines = append(lines, line)
+		address++
 	}
-	return nil
+	return lines, diags
+}
+
+// cInstructionCode converts the current C instruction to binary code. It reports every invalid mnemonic to diags and returns false if there is any.
+func (p *Parser) cInstructionCode(diags *Diagnostics) (string, bool) {
+	destMnemonic, err := p.dest()
+	if err != nil {
+		p.errorf(diags, 0, "%v", err)
+		return "", false
+	}
+	compMnemonic, err := p.comp()
+	if err != nil {
+		p.errorf(diags, 0, "%v", err)
+		return "", false
+	}
+	jumpMnemonic, err := p.jump()
+	if err != nil {
+		p.errorf(diags, 0, "%v", err)
+		return "", false
+	}
+	// offsets of the mnemonics in the instruction
+	inst := string(p.currentInstruction)
+	compOffset, jumpOffset := 0, len(inst)
+	if i := strings.Index(inst, "="); i != -1 {
+		compOffset = i + 1
+	}
+	if i := strings.Index(inst, ";"); i != -1 {
+		jumpOffset = i + 1
+	}
+
+	ok := true
+	destCode, err := p.isa.dest(destMnemonic)
+	if err != nil {
+		p.errorf(diags, 0, "%v", err)
+		ok = false
+	}
+	compCode, err := p.isa.comp(compMnemonic)
+	if err != nil {
+		p.errorf(diags, compOffset, "%v", err)
+		ok = false
+	}
+	jumpCode, err := p.isa.jump(jumpMnemonic)
+	if err != nil {
+		p.errorf(diags, jumpOffset, "%v", err)
+		ok = false
+	}
+	return fmt.Sprintf("%016b", compCode<<6|destCode<<3|jumpCode), ok
 }
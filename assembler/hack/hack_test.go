@@ -2,8 +2,12 @@ package hack
 
 import (
 	"bytes"
+	"errors"
 	"strings"
 	"testing"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/progress"
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestHack(t *testing.T) {
@@ -135,3 +139,78 @@ func testHack(t *testing.T, asmCode, expected string) {
 		t.Errorf("Expected %s, got %s", expected, hackFile.String())
 	}
 }
+
+func TestHackDiagnostics(t *testing.T) {
+	asmCode := `@1
+X=A
+(LOOP)
+D=D+X;JMP
+@40000
+(LOOP)
+  D = M ; JXX
+(R0)
+@-1
+@1abc
+0;JMP
+`
+	expected := Diagnostics{
+		{Pos: Position{"Prog.asm", 2, 1}, Message: `invalid dest mnemonic "X"`},
+		{Pos: Position{"Prog.asm", 4, 3}, Message: `invalid comp mnemonic "D+X"`},
+		{Pos: Position{"Prog.asm", 5, 2}, Message: `constant 40000 is out of range 0..32767`},
+		{Pos: Position{"Prog.asm", 6, 2}, Message: `label LOOP is already defined at Prog.asm:3:2`},
+		{Pos: Position{"Prog.asm", 7, 11}, Message: `invalid jump mnemonic "JXX"`},
+		{Pos: Position{"Prog.asm", 8, 2}, Message: `label R0 conflicts with the predefined symbol`},
+		{Pos: Position{"Prog.asm", 9, 2}, Message: `constant -1 is out of range 0..32767`},
+		{Pos: Position{"Prog.asm", 10, 2}, Message: `invalid number "1abc"`},
+	}
+	hackFile := &bytes.Buffer{}
+	err := HackWithOptions(strings.NewReader(asmCode), hackFile, Options{FileName: "Prog.asm"})
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("HackWithOptions returned %v, want Diagnostics", err)
+	}
+	if diff := cmp.Diff(expected, diags); diff != "" {
+		t.Errorf("HackWithOptions diagnostics mismatch (-want +got):\n%s", diff)
+	}
+	if hackFile.Len() != 0 {
+		t.Errorf("HackWithOptions wrote %q, want nothing", hackFile.String())
+	}
+}
+
+// TestHackOneCharacterLines tests that lines shorter than a comment prefix are assembled or reported, in both passes.
+func TestHackOneCharacterLines(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		var hackFile bytes.Buffer
+		if err := HackWithOptions(strings.NewReader("D\n0\n"), &hackFile, Options{Stream: stream}); err != nil {
+			t.Fatalf("HackWithOptions with Stream %v failed: %v", stream, err)
+		}
+		if want := "1110001100000000\n1110101010000000\n"; hackFile.String() != want {
+			t.Errorf("HackWithOptions with Stream %v wrote %q, want %q", stream, hackFile.String(), want)
+		}
+		err := HackWithOptions(strings.NewReader("@\n"), &bytes.Buffer{}, Options{FileName: "Prog.asm", Stream: stream})
+		var diags Diagnostics
+		if !errors.As(err, &diags) || diags[0].Pos.Line != 1 {
+			t.Errorf("HackWithOptions(\"@\") with Stream %v returned %v, want a diagnostic at line 1", stream, err)
+		}
+	}
+}
+
+// TestHackProgress tests that HackWithOptions reports its steps to opts.Progress instead of printing them.
+func TestHackProgress(t *testing.T) {
+	var events []progress.Event
+	opts := Options{FileName: "Prog.asm", Progress: progress.Func(func(e progress.Event) {
+		e.Elapsed = 0
+		events = append(events, e)
+	})}
+	if err := HackWithOptions(strings.NewReader("@R0\nM=1\n(END)\n@END\n0;JMP\n"), &bytes.Buffer{}, opts); err != nil {
+		t.Fatalf("HackWithOptions failed: %v", err)
+	}
+	expected := []progress.Event{
+		{Kind: progress.FileStarted, Tool: progress.ToolAssembler, File: "Prog.asm"},
+		{Kind: progress.FileFinished, Tool: progress.ToolAssembler, File: "Prog.asm", Count: 4},
+		{Kind: progress.Finished, Tool: progress.ToolAssembler, Message: "done"},
+	}
+	if diff := cmp.Diff(expected, events); diff != "" {
+		t.Errorf("HackWithOptions events mismatch (-want +got):\n%s", diff)
+	}
+}
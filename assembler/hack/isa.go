@@ -0,0 +1,508 @@
+package hack
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+isa.go is the instruction set of the Hack CPU as a table. The assembler, the disassembler and the emulator read the encodings of C instructions from the same table, so an extended CPU is supported by adding entries.
+
+A C instruction has three fields. The comp field is the 10 bits 15..6: 3 prefix bits (111 in the standard Hack), the a bit and the 6 control bits of the ALU. The dest field is the 3 bits 5..3 that select A, D and M. The jump field is the 3 bits 2..0 that select the conditions out<0, out=0 and out>0. The meaning of the dest and jump bits and of the a bit (M is read only if it is 1) is the same in every instruction set. The output of comp is given by an expression or, for the prefix 111, by the ALU.
+
+An instruction set is registered in Go with [RegisterISA] or loaded from a text file with [LoadISA]. The built-in sets are "hack" and "hack-shift", which adds the shift operations of the extended Hack CPU. The file format has one entry per line, and "//" starts a comment.
+
+	name    my-hack             // the name of the instruction set
+	extends hack                // copy the entries of a registered instruction set
+	comp    D<<   1010110000  D<<1
+	comp    D+A   1110000010    // no expression: computed by the ALU
+	dest    DA    110
+	jump    JMP   111
+
+An expression is written without spaces with D, A, M, decimal numbers, parentheses and the operators | & << >> + - (binary) and - ! (unary), from the lowest precedence to the highest. >> is an arithmetic shift.
+*/
+
+// CompOp is a struct that represents a comp mnemonic of an instruction set. Code is the comp field: the bits 15..6 of the C instruction. Eval returns the output of the operation. Example: {"D+1", 0b1110011111, func(d, a, m int16) int16 { return d + 1 }}
+type CompOp struct {
+	Mnemonic Mnemonic
+	Code     uint16
+	Eval     func(d, a, m int16) int16
+}
+
+// ISA is a struct that represents an instruction set of a Hack CPU: the codes of the comp, dest and jump mnemonics. The first mnemonic added for a code is used by the disassembler.
+type ISA struct {
+	Name      string
+	comps     map[Mnemonic]CompOp
+	compCodes map[uint16]Mnemonic
+	dests     map[Mnemonic]uint16
+	destCodes map[uint16]Mnemonic
+	jumps     map[Mnemonic]uint16
+	jumpCodes map[uint16]Mnemonic
+}
+
+// NewISA returns an empty instruction set.
+func NewISA(name string) *ISA {
+	return &ISA{
+		Name:      name,
+		comps:     map[Mnemonic]CompOp{},
+		compCodes: map[uint16]Mnemonic{},
+		dests:     map[Mnemonic]uint16{},
+		destCodes: map[uint16]Mnemonic{},
+		jumps:     map[Mnemonic]uint16{},
+		jumpCodes: map[uint16]Mnemonic{},
+	}
+}
+
+// Clone returns a copy of the instruction set with the given name.
+func (isa *ISA) Clone(name string) *ISA {
+	c := NewISA(name)
+	maps.Copy(c.comps, isa.comps)
+	maps.Copy(c.compCodes, isa.compCodes)
+	maps.Copy(c.dests, isa.dests)
+	maps.Copy(c.destCodes, isa.destCodes)
+	maps.Copy(c.jumps, isa.jumps)
+	maps.Copy(c.jumpCodes, isa.jumpCodes)
+	return c
+}
+
+// AddComp adds a comp mnemonic. If op.Eval is nil, the prefix of op.Code must be 111 and the output is computed by the ALU. It returns an error if the mnemonic is already defined or the code has more than 10 bits.
+func (isa *ISA) AddComp(op CompOp) error {
+	if op.Code >= 1<<10 {
+		return fmt.Errorf("comp %s: code %b has more than 10 bits", op.Mnemonic, op.Code)
+	}
+	if _, ok := isa.comps[op.Mnemonic]; ok {
+		return fmt.Errorf("comp %s is already defined", op.Mnemonic)
+	}
+	if op.Eval == nil {
+		if op.Code>>7 != 0b111 {
+			return fmt.Errorf("comp %s: code %010b needs an expression because its prefix is not 111", op.Mnemonic, op.Code)
+		}
+		ctrl := op.Code & 0b111111
+		if op.Code>>6&1 == 1 {
+			op.Eval = func(d, a, m int16) int16 { return ALU(d, m, ctrl) }
+		} else {
+			op.Eval = func(d, a, m int16) int16 { return ALU(d, a, ctrl) }
+		}
+	}
+	isa.comps[op.Mnemonic] = op
+	if _, ok := isa.compCodes[op.Code]; !ok {
+		isa.compCodes[op.Code] = op.Mnemonic
+	}
+	return nil
+}
+
+// AddDest adds a dest mnemonic with a 3-bit code.
+func (isa *ISA) AddDest(mnemonic Mnemonic, code uint16) error {
+	return addField(isa.dests, isa.destCodes, "dest", mnemonic, code)
+}
+
+// AddJump adds a jump mnemonic with a 3-bit code.
+func (isa *ISA) AddJump(mnemonic Mnemonic, code uint16) error {
+	return addField(isa.jumps, isa.jumpCodes, "jump", mnemonic, code)
+}
+
+// addField adds a dest or jump mnemonic to the tables.
+func addField(codes map[Mnemonic]uint16, mnemonics map[uint16]Mnemonic, field string, mnemonic Mnemonic, code uint16) error {
+	if code >= 1<<3 {
+		return fmt.Errorf("%s %s: code %b has more than 3 bits", field, mnemonic, code)
+	}
+	if _, ok := codes[mnemonic]; ok {
+		return fmt.Errorf("%s %s is already defined", field, mnemonic)
+	}
+	codes[mnemonic] = code
+	if _, ok := mnemonics[code]; !ok {
+		mnemonics[code] = mnemonic
+	}
+	return nil
+}
+
+// orDefault returns the instruction set, or the standard Hack instruction set if it is nil.
+func (isa *ISA) orDefault() *ISA {
+	if isa == nil {
+		return DefaultISA()
+	}
+	return isa
+}
+
+// comp returns the comp field of the mnemonic. The operands of commutative operations can be written in any order.
+func (isa *ISA) comp(mnemonic Mnemonic) (uint16, error) {
+	isa = isa.orDefault()
+	if op, ok := isa.comps[mnemonic]; ok {
+		return op.Code, nil
+	}
+	if op, ok := isa.comps[canonicalComp(mnemonic)]; ok {
+		return op.Code, nil
+	}
+	return 0, fmt.Errorf("invalid comp mnemonic %q", mnemonic)
+}
+
+// dest returns the dest field of the mnemonic. The registers can be written in any order.
+func (isa *ISA) dest(mnemonic Mnemonic) (uint16, error) {
+	isa = isa.orDefault()
+	if code, ok := isa.dests[mnemonic]; ok {
+		return code, nil
+	}
+	if code, ok := isa.dests[canonicalDest(mnemonic)]; ok {
+		return code, nil
+	}
+	return 0, fmt.Errorf("invalid dest mnemonic %q", mnemonic)
+}
+
+// jump returns the jump field of the mnemonic.
+func (isa *ISA) jump(mnemonic Mnemonic) (uint16, error) {
+	if code, ok := isa.orDefault().jumps[mnemonic]; ok {
+		return code, nil
+	}
+	return 0, fmt.Errorf("invalid jump mnemonic %q", mnemonic)
+}
+
+// Decode returns the mnemonics of a C instruction. Example: 0b1110001100001000 -> "D", "M", "null"
+func (isa *ISA) Decode(inst uint16) (comp, dest, jump Mnemonic, err error) {
+	isa = isa.orDefault()
+	comp, ok := isa.compCodes[inst>>6]
+	if !ok {
+		return "", "", "", fmt.Errorf("invalid comp code %010b", inst>>6)
+	}
+	if dest, ok = isa.destCodes[inst>>3&0b111]; !ok {
+		return "", "", "", fmt.Errorf("invalid dest code %03b", inst>>3&0b111)
+	}
+	if jump, ok = isa.jumpCodes[inst&0b111]; !ok {
+		return "", "", "", fmt.Errorf("invalid jump code %03b", inst&0b111)
+	}
+	return comp, dest, jump, nil
+}
+
+// Compute returns the output of the comp field of a C instruction. A code that is not in the table is computed by the ALU from its control bits and the a bit, as the Hack CPU ignores the other prefix bits.
+func (isa *ISA) Compute(inst uint16, d, a, m int16) int16 {
+	isa = isa.orDefault()
+	if name, ok := isa.compCodes[inst>>6]; ok {
+		return isa.comps[name].Eval(d, a, m)
+	}
+	if inst>>12&1 == 1 {
+		return ALU(d, m, inst>>6&0b111111)
+	}
+	return ALU(d, a, inst>>6&0b111111)
+}
+
+// ALU computes the output of the Hack ALU. ctrl is the 6 control bits zx nx zy ny f no of a C instruction.
+func ALU(x, y int16, ctrl uint16) int16 {
+	zx, nx := ctrl>>5&1 == 1, ctrl>>4&1 == 1
+	zy, ny := ctrl>>3&1 == 1, ctrl>>2&1 == 1
+	f, no := ctrl>>1&1 == 1, ctrl&1 == 1
+	if zx {
+		x = 0
+	}
+	if nx {
+		x = ^x
+	}
+	if zy {
+		y = 0
+	}
+	if ny {
+		y = ^y
+	}
+	var out int16
+	if f {
+		out = x + y
+	} else {
+		out = x & y
+	}
+	if no {
+		out = ^out
+	}
+	return out
+}
+
+var (
+	isaMu sync.RWMutex
+	isas  = map[string]*ISA{}
+)
+
+// RegisterISA makes the instruction set available by its name to [LookupISA], [FindISA] and "extends" in ISA files. A set with the same name is replaced.
+func RegisterISA(isa *ISA) {
+	isaMu.Lock()
+	defer isaMu.Unlock()
+	isas[isa.Name] = isa
+}
+
+// LookupISA returns the registered instruction set of the given name.
+func LookupISA(name string) (*ISA, bool) {
+	isaMu.RLock()
+	defer isaMu.RUnlock()
+	isa, ok := isas[name]
+	return isa, ok
+}
+
+// ISANames returns the names of the registered instruction sets in sorted order.
+func ISANames() []string {
+	isaMu.RLock()
+	defer isaMu.RUnlock()
+	return slices.Sorted(maps.Keys(isas))
+}
+
+// DefaultISA returns the standard Hack instruction set.
+func DefaultISA() *ISA {
+	return hackISA
+}
+
+// FindISA returns the registered instruction set of the given name or loads it from the file of the given name.
+func FindISA(nameOrFile string) (*ISA, error) {
+	if isa, ok := LookupISA(nameOrFile); ok {
+		return isa, nil
+	}
+	f, err := os.Open(nameOrFile)
+	if err != nil {
+		return nil, fmt.Errorf("unknown instruction set %q: not registered (%s) and %w", nameOrFile, strings.Join(ISANames(), ", "), err)
+	}
+	defer f.Close()
+	return LoadISA(f)
+}
+
+// LoadISA reads an instruction set in the text format. The set is not registered.
+func LoadISA(r io.Reader) (*ISA, error) {
+	isa := NewISA("")
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := isa.loadLine(fields); err != nil {
+			return nil, fmt.Errorf("load isa: line %d: %w", lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("load isa: %w", err)
+	}
+	return isa, nil
+}
+
+// loadLine adds the entry of a line of an ISA file.
+func (isa *ISA) loadLine(fields []string) error {
+	switch {
+	case fields[0] == "name" && len(fields) == 2:
+		isa.Name = fields[1]
+	case fields[0] == "extends" && len(fields) == 2:
+		if len(isa.comps)+len(isa.dests)+len(isa.jumps) > 0 {
+			return fmt.Errorf("extends must come before the entries")
+		}
+		base, ok := LookupISA(fields[1])
+		if !ok {
+			return fmt.Errorf("unknown instruction set %q", fields[1])
+		}
+		name := isa.Name
+		*isa = *base.Clone(name)
+	case fields[0] == "comp" && (len(fields) == 3 || len(fields) == 4):
+		code, err := parseBits(fields[2], 10)
+		if err != nil {
+			return err
+		}
+		op := CompOp{Mnemonic: Mnemonic(fields[1]), Code: code}
+		if len(fields) == 4 {
+			if op.Eval, err = compileCompExpr(fields[3]); err != nil {
+				return err
+			}
+		}
+		return isa.AddComp(op)
+	case fields[0] == "dest" && len(fields) == 3:
+		code, err := parseBits(fields[2], 3)
+		if err != nil {
+			return err
+		}
+		return isa.AddDest(Mnemonic(fields[1]), code)
+	case fields[0] == "jump" && len(fields) == 3:
+		code, err := parseBits(fields[2], 3)
+		if err != nil {
+			return err
+		}
+		return isa.AddJump(Mnemonic(fields[1]), code)
+	default:
+		return fmt.Errorf("invalid entry %q", strings.Join(fields, " "))
+	}
+	return nil
+}
+
+// parseBits parses a binary number of exactly n digits. Example: "011", 3 -> 3
+func parseBits(s string, n int) (uint16, error) {
+	v, err := strconv.ParseUint(s, 2, 16)
+	if err != nil || len(s) != n {
+		return 0, fmt.Errorf("invalid code %q: want %d binary digits", s, n)
+	}
+	return uint16(v), nil
+}
+
+// hackISA is the standard Hack instruction set.
+var hackISA = newHackISA()
+
+func newHackISA() *ISA {
+	isa := NewISA("hack")
+	comps := []struct {
+		mnemonic Mnemonic
+		code     uint16
+	}{
+		{"0", 0b0101010}, {"1", 0b0111111}, {"-1", 0b0111010}, {"D", 0b0001100}, {"A", 0b0110000}, {"!D", 0b0001101},
+		{"!A", 0b0110001}, {"-D", 0b0001111}, {"-A", 0b0110011}, {"D+1", 0b0011111}, {"A+1", 0b0110111}, {"D-1", 0b0001110},
+		{"A-1", 0b0110010}, {"D+A", 0b0000010}, {"D-A", 0b0010011}, {"A-D", 0b0000111}, {"D&A", 0b0000000}, {"D|A", 0b0010101},
+		{"M", 0b1110000}, {"!M", 0b1110001}, {"-M", 0b1110011}, {"M+1", 0b1110111}, {"M-1", 0b1110010}, {"D+M", 0b1000010},
+		{"D-M", 0b1010011}, {"M-D", 0b1000111}, {"D&M", 0b1000000}, {"D|M", 0b1010101},
+	}
+	for _, c := range comps {
+		isa.AddComp(CompOp{Mnemonic: c.mnemonic, Code: 0b111<<7 | c.code})
+	}
+	for code, m := range []Mnemonic{"null", "M", "D", "MD", "A", "AM", "AD", "AMD"} {
+		isa.AddDest(m, uint16(code))
+	}
+	for code, m := range []Mnemonic{"null", "JGT", "JEQ", "JGE", "JLT", "JNE", "JLE", "JMP"} {
+		isa.AddJump(m, uint16(code))
+	}
+	return isa
+}
+
+// newHackShiftISA returns the Hack instruction set with the shift operations of the extended Hack CPU. They have the prefix 101.
+func newHackShiftISA() *ISA {
+	isa := hackISA.Clone("hack-shift")
+	shifts := []CompOp{
+		{"A<<", 0b1010100000, func(d, a, m int16) int16 { return a << 1 }},
+		{"D<<", 0b1010110000, func(d, a, m int16) int16 { return d << 1 }},
+		{"M<<", 0b1011100000, func(d, a, m int16) int16 { return m << 1 }},
+		{"A>>", 0b1010000000, func(d, a, m int16) int16 { return a >> 1 }},
+		{"D>>", 0b1010010000, func(d, a, m int16) int16 { return d >> 1 }},
+		{"M>>", 0b1011000000, func(d, a, m int16) int16 { return m >> 1 }},
+	}
+	for _, op := range shifts {
+		isa.AddComp(op)
+	}
+	return isa
+}
+
+func init() {
+	RegisterISA(hackISA)
+	RegisterISA(newHackShiftISA())
+}
+
+// compExpr is a struct that represents a recursive descent parser of the expression of a comp operation.
+type compExpr struct {
+	s string
+	i int
+}
+
+// compEval is the compiled form of an expression.
+type compEval = func(d, a, m int16) int16
+
+// compileCompExpr compiles the expression of a comp operation. Example: "D<<1", "-(D&A)"
+func compileCompExpr(s string) (compEval, error) {
+	p := &compExpr{s: s}
+	eval, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.i != len(p.s) {
+		return nil, fmt.Errorf("unexpected %q in expression %q", p.s[p.i:], s)
+	}
+	return eval, nil
+}
+
+// compOperators lists the binary operators from the lowest precedence to the highest.
+var compOperators = [][]string{{"|"}, {"&"}, {"<<", ">>"}, {"+", "-"}}
+
+// binary parses the binary operators of the given precedence level and higher.
+func (p *compExpr) binary(level int) (compEval, error) {
+	if level == len(compOperators) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, o := range compOperators[level] {
+			if strings.HasPrefix(p.s[p.i:], o) {
+				op = o
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		p.i += len(op)
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		switch op {
+		case "|":
+			left = func(d, a, m int16) int16 { return l(d, a, m) | right(d, a, m) }
+		case "&":
+			left = func(d, a, m int16) int16 { return l(d, a, m) & right(d, a, m) }
+		case "<<":
+			left = func(d, a, m int16) int16 { return l(d, a, m) << uint16(right(d, a, m)) }
+		case ">>":
+			left = func(d, a, m int16) int16 { return l(d, a, m) >> uint16(right(d, a, m)) }
+		case "+":
+			left = func(d, a, m int16) int16 { return l(d, a, m) + right(d, a, m) }
+		case "-":
+			left = func(d, a, m int16) int16 { return l(d, a, m) - right(d, a, m) }
+		}
+	}
+}
+
+// unary parses a unary operator, a register, a number or a parenthesized expression.
+func (p *compExpr) unary() (compEval, error) {
+	if p.i >= len(p.s) {
+		return nil, fmt.Errorf("unexpected end of expression %q", p.s)
+	}
+	c := p.s[p.i]
+	switch {
+	case c == '-' || c == '!':
+		p.i++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if c == '-' {
+			return func(d, a, m int16) int16 { return -x(d, a, m) }, nil
+		}
+		return func(d, a, m int16) int16 { return ^x(d, a, m) }, nil
+	case c == '(':
+		p.i++
+		x, err := p.binary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.i >= len(p.s) || p.s[p.i] != ')' {
+			return nil, fmt.Errorf("missing ) in expression %q", p.s)
+		}
+		p.i++
+		return x, nil
+	case c == 'D':
+		p.i++
+		return func(d, a, m int16) int16 { return d }, nil
+	case c == 'A':
+		p.i++
+		return func(d, a, m int16) int16 { return a }, nil
+	case c == 'M':
+		p.i++
+		return func(d, a, m int16) int16 { return m }, nil
+	case '0' <= c && c <= '9':
+		start := p.i
+		for p.i < len(p.s) && '0' <= p.s[p.i] && p.s[p.i] <= '9' {
+			p.i++
+		}
+		v, err := strconv.ParseInt(p.s[start:p.i], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in expression %q", p.s[start:p.i], p.s)
+		}
+		n := int16(v)
+		return func(d, a, m int16) int16 { return n }, nil
+	}
+	return nil, fmt.Errorf("unexpected %q in expression %q", p.s[p.i:], p.s)
+}
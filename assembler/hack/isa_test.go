@@ -0,0 +1,167 @@
+package hack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDefaultISAMatchesALU(t *testing.T) {
+	isa := DefaultISA()
+	for m, op := range isa.comps {
+		if got, want := op.Eval(3, 5, 7), isa.Compute(op.Code<<6, 3, 5, 7); got != want {
+			t.Errorf("%s: Eval = %d, Compute = %d", m, got, want)
+		}
+	}
+	tests := []struct {
+		comp Mnemonic
+		want int16
+	}{
+		{"D+A", 8}, {"D-M", -4}, {"M-D", 4}, {"!D", -4}, {"-1", -1}, {"D|A", 7}, {"A+1", 6},
+	}
+	for _, test := range tests {
+		code, err := isa.comp(test.comp)
+		if err != nil {
+			t.Fatalf("comp(%q) failed: %v", test.comp, err)
+		}
+		if got := isa.Compute(code<<6, 3, 5, 7); got != test.want {
+			t.Errorf("Compute(%s) = %d, want %d", test.comp, got, test.want)
+		}
+	}
+}
+
+func TestShiftISA(t *testing.T) {
+	isa, ok := LookupISA("hack-shift")
+	if !ok {
+		t.Fatal("hack-shift is not registered")
+	}
+	asmCode := "D=D<<\nM=M>>\nAD=A<<;JGT\nD=D+A\n"
+	result, err := Assemble(strings.NewReader(asmCode), Options{FileName: "Prog.asm", ISA: isa})
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+	expected := []uint16{0b1010110000010000, 0b1011000000001000, 0b1010100000110001, 0b1110000010010000}
+	if diff := cmp.Diff(expected, result.Words); diff != "" {
+		t.Errorf("Assemble words mismatch (-want +got):\n%s", diff)
+	}
+	streamed, err := AssembleStream(strings.NewReader(asmCode), Options{FileName: "Prog.asm", ISA: isa})
+	if err != nil {
+		t.Fatalf("AssembleStream failed: %v", err)
+	}
+	if diff := cmp.Diff(expected, streamed.Words); diff != "" {
+		t.Errorf("AssembleStream words mismatch (-want +got):\n%s", diff)
+	}
+
+	var hackFile bytes.Buffer
+	if err := WriteWords(&hackFile, result.Words, FormatHack); err != nil {
+		t.Fatal(err)
+	}
+	var asmFile strings.Builder
+	if err := Disassemble(bytes.NewReader(hackFile.Bytes()), &asmFile, DisassembleOptions{ISA: isa}); err != nil {
+		t.Fatalf("Disassemble failed: %v", err)
+	}
+	if diff := cmp.Diff(asmCode, asmFile.String()); diff != "" {
+		t.Errorf("Disassemble mismatch (-want +got):\n%s", diff)
+	}
+
+	// the standard instruction set rejects the shifts
+	_, err = Assemble(strings.NewReader(asmCode), Options{FileName: "Prog.asm"})
+	want := Diagnostics{{Pos: Position{"Prog.asm", 1, 3}, Message: `invalid comp mnemonic "D<<"`}, {Pos: Position{"Prog.asm", 2, 3}, Message: `invalid comp mnemonic "M>>"`}, {Pos: Position{"Prog.asm", 3, 4}, Message: `invalid comp mnemonic "A<<"`}}
+	if diff := cmp.Diff(want, err); diff != "" {
+		t.Errorf("Assemble with the standard ISA mismatch (-want +got):\n%s", diff)
+	}
+	if err := Disassemble(bytes.NewReader(hackFile.Bytes()), &asmFile, DisassembleOptions{}); err == nil {
+		t.Error("Disassemble with the standard ISA succeeded, want an error")
+	}
+}
+
+func TestLoadISA(t *testing.T) {
+	isaFile := `// Hack with a multiplier
+name hack-mul
+extends hack
+comp D*2   1000000000  D+D
+comp D^A   1000000001  (D|A)&!(D&A)
+comp -D>>2 1001000000  -(D>>2)
+dest DA    110
+jump GO    111
+`
+	isa, err := LoadISA(strings.NewReader(isaFile))
+	if err != nil {
+		t.Fatalf("LoadISA failed: %v", err)
+	}
+	if isa.Name != "hack-mul" {
+		t.Errorf("Name = %q, want hack-mul", isa.Name)
+	}
+	tests := []struct {
+		inst    string
+		code    uint16
+		d, a, m int16
+		want    int16
+	}{
+		{"D=D*2", 0b1000000000010000, 21, 0, 0, 42},
+		{"D=D^A", 0b1000000001010000, 0b1100, 0b1010, 0, 0b0110},
+		{"D=-D>>2", 0b1001000000010000, -8, 0, 0, 2},
+		{"DA=D+1;GO", 0b1110011111110111, 1, 0, 0, 2},
+		{"AD=D+1", 0b1110011111110000, 1, 0, 0, 2},
+	}
+	for _, test := range tests {
+		result, err := Assemble(strings.NewReader(test.inst), Options{ISA: isa})
+		if err != nil {
+			t.Errorf("Assemble(%q) failed: %v", test.inst, err)
+			continue
+		}
+		if result.Words[0] != test.code {
+			t.Errorf("Assemble(%q) = %016b, want %016b", test.inst, result.Words[0], test.code)
+		}
+		if got := isa.Compute(test.code, test.d, test.a, test.m); got != test.want {
+			t.Errorf("Compute(%q) = %d, want %d", test.inst, got, test.want)
+		}
+	}
+	// the base instruction set is not changed
+	if _, err := DefaultISA().jump("GO"); err == nil {
+		t.Error("jump GO is defined in the standard ISA")
+	}
+}
+
+func TestLoadISAErrors(t *testing.T) {
+	tests := []struct {
+		isaFile string
+		want    string
+	}{
+		{"comp D*2 1000000000", `load isa: line 1: comp D*2: code 1000000000 needs an expression because its prefix is not 111`},
+		{"extends z80", `load isa: line 1: unknown instruction set "z80"`},
+		{"dest X 1\n", `load isa: line 1: invalid code "1": want 3 binary digits`},
+		{"\njump JMP 111\njump JMP 110", `load isa: line 3: jump JMP is already defined`},
+		{"comp X 1000000000 D+", `load isa: line 1: unexpected end of expression "D+"`},
+		{"comp X 1000000000 (D", `load isa: line 1: missing ) in expression "(D"`},
+		{"comp X 1000000000 D*2", `load isa: line 1: unexpected "*2" in expression "D*2"`},
+		{"jump JMP 111\nextends hack", `load isa: line 2: extends must come before the entries`},
+		{"opcode X 1", `load isa: line 1: invalid entry "opcode X 1"`},
+	}
+	for _, test := range tests {
+		_, err := LoadISA(strings.NewReader(test.isaFile))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("LoadISA(%q) = %v, want %s", test.isaFile, err, test.want)
+		}
+	}
+}
+
+func TestFindISA(t *testing.T) {
+	isa := DefaultISA().Clone("test-isa")
+	if err := isa.AddComp(CompOp{Mnemonic: "D*A", Code: 0b1000000000, Eval: func(d, a, m int16) int16 { return d * a }}); err != nil {
+		t.Fatal(err)
+	}
+	RegisterISA(isa)
+	found, err := FindISA("test-isa")
+	if err != nil || found != isa {
+		t.Fatalf("FindISA(test-isa) = %v, %v, want the registered ISA", found, err)
+	}
+	if got := found.Compute(0b1000000000010000, 6, 7, 0); got != 42 {
+		t.Errorf("Compute(D*A) = %d, want 42", got)
+	}
+	if _, err := FindISA("no-such.isa"); err == nil {
+		t.Error("FindISA(no-such.isa) succeeded, want an error")
+	}
+}
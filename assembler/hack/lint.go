@@ -0,0 +1,220 @@
+package hack
+
+import (
+	"bytes"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+/*
+lint.go checks an assembly file for code that assembles but is probably wrong. Each check reports warnings with the name of its rule.
+
+| rule | description |
+|------|-------------|
+| unused-label | a label that no A instruction refers to |
+| unreachable | instructions after an unconditional jump that no label makes reachable |
+| jump-with-m | a C instruction that uses M and jumps. A is both the address of M and the jump target |
+| typo | a variable whose name is one edit away from a label or a predefined symbol. Example: LOPP for LOOP |
+| shadow | a label or variable that differs from a predefined symbol only in case. Example: r0, Screen |
+| no-halt | a program whose last instruction is not an unconditional jump, so the CPU runs past the end |
+| memory-map, variable-limit | a variable in the memory map or above Options.VariableLimit. These warnings are also reported by the assembler |
+
+Macros are expanded before the checks, so warnings in a macro body list the call sites like the errors of the assembler.
+*/
+
+// Lint checks the assembly file and returns the warnings sorted by position. The errors of the assembler are included, so the result is the same list the assembler would report plus the warnings.
+func Lint(asmFile io.Reader, opts Options) Diagnostics {
+	buf, origins, data, diags := preprocess(asmFile, opts)
+	symbolTable, firstDiags := firstPass(bytes.NewReader(buf), origins, data)
+	_, secondDiags := secondPass(bytes.NewReader(buf), &symbolTable, origins, opts)
+	diags = append(diags, firstDiags...)
+	diags = append(diags, secondDiags...)
+
+	// ParseProgram returns one node for each line, so origins[i] is the origin of prog.Nodes[i]
+	prog, _ := ParseProgram(bytes.NewReader(buf), opts.FileName)
+	l := linter{prog: prog, origins: origins}
+	l.unusedLabels()
+	l.unreachable()
+	l.jumpWithM()
+	l.variables()
+	l.noHalt()
+	diags = append(diags, l.diags...)
+	diags.sort()
+	return diags
+}
+
+// linter is a struct that represents the state of the checks over a preprocessed program.
+type linter struct {
+	prog    *Program
+	origins []lineOrigin
+	diags   Diagnostics
+}
+
+// warnf adds a warning at the node i.
+func (l *linter) warnf(i int, rule string, format string, args ...any) {
+	d := l.origins[i].diagnostic(l.prog.Nodes[i].Pos().Column, format, args...)
+	d.Severity, d.Rule = SeverityWarning, rule
+	l.diags = append(l.diags, d)
+}
+
+// labels returns the labels of the program.
+func (l *linter) labels() map[SymbolOrConstant]bool {
+	labels := map[SymbolOrConstant]bool{}
+	for _, n := range l.prog.Nodes {
+		if label, ok := n.(*Label); ok {
+			labels[label.Name] = true
+		}
+	}
+	return labels
+}
+
+func (l *linter) unusedLabels() {
+	used := map[SymbolOrConstant]bool{}
+	for _, n := range l.prog.Nodes {
+		if a, ok := n.(*AInstruction); ok {
+			for _, s := range symbolsOf(a.Value) {
+				used[s] = true
+			}
+		}
+	}
+	for i, n := range l.prog.Nodes {
+		if label, ok := n.(*Label); ok && !used[label.Name] {
+			l.warnf(i, "unused-label", "label %s is never used", label.Name)
+		}
+	}
+}
+
+func (l *linter) unreachable() {
+	afterJump := false
+	for i, n := range l.prog.Nodes {
+		switch n := n.(type) {
+		case *Label:
+			afterJump = false
+		case *AInstruction, *CInstruction:
+			if afterJump {
+				l.warnf(i, "unreachable", "unreachable instruction after an unconditional jump")
+				afterJump = false
+			}
+			if c, ok := n.(*CInstruction); ok && alwaysJumps(c) {
+				afterJump = true
+			}
+		}
+	}
+}
+
+func (l *linter) jumpWithM() {
+	for i, n := range l.prog.Nodes {
+		if c, ok := n.(*CInstruction); ok && c.Jump != "" && strings.Contains(string(c.Dest)+string(c.Comp), "M") {
+			l.warnf(i, "jump-with-m", "%s uses M and jumps: A is both the address of M and the jump target", c)
+		}
+	}
+}
+
+func (l *linter) variables() {
+	labels := l.labels()
+	candidates := slices.Sorted(maps.Keys(labels))
+	candidates = append(candidates, slices.Sorted(maps.Keys(predefinedSymbols))...)
+	reported := map[SymbolOrConstant]bool{}
+	for i, n := range l.prog.Nodes {
+		var names []SymbolOrConstant
+		switch n := n.(type) {
+		case *Label:
+			names = []SymbolOrConstant{n.Name}
+		case *AInstruction:
+			names = symbolsOf(n.Value)
+		}
+		for _, name := range names {
+			_, predefined := predefinedSymbols[name]
+			if predefined || reported[name] {
+				continue
+			}
+			if s, ok := shadowedSymbol(name); ok {
+				reported[name] = true
+				l.warnf(i, "shadow", "%s differs from the predefined symbol %s only in case", name, s)
+				continue
+			}
+			if labels[name] {
+				continue
+			}
+			for _, c := range candidates {
+				if len(name) > 2 && editDistance(string(name), string(c)) == 1 {
+					reported[name] = true
+					l.warnf(i, "typo", "variable %s may be a typo of %s", name, c)
+					break
+				}
+			}
+		}
+	}
+}
+
+func (l *linter) noHalt() {
+	for i := len(l.prog.Nodes) - 1; i >= 0; i-- {
+		switch n := l.prog.Nodes[i].(type) {
+		case *AInstruction:
+			l.warnf(i, "no-halt", "the program does not end in an infinite loop")
+			return
+		case *CInstruction:
+			if !alwaysJumps(n) {
+				l.warnf(i, "no-halt", "the program does not end in an infinite loop")
+			}
+			return
+		}
+	}
+}
+
+// alwaysJumps returns true if the C instruction jumps regardless of the ALU output. Example: 0;JMP, 0;JEQ
+func alwaysJumps(c *CInstruction) bool {
+	switch c.Jump {
+	case "JMP":
+		return true
+	case "JEQ", "JGE", "JLE":
+		return c.Comp == "0"
+	case "JNE", "JGT":
+		return c.Comp == "1"
+	}
+	return false
+}
+
+// symbolsOf returns the symbols in the value of an A instruction. Example: "SCREEN+32*row" -> ["SCREEN", "row"]
+func symbolsOf(value SymbolOrConstant) []SymbolOrConstant {
+	var symbols []SymbolOrConstant
+	for _, word := range strings.FieldsFunc(string(value), func(r rune) bool { return !isSymbolChar(r) }) {
+		if isValidSymbol(SymbolOrConstant(word)) {
+			symbols = append(symbols, SymbolOrConstant(word))
+		}
+	}
+	return symbols
+}
+
+// shadowedSymbol returns the predefined symbol that equals name ignoring case. Example: "screen" -> "SCREEN"
+func shadowedSymbol(name SymbolOrConstant) (SymbolOrConstant, bool) {
+	for s := range predefinedSymbols {
+		if s != name && strings.EqualFold(string(s), string(name)) {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,87 @@
+package hack
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLint(t *testing.T) {
+	asmCode := `@i
+M=1
+(LOOP)
+@LOPP
+D=M
+@LOOP
+M;JGT
+(UNUSED)
+@Screen
+0;JMP
+D=1
+(r1)
+@r1
+`
+	warning := func(line, column int, rule, message string) Diagnostic {
+		return Diagnostic{Pos: Position{"Prog.asm", line, column}, Message: message, Severity: SeverityWarning, Rule: rule}
+	}
+	expected := Diagnostics{
+		warning(4, 1, "typo", "variable LOPP may be a typo of LOOP"),
+		warning(7, 1, "jump-with-m", "M;JGT uses M and jumps: A is both the address of M and the jump target"),
+		warning(8, 1, "unused-label", "label UNUSED is never used"),
+		warning(9, 1, "shadow", "Screen differs from the predefined symbol SCREEN only in case"),
+		warning(11, 1, "unreachable", "unreachable instruction after an unconditional jump"),
+		warning(12, 1, "shadow", "r1 differs from the predefined symbol R1 only in case"),
+		warning(13, 1, "no-halt", "the program does not end in an infinite loop"),
+	}
+	diags := Lint(strings.NewReader(asmCode), Options{FileName: "Prog.asm"})
+	if diff := cmp.Diff(expected, diags); diff != "" {
+		t.Errorf("Lint mismatch (-want +got):\n%s", diff)
+	}
+	if diags.Err() != nil {
+		t.Errorf("Err() = %v, want nil for warnings", diags.Err())
+	}
+	if got, want := diags[0].Error(), "Prog.asm:4:1: warning: variable LOPP may be a typo of LOOP [typo]"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestLintErrorsAndMacros(t *testing.T) {
+	asmCode := `#macro WAIT
+(%%L)
+@%%L
+M;JGT
+#endmacro
+X=1
+WAIT
+(END)
+@END
+0;JMP
+`
+	expected := Diagnostics{
+		{Pos: Position{"Prog.asm", 4, 1}, Message: "M;JGT uses M and jumps: A is both the address of M and the jump target", Expansion: []Position{{"Prog.asm", 7, 1}}, Severity: SeverityWarning, Rule: "jump-with-m"},
+		{Pos: Position{"Prog.asm", 6, 1}, Message: `invalid dest mnemonic "X"`},
+	}
+	diags := Lint(strings.NewReader(asmCode), Options{FileName: "Prog.asm"})
+	if diff := cmp.Diff(expected, diags); diff != "" {
+		t.Errorf("Lint mismatch (-want +got):\n%s", diff)
+	}
+	if !diags.HasErrors() || diags.Err() == nil {
+		t.Errorf("Err() = nil, want the error of X=1")
+	}
+}
+
+func TestLintExamples(t *testing.T) {
+	// the example programs of the book are clean except that Add.asm has no halt loop
+	for _, fileName := range []string{"../asm_files/rect/Rect.asm", "../asm_files/max/Max.asm"} {
+		f, err := os.Open(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if diags := Lint(f, Options{FileName: fileName}); len(diags) != 0 {
+			t.Errorf("Lint(%s) = %v, want no diagnostics", fileName, diags)
+		}
+	}
+}
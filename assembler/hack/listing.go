@@ -0,0 +1,118 @@
+package hack
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// writeListing writes a listing of the assembled program. Each line has the ROM address, the binary code, the source position, the source line and the value of the symbol if any. Labels have no address and binary code.
+//
+//	ADDR  BINARY            SOURCE          LINE
+//	   0  0000000000000000  Rect.asm:11     @R0             // R0 = 0
+//	                        Rect.asm:22     (LOOP)          // LOOP = 10
+func writeListing(w io.Writer, lines []assembledLine) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-4s  %-16s  %-14s  %s\n", "ADDR", "BINARY", "SOURCE", "LINE")
+	for _, l := range lines {
+		if l.code == "" {
+			fmt.Fprintf(bw, "%4s  %16s", "", "")
+		} else {
+			fmt.Fprintf(bw, "%4d  %s", l.address, l.code)
+		}
+		fmt.Fprintf(bw, "  %-14s  ", l.origin.pos.lineString())
+		if l.symbol != "" {
+			fmt.Fprintf(bw, "%-14s  // %s = %d", l.text, l.symbol, l.value)
+		} else {
+			fmt.Fprint(bw, l.text)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// lineString returns the position in the form "file:line" without the column.
+func (p Position) lineString() string {
+	if p.File == "" {
+		return fmt.Sprint(p.Line)
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// SourceMapVersion is the version of the source map format written by the assembler.
+const SourceMapVersion = 1
+
+// SourceMapEntry is a struct that maps a ROM address to the source line of its instruction. If the instruction comes from a macro, Expansion lists the macro call sites, innermost first.
+type SourceMapEntry struct {
+	Address   int        `json:"address"`
+	File      string     `json:"file"`
+	Line      int        `json:"line"`
+	Expansion []Position `json:"expansion,omitempty"`
+}
+
+// SourceMap is a struct that maps ROM addresses to source lines. Entries are sorted by address.
+type SourceMap struct {
+	Version int              `json:"version"`
+	Entries []SourceMapEntry `json:"entries"`
+}
+
+// newSourceMap returns the source map of the assembled program.
+func newSourceMap(lines []assembledLine) SourceMap {
+	m := SourceMap{Version: SourceMapVersion, Entries: []SourceMapEntry{}}
+	for _, l := range lines {
+		if l.code == "" {
+			continue
+		}
+		m.Entries = append(m.Entries, SourceMapEntry{
+			Address:   l.address,
+			File:      l.origin.pos.File,
+			Line:      l.origin.pos.Line,
+			Expansion: l.origin.expansion,
+		})
+	}
+	return m
+}
+
+// Lookup returns the entry of the given ROM address.
+func (m SourceMap) Lookup(address int) (SourceMapEntry, bool) {
+	i, ok := slices.BinarySearchFunc(m.Entries, address, func(e SourceMapEntry, address int) int {
+		return e.Address - address
+	})
+	if !ok {
+		return SourceMapEntry{}, false
+	}
+	return m.Entries[i], true
+}
+
+// WriteSourceMap writes the source map as JSON.
+func WriteSourceMap(w io.Writer, m SourceMap) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// ReadSourceMap reads a source map written by [WriteSourceMap].
+func ReadSourceMap(r io.Reader) (SourceMap, error) {
+	var m SourceMap
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return SourceMap{}, fmt.Errorf("read source map: %w", err)
+	}
+	if m.Version != SourceMapVersion {
+		return SourceMap{}, fmt.Errorf("read source map: unsupported version %d", m.Version)
+	}
+	slices.SortFunc(m.Entries, func(a, b SourceMapEntry) int { return a.Address - b.Address })
+	return m, nil
+}
+
+// ReadSourceMapFromFile reads a source map from the given file.
+func ReadSourceMapFromFile(fileName string) (SourceMap, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return SourceMap{}, err
+	}
+	defer f.Close()
+	return ReadSourceMap(f)
+}
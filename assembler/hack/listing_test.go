@@ -0,0 +1,77 @@
+package hack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListing(t *testing.T) {
+	asmCode := `// count down
+@R0
+D=M
+(LOOP)
+  @i
+M=D
+@LOOP
+D;JGT
+`
+	expected := `ADDR  BINARY            SOURCE          LINE
+   0  0000000000000000  Prog.asm:2      @R0             // R0 = 0
+   1  1111110000010000  Prog.asm:3      D=M
+                        Prog.asm:4      (LOOP)          // LOOP = 2
+   2  0000000000010000  Prog.asm:5      @i              // i = 16
+   3  1110001100001000  Prog.asm:6      M=D
+   4  0000000000000010  Prog.asm:7      @LOOP           // LOOP = 2
+   5  1110001100000001  Prog.asm:8      D;JGT
+`
+	listing := &bytes.Buffer{}
+	err := HackWithOptions(strings.NewReader(asmCode), &bytes.Buffer{}, Options{FileName: "Prog.asm", Listing: listing})
+	if err != nil {
+		t.Fatalf("HackWithOptions failed: %v", err)
+	}
+	if diff := cmp.Diff(expected, listing.String()); diff != "" {
+		t.Errorf("listing mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	asmCode := `#macro INC x
+@%x
+M=M+1
+#endmacro
+@0
+D=A
+INC R1
+`
+	buf := &bytes.Buffer{}
+	err := HackWithOptions(strings.NewReader(asmCode), &bytes.Buffer{}, Options{FileName: "Prog.asm", SourceMap: buf})
+	if err != nil {
+		t.Fatalf("HackWithOptions failed: %v", err)
+	}
+	m, err := ReadSourceMap(buf)
+	if err != nil {
+		t.Fatalf("ReadSourceMap failed: %v", err)
+	}
+	expected := []SourceMapEntry{
+		{Address: 0, File: "Prog.asm", Line: 5},
+		{Address: 1, File: "Prog.asm", Line: 6},
+		{Address: 2, File: "Prog.asm", Line: 2, Expansion: []Position{{"Prog.asm", 7, 1}}},
+		{Address: 3, File: "Prog.asm", Line: 3, Expansion: []Position{{"Prog.asm", 7, 1}}},
+	}
+	if diff := cmp.Diff(expected, m.Entries); diff != "" {
+		t.Errorf("source map mismatch (-want +got):\n%s", diff)
+	}
+
+	if e, ok := m.Lookup(3); !ok || e.Line != 3 {
+		t.Errorf("Lookup(3) = %v, %v, want line 3", e, ok)
+	}
+	if _, ok := m.Lookup(4); ok {
+		t.Errorf("Lookup(4) expected no entry")
+	}
+	if _, err := ReadSourceMap(strings.NewReader(`{"version": 2, "entries": []}`)); err == nil {
+		t.Errorf("ReadSourceMap expected an error for an unsupported version")
+	}
+}
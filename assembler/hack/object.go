@@ -0,0 +1,356 @@
+package hack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+/*
+object.go assembles a Hack assembly file into a relocatable object and links objects into one program.
+
+An object has the binary code of its instructions with the addresses counted from 0, the labels it defines, the symbols it imports from other objects and a relocation for each A instruction that refers to a label or a variable. Labels are local to their object, so two objects can both have a LOOP label. Only the labels declared with .global are exported, and a label of another object is used after declaring it with .extern:
+
+	.global MULT  // other objects can jump to MULT
+	.extern END   // END is a label exported by another object
+
+The linker places the objects one after another in ROM, resolves every relocation with the labels of its own object and the exported labels, and assigns the remaining symbols to variables in a RAM range shared by all objects, starting at 16. An import that no object exports is an error. The directives are ignored when a file is assembled into a whole program.
+
+A relocatable A instruction is a constant expression, or a label or variable followed only by constant terms that are added or subtracted. Example: @LOOP, @LOOP+3, @arr-1+2*4. The symbol must be the first term and appear once, so @2+LOOP, @(LOOP+1) and @LOOP/2*2 are errors. Predefined symbols are constants.
+*/
+
+// ObjectVersion is the version of the object format written by the assembler.
+const ObjectVersion = 2
+
+// ObjectExt is the extension of object files. Example: "Math.hobj"
+const ObjectExt = ".hobj"
+
+// ObjectSymbol is a struct that represents a label defined in an object. Offset is the ROM address of the label counted from the beginning of the object.
+type ObjectSymbol struct {
+	Name   SymbolOrConstant `json:"name"`
+	Offset int              `json:"offset"`
+}
+
+// Relocation is a struct that represents an A instruction whose value is fixed by the linker. The linker writes the value of Symbol plus Addend to Code[Address]. Symbol is a label of the object, an import or a shared variable.
+type Relocation struct {
+	Address int              `json:"address"`
+	Symbol  SymbolOrConstant `json:"symbol"`
+	Addend  int              `json:"addend,omitempty"`
+}
+
+// Object is a struct that represents a relocatable object assembled from an assembly file. Code has 0 for the A instructions that have a relocation. Exports are the labels declared with .global and Locals are the other labels. Imports are the symbols declared with .extern.
+type Object struct {
+	Version     int                `json:"version"`
+	File        string             `json:"file,omitempty"`
+	Code        []uint16           `json:"code"`
+	Exports     []ObjectSymbol     `json:"exports"`
+	Locals      []ObjectSymbol     `json:"locals"`
+	Imports     []SymbolOrConstant `json:"imports"`
+	Relocations []Relocation       `json:"relocations"`
+}
+
+// linkageSymbol is a struct that represents a symbol declared by .global or .extern.
+type linkageSymbol struct {
+	name   SymbolOrConstant
+	origin lineOrigin
+}
+
+// linkageDirective processes .global and .extern. fields are the words of the line. Example: [".global", "MULT"]
+func (pp *preprocessor) linkageDirective(l sourceLine, fields []string) {
+	directive := fields[0]
+	if len(fields) != 2 {
+		pp.errorf(l, "invalid %s: want %s NAME", directive, directive)
+		return
+	}
+	name := SymbolOrConstant(fields[1])
+	if !isValidSymbol(name) {
+		pp.errorf(l, "invalid %s name %q", directive, name)
+		return
+	}
+	if _, ok := predefinedSymbols[name]; ok {
+		pp.errorf(l, "%s %s conflicts with the predefined symbol", directive, name)
+		return
+	}
+	if directive == ".global" {
+		pp.globals = append(pp.globals, linkageSymbol{name: name, origin: l.origin})
+	} else {
+		pp.externs = append(pp.externs, linkageSymbol{name: name, origin: l.origin})
+	}
+}
+
+// AssembleObject converts an assembly language file to a relocatable object. If the assembly file has problems, it returns [Diagnostics] that lists all of them with their positions.
+func AssembleObject(asmFile io.Reader, opts Options) (Object, error) {
+	// the preprocessor is run directly because the linkage directives are needed
+	var buf bytes.Buffer
+	pp := newPreprocessor(&buf)
+	pp.configure(opts)
+	pp.process(asmFile, opts.FileName)
+	diags := pp.diags
+	for _, b := range pp.data {
+		diags = append(diags, b.origin.diagnostic(1, "data %s cannot be assembled into a relocatable object", b.name))
+	}
+	symbolTable, firstDiags := firstPass(bytes.NewReader(buf.Bytes()), pp.origins, nil)
+	diags = append(diags, firstDiags...)
+	obj, objectDiags := objectPass(bytes.NewReader(buf.Bytes()), &symbolTable, pp.origins, opts.ISA)
+	diags = append(diags, objectDiags...)
+	diags = append(diags, obj.declare(&symbolTable, pp.globals, pp.externs)...)
+	if err := diags.Err(); err != nil {
+		return Object{}, err
+	}
+	obj.File = opts.FileName
+	return obj, nil
+}
+
+// objectPass converts A and C instructions to binary code like secondPass, but records a relocation instead of resolving labels and variables.
+func objectPass(asmFile io.Reader, symbolTable *SymbolTable, origins []lineOrigin, isa *ISA) (Object, Diagnostics) {
+	p := Parser{scanner: bufio.NewScanner(asmFile), origins: origins, isa: isa}
+	obj := Object{Version: ObjectVersion, Code: []uint16{}, Exports: []ObjectSymbol{}, Locals: []ObjectSymbol{}, Imports: []SymbolOrConstant{}, Relocations: []Relocation{}}
+	var diags Diagnostics
+	for p.advance() {
+		switch p.currentType {
+		case A_Instruction:
+			symOrConst, err := p.symbol()
+			if err != nil {
+				p.errorf(&diags, 0, "%v", err)
+				continue
+			}
+			word, reloc, err := relocatable(symOrConst, symbolTable)
+			if err != nil {
+				offset := 1
+				if e, ok := err.(*exprError); ok {
+					offset += e.offset
+				}
+				p.errorf(&diags, offset, "%v", err)
+				continue
+			}
+			if reloc != nil {
+				reloc.Address = len(obj.Code)
+				obj.Relocations = append(obj.Relocations, *reloc)
+			}
+			obj.Code = append(obj.Code, word)
+		case C_Instruction:
+			code, ok := p.cInstructionCode(&diags)
+			if !ok {
+				continue
+			}
+			obj.Code = append(obj.Code, BinaryCode(code).word())
+		}
+	}
+	return obj, diags
+}
+
+// declare sorts the labels of the object into exports and locals, and records the imports. A global symbol must be a label of the object and an extern symbol must not be.
+func (obj *Object) declare(symbolTable *SymbolTable, globals, externs []linkageSymbol) Diagnostics {
+	var diags Diagnostics
+	exported := map[SymbolOrConstant]bool{}
+	for _, g := range globals {
+		if exported[g.name] {
+			continue
+		}
+		if !symbolTable.labels[g.name] {
+			diags = append(diags, g.origin.diagnostic(1, "global symbol %s is not a label of this file", g.name))
+			continue
+		}
+		exported[g.name] = true
+		obj.Exports = append(obj.Exports, ObjectSymbol{Name: g.name, Offset: symbolTable.table[g.name]})
+	}
+	for _, sym := range symbolTable.Symbols() {
+		if sym.Kind == SymbolLabel && !exported[sym.Name] {
+			obj.Locals = append(obj.Locals, ObjectSymbol{Name: sym.Name, Offset: sym.Value})
+		}
+	}
+	for _, e := range externs {
+		if symbolTable.labels[e.name] {
+			diags = append(diags, e.origin.diagnostic(1, "extern symbol %s is a label of this file", e.name))
+			continue
+		}
+		if !slices.Contains(obj.Imports, e.name) {
+			obj.Imports = append(obj.Imports, e.name)
+		}
+	}
+	return diags
+}
+
+// relocatable evaluates the value of an A instruction. If the value refers to a label or a variable, it returns a relocation of the symbol and 0 as the word. The address of the relocation is not set. The form of the expression decides whether it is relocatable: the symbol must be the first term, followed by the end of the expression, "+" or "-".
+func relocatable(symOrConst SymbolOrConstant, symbolTable *SymbolTable) (uint16, *Relocation, error) {
+	if isConst(symOrConst) {
+		code, err := decimalToBinary(string(symOrConst))
+		if err != nil {
+			return 0, nil, err
+		}
+		return code.word(), nil, nil
+	}
+
+	s := string(symOrConst)
+	end := 0
+	for end < len(s) && isSymbolChar(rune(s[end])) {
+		end++
+	}
+	first := SymbolOrConstant(s[:end])
+	if _, ok := predefinedSymbols[first]; ok || !isValidSymbol(first) || end < len(s) && s[end] != '+' && s[end] != '-' {
+		first = ""
+	}
+	// the value with the first symbol as 0 is the addend. Any other use of a relocatable symbol makes the expression not relocatable
+	uses := 0
+	var other SymbolOrConstant
+	addend, err := evalExpression(s, func(sym SymbolOrConstant) (int, error) {
+		if val, ok := predefinedSymbols[sym]; ok {
+			return val, nil
+		}
+		if !isValidSymbol(sym) {
+			return 0, fmt.Errorf("invalid symbol %q", sym)
+		}
+		if sym == first {
+			uses++
+		} else if other == "" {
+			other = sym
+		}
+		return 0, nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	switch {
+	case first != "" && other != "":
+		return 0, nil, fmt.Errorf("expression %q refers to more than one relocatable symbol", symOrConst)
+	case other != "" || uses > 1:
+		return 0, nil, fmt.Errorf("expression %q is not relocatable: want SYMBOL, SYMBOL+constant or SYMBOL-constant", symOrConst)
+	case first == "":
+		code, err := intToBinary(addend)
+		if err != nil {
+			return 0, nil, err
+		}
+		return code.word(), nil, nil
+	}
+	return 0, &Relocation{Symbol: first, Addend: addend}, nil
+}
+
+// Link combines the objects into one program. The objects are placed in ROM in the given order, so the first object has the entry point. Exported labels must be unique among all objects and every import must be exported by an object. A relocation refers to a label of its own object first and then to an import. The other symbols become variables shared by all objects, but a symbol that another object exports must be imported. The result has the exported labels and the variables as its symbol table and has no source map.
+func Link(objects []Object) (Result, error) {
+	symbolTable := NewSymbolTable()
+	var errs []error
+	bases := make([]int, len(objects))
+	size := 0
+	for i, obj := range objects {
+		bases[i] = size
+		size += len(obj.Code)
+		for _, sym := range obj.Exports {
+			if err := symbolTable.addLabel(sym.Name, bases[i]+sym.Offset); err != nil {
+				errs = append(errs, fmt.Errorf("link %s: %w", obj.name(i), err))
+			}
+		}
+	}
+	for i, obj := range objects {
+		for _, name := range obj.Imports {
+			if !symbolTable.labels[name] {
+				errs = append(errs, fmt.Errorf("link %s: undefined symbol %s is imported but not exported by any object", obj.name(i), name))
+			}
+		}
+	}
+	if size > romSize {
+		errs = append(errs, fmt.Errorf("link: program of %d instructions exceeds ROM size %d", size, romSize))
+	}
+	if len(errs) > 0 {
+		return Result{}, errors.Join(errs...)
+	}
+
+	ws := make([]uint16, 0, size)
+	for i, obj := range objects {
+		code := slices.Clone(obj.Code)
+		labels := map[SymbolOrConstant]int{}
+		for _, sym := range slices.Concat(obj.Locals, obj.Exports) {
+			labels[sym.Name] = bases[i] + sym.Offset
+		}
+		for _, r := range obj.Relocations {
+			if r.Address < 0 || r.Address >= len(code) {
+				errs = append(errs, fmt.Errorf("link %s: relocation address %d is out of the code", obj.name(i), r.Address))
+				continue
+			}
+			value, ok := labels[r.Symbol]
+			if !ok {
+				if symbolTable.labels[r.Symbol] && !slices.Contains(obj.Imports, r.Symbol) {
+					errs = append(errs, fmt.Errorf("link %s: %s is a label of another object but is not declared with .extern", obj.name(i), r.Symbol))
+					continue
+				}
+				var err error
+				if value, err = symbolTable.resolve(r.Symbol); err != nil {
+					errs = append(errs, fmt.Errorf("link %s: %w", obj.name(i), err))
+					continue
+				}
+			}
+			if value+r.Addend < 0 || value+r.Addend > 32767 {
+				errs = append(errs, fmt.Errorf("link %s: value %d of %s%+d at %d is out of range 0..32767", obj.name(i), value+r.Addend, r.Symbol, r.Addend, r.Address))
+				continue
+			}
+			code[r.Address] = uint16(value + r.Addend)
+		}
+		ws = append(ws, code...)
+	}
+	if len(errs) > 0 {
+		return Result{}, errors.Join(errs...)
+	}
+	return Result{Words: ws, SymbolTable: symbolTable}, nil
+}
+
+// name returns the file name of the object or its index if the name is unknown.
+func (obj Object) name(i int) string {
+	if obj.File != "" {
+		return obj.File
+	}
+	return fmt.Sprintf("object %d", i)
+}
+
+// WriteObject writes the object as JSON.
+func WriteObject(w io.Writer, obj Object) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(obj)
+}
+
+// ReadObject reads an object written by [WriteObject].
+func ReadObject(r io.Reader) (Object, error) {
+	var obj Object
+	if err := json.NewDecoder(r).Decode(&obj); err != nil {
+		return Object{}, fmt.Errorf("read object: %w", err)
+	}
+	if obj.Version != ObjectVersion {
+		return Object{}, fmt.Errorf("read object: unsupported version %d", obj.Version)
+	}
+	return obj, nil
+}
+
+// ReadObjectFromFile reads an object from the given file. If the file is an assembly file, it is assembled to an object.
+func ReadObjectFromFile(fileName string) (Object, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return Object{}, err
+	}
+	defer f.Close()
+	if strings.HasSuffix(fileName, ".asm") {
+		return AssembleObject(f, Options{FileName: fileName})
+	}
+	return ReadObject(f)
+}
+
+// LinkFiles links the object or assembly files into one binary code file in the given format.
+func LinkFiles(fileNames []string, hackFile io.Writer, format Format) error {
+	objects := make([]Object, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		obj, err := ReadObjectFromFile(fileName)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, obj)
+	}
+	result, err := Link(objects)
+	if err != nil {
+		return err
+	}
+	return WriteWords(hackFile, result.Words, format)
+}
@@ -0,0 +1,216 @@
+package hack
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAssembleObject(t *testing.T) {
+	asmCode := `.global MAIN
+.extern MULT
+(MAIN)
+@n
+M=1
+@MULT
+0;JMP
+@SCREEN+1
+@MAIN+4-2
+(END)
+@END
+`
+	obj, err := AssembleObject(strings.NewReader(asmCode), Options{FileName: "Main.asm"})
+	if err != nil {
+		t.Fatalf("AssembleObject failed: %v", err)
+	}
+	expected := Object{
+		Version: ObjectVersion,
+		File:    "Main.asm",
+		Code:    []uint16{0, 0xEFC8, 0, 0xEA87, 16385, 0, 0},
+		Exports: []ObjectSymbol{{Name: "MAIN", Offset: 0}},
+		Locals:  []ObjectSymbol{{Name: "END", Offset: 6}},
+		Imports: []SymbolOrConstant{"MULT"},
+		Relocations: []Relocation{
+			{Address: 0, Symbol: "n"},
+			{Address: 2, Symbol: "MULT"},
+			{Address: 5, Symbol: "MAIN", Addend: 2},
+			{Address: 6, Symbol: "END"},
+		},
+	}
+	if diff := cmp.Diff(expected, obj); diff != "" {
+		t.Errorf("AssembleObject mismatch (-want +got):\n%s", diff)
+	}
+
+	// round trip
+	buf := &bytes.Buffer{}
+	if err := WriteObject(buf, obj); err != nil {
+		t.Fatalf("WriteObject failed: %v", err)
+	}
+	got, err := ReadObject(buf)
+	if err != nil {
+		t.Fatalf("ReadObject failed: %v", err)
+	}
+	if diff := cmp.Diff(obj, got); diff != "" {
+		t.Errorf("ReadObject mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := ReadObject(strings.NewReader(`{"version": 1}`)); err == nil {
+		t.Errorf("ReadObject expected an error for an unsupported version")
+	}
+}
+
+func TestAssembleObjectErrors(t *testing.T) {
+	asmCode := `@LOOP*2
+@a+b
+@0x8000
+.global x
+.extern LOOP
+.global
+.extern SP
+(LOOP)
+@LOOP/4096*4096
+@LOOP+LOOP
+@2+LOOP
+`
+	expected := Diagnostics{
+		{Pos: Position{"Lib.asm", 1, 2}, Message: `expression "LOOP*2" is not relocatable: want SYMBOL, SYMBOL+constant or SYMBOL-constant`},
+		{Pos: Position{"Lib.asm", 2, 2}, Message: `expression "a+b" refers to more than one relocatable symbol`},
+		{Pos: Position{"Lib.asm", 3, 2}, Message: `constant 32768 is out of range 0..32767`},
+		{Pos: Position{"Lib.asm", 4, 1}, Message: `global symbol x is not a label of this file`},
+		{Pos: Position{"Lib.asm", 5, 1}, Message: `extern symbol LOOP is a label of this file`},
+		{Pos: Position{"Lib.asm", 6, 1}, Message: `invalid .global: want .global NAME`},
+		{Pos: Position{"Lib.asm", 7, 1}, Message: `.extern SP conflicts with the predefined symbol`},
+		{Pos: Position{"Lib.asm", 9, 2}, Message: `expression "LOOP/4096*4096" is not relocatable: want SYMBOL, SYMBOL+constant or SYMBOL-constant`},
+		{Pos: Position{"Lib.asm", 10, 2}, Message: `expression "LOOP+LOOP" is not relocatable: want SYMBOL, SYMBOL+constant or SYMBOL-constant`},
+		{Pos: Position{"Lib.asm", 11, 2}, Message: `expression "2+LOOP" is not relocatable: want SYMBOL, SYMBOL+constant or SYMBOL-constant`},
+	}
+	_, err := AssembleObject(strings.NewReader(asmCode), Options{FileName: "Lib.asm"})
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("AssembleObject returned %v, want Diagnostics", err)
+	}
+	if diff := cmp.Diff(expected, diags); diff != "" {
+		t.Errorf("AssembleObject diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLink(t *testing.T) {
+	mainCode := `.global MAIN_END
+.extern INC
+@counter
+M=0
+@INC
+0;JMP
+(MAIN_END)
+@MAIN_END
+0;JMP
+`
+	libCode := `.global INC
+.extern MAIN_END
+(INC)
+@counter
+M=M+1
+@tmp
+M=0
+@MAIN_END
+0;JMP
+`
+	var objects []Object
+	for _, code := range []string{mainCode, libCode} {
+		obj, err := AssembleObject(strings.NewReader(code), Options{})
+		if err != nil {
+			t.Fatalf("AssembleObject failed: %v", err)
+		}
+		objects = append(objects, obj)
+	}
+	result, err := Link(objects)
+	if err != nil {
+		t.Fatalf("Link failed: %v", err)
+	}
+
+	// the linked program is the same as the program assembled from one file
+	expected, err := Assemble(strings.NewReader(mainCode+libCode), Options{})
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+	if diff := cmp.Diff(expected.Words, result.Words); diff != "" {
+		t.Errorf("Link mismatch (-want +got):\n%s", diff)
+	}
+	if sym, ok := result.SymbolTable.Lookup("INC"); !ok || sym.Value != 6 {
+		t.Errorf("Lookup(INC) = %v, %v, want 6", sym, ok)
+	}
+	if sym, ok := result.SymbolTable.Lookup("tmp"); !ok || sym.Kind != SymbolVariable || sym.Value != 17 {
+		t.Errorf("Lookup(tmp) = %v, %v, want variable 17", sym, ok)
+	}
+}
+
+// TestLinkLocalLabels tests that the labels that are not exported do not conflict among objects.
+func TestLinkLocalLabels(t *testing.T) {
+	mainCode := `.extern WAIT
+@WAIT
+0;JMP
+(LOOP)
+@LOOP
+0;JMP
+`
+	libCode := `.global WAIT
+(WAIT)
+@LOOP
+0;JMP
+(LOOP)
+@END
+0;JMP
+(END)
+`
+	var objects []Object
+	for i, code := range []string{mainCode, libCode} {
+		obj, err := AssembleObject(strings.NewReader(code), Options{FileName: []string{"Main.asm", "Lib.asm"}[i]})
+		if err != nil {
+			t.Fatalf("AssembleObject failed: %v", err)
+		}
+		objects = append(objects, obj)
+	}
+	result, err := Link(objects)
+	if err != nil {
+		t.Fatalf("Link failed: %v", err)
+	}
+	// Main.asm: WAIT=4, LOOP=2. Lib.asm at 4: LOOP=6, END=8
+	expected := []uint16{4, 0xEA87, 2, 0xEA87, 6, 0xEA87, 8, 0xEA87}
+	if diff := cmp.Diff(expected, result.Words); diff != "" {
+		t.Errorf("Link mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := result.SymbolTable.Lookup("LOOP"); ok {
+		t.Errorf("Lookup(LOOP) found a local label")
+	}
+
+	// an import that no object exports is an error instead of a variable
+	if _, err := Link(objects[:1]); err == nil || !strings.Contains(err.Error(), "undefined symbol WAIT") {
+		t.Errorf("Link = %v, want an undefined symbol error", err)
+	}
+	// a label of another object must be imported
+	noExtern, err := AssembleObject(strings.NewReader("@WAIT\n0;JMP\n"), Options{FileName: "NoExtern.asm"})
+	if err != nil {
+		t.Fatalf("AssembleObject failed: %v", err)
+	}
+	if _, err := Link([]Object{noExtern, objects[1]}); err == nil || !strings.Contains(err.Error(), "WAIT is a label of another object") {
+		t.Errorf("Link = %v, want an error for a label used without .extern", err)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	a := Object{Version: ObjectVersion, File: "a.hobj", Code: []uint16{0}, Exports: []ObjectSymbol{{Name: "START", Offset: 0}}}
+	b := Object{Version: ObjectVersion, File: "b.hobj", Code: []uint16{0}, Exports: []ObjectSymbol{{Name: "START", Offset: 0}}}
+	if _, err := Link([]Object{a, b}); err == nil || !strings.Contains(err.Error(), "START is already defined") {
+		t.Errorf("Link = %v, want a duplicate label error", err)
+	}
+	c := Object{Version: ObjectVersion, Code: []uint16{0}, Relocations: []Relocation{{Address: 0, Symbol: "x", Addend: -17}}}
+	if _, err := Link([]Object{c}); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("Link = %v, want an out of range error", err)
+	}
+	d := Object{Version: ObjectVersion, Code: []uint16{0}, Relocations: []Relocation{{Address: 1, Symbol: "x"}}}
+	if _, err := Link([]Object{d}); err == nil {
+		t.Errorf("Link expected an error for a relocation out of the code")
+	}
+}
@@ -0,0 +1,257 @@
+package hack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+optimizer.go is a peephole optimizer for Hack assembly. It repeats the following rewrites until nothing changes.
+
+  - An A instruction that loads the value already in A is removed. Example: @SP M=M+1 @SP M=M-1 -> @SP M=M+1 M=M-1
+  - An instruction that only writes A is removed if the next instruction is an A instruction. Example: @R13 @SP -> @SP
+  - M=M+1 followed by dest=M-1 (or M=M-1 followed by dest=M+1) is collapsed to dest=M without M. Example: M=M+1 M=M-1 -> (nothing), M=M+1 AM=M-1 -> A=M
+  - A jump to the label right after it is removed. The A instruction of the jump is also removed if A is loaded again after the label.
+
+Labels are kept. A label ends every rewrite because the code after it can be reached from anywhere. An A instruction that is the first use of a symbol is never removed, so variables get the same addresses as without the optimizer.
+*/
+
+// OptimizeReport is a struct that represents the number of instructions before and after the optimization.
+type OptimizeReport struct {
+	Before int
+	After  int
+}
+
+// Saved returns the number of removed instructions.
+func (r OptimizeReport) Saved() int {
+	return r.Before - r.After
+}
+
+// String returns the report. Example: "optimized 120 -> 100 instructions (saved 20)"
+func (r OptimizeReport) String() string {
+	return fmt.Sprintf("optimized %d -> %d instructions (saved %d)", r.Before, r.After, r.Saved())
+}
+
+// asmLine is a struct that represents an instruction or a label of a program to optimize.
+type asmLine struct {
+	inst     Instruction     // the instruction without spaces
+	typ      InstructionType // the type of the instruction
+	text     string          // the source line without surrounding spaces
+	origin   lineOrigin      // where the source line comes from
+	firstUse bool            // true if the line is an A instruction whose symbol is not used before
+}
+
+// Optimize removes redundant instructions from the assembly file and writes the result to out. Macros are expanded, and comments and empty lines are removed. If the assembly file has problems in its macros or has data directives, it returns [Diagnostics].
+func Optimize(asmFile io.Reader, out io.Writer) (OptimizeReport, error) {
+	buf, origins, data, diags := preprocess(asmFile, Options{})
+	for _, b := range data {
+		// the optimized text has the initialization code but not the directives
+		diags = append(diags, b.origin.diagnostic(1, "data %s cannot be written back as text", b.name))
+	}
+	if err := diags.Err(); err != nil {
+		return OptimizeReport{}, err
+	}
+	lines := readAsmLines(buf, origins)
+	optimized := peephole(lines)
+	bw := bufio.NewWriter(out)
+	for _, l := range optimized {
+		fmt.Fprintln(bw, l.text)
+	}
+	return newOptimizeReport(lines, optimized), bw.Flush()
+}
+
+// optimize applies the peephole optimizer to the preprocessed program. It returns the optimized program and the origin of each line.
+func optimize(buf []byte, origins []lineOrigin) ([]byte, []lineOrigin, OptimizeReport) {
+	lines := readAsmLines(buf, origins)
+	optimized := peephole(lines)
+	var out bytes.Buffer
+	optimizedOrigins := make([]lineOrigin, 0, len(optimized))
+	for _, l := range optimized {
+		fmt.Fprintln(&out, l.text)
+		optimizedOrigins = append(optimizedOrigins, l.origin)
+	}
+	return out.Bytes(), optimizedOrigins, newOptimizeReport(lines, optimized)
+}
+
+// newOptimizeReport counts the instructions of the program before and after the optimization.
+func newOptimizeReport(before, after []asmLine) OptimizeReport {
+	count := func(lines []asmLine) int {
+		n := 0
+		for _, l := range lines {
+			if l.typ != L_Instruction {
+				n++
+			}
+		}
+		return n
+	}
+	return OptimizeReport{Before: count(before), After: count(after)}
+}
+
+// readAsmLines reads the instructions and labels of the program. Comments and empty lines are skipped.
+func readAsmLines(buf []byte, origins []lineOrigin) []asmLine {
+	p := Parser{scanner: bufio.NewScanner(bytes.NewReader(buf)), origins: origins}
+	var lines []asmLine
+	for p.advance() {
+		lines = append(lines, asmLine{inst: p.currentInstruction, typ: p.currentType, text: strings.TrimSpace(p.scanner.Text()), origin: p.origin()})
+	}
+	return lines
+}
+
+// peephole repeats the rewrites until nothing changes.
+func peephole(lines []asmLine) []asmLine {
+	labels := map[SymbolOrConstant]bool{}
+	for _, l := range lines {
+		if l.typ == L_Instruction {
+			labels[l.operand()] = true
+		}
+	}
+	for changed := true; changed; {
+		lines, changed = peepholeOnce(lines, labels)
+	}
+	return lines
+}
+
+// peepholeOnce applies the rewrites to the program once. It returns true if the program is changed.
+func peepholeOnce(in []asmLine, labels map[SymbolOrConstant]bool) ([]asmLine, bool) {
+	seen := map[SymbolOrConstant]bool{}
+	for i := range in {
+		if in[i].typ == A_Instruction {
+			in[i].firstUse = !seen[in[i].operand()]
+			seen[in[i].operand()] = true
+		}
+	}
+
+	var out []asmLine
+	changed := false
+	// known is the symbol or constant in A. It is empty if A is unknown
+	var known SymbolOrConstant
+	// last returns the previous line if it is an instruction
+	last := func() (asmLine, bool) {
+		if len(out) == 0 || out[len(out)-1].typ == L_Instruction {
+			return asmLine{}, false
+		}
+		return out[len(out)-1], true
+	}
+	for i, l := range in {
+		switch l.typ {
+		case L_Instruction:
+			known = ""
+			out = append(out, l)
+		case A_Instruction:
+			if l.operand() == known {
+				changed = true
+				continue
+			}
+			if prev, ok := last(); ok && prev.writesOnlyA() && prev.removable(labels) {
+				out = out[:len(out)-1]
+				changed = true
+			}
+			out = append(out, l)
+			known = l.operand()
+		case C_Instruction:
+			dest, comp, jump := l.fields()
+			prev, hasPrev := last()
+			// jump to the next instruction
+			if hasPrev && prev.typ == A_Instruction && dest == "null" && jump != "null" && jumpsToNext(in[i+1:], prev.operand()) {
+				if next := nextInstruction(in[i+1:]); next != nil && next.typ == A_Instruction && prev.removable(labels) {
+					out = out[:len(out)-1]
+					known = ""
+				}
+				changed = true
+				continue
+			}
+			// push and pop of the same address
+			if hasPrev && jump == "null" && strings.Contains(string(dest), "M") && cancels(prev, comp) {
+				out = out[:len(out)-1]
+				changed = true
+				rest := strings.Replace(string(dest), "M", "", 1)
+				if rest == "" {
+					continue
+				}
+				l.inst = Instruction(rest + "=M")
+				l.text = string(l.inst)
+				dest = Mnemonic(rest)
+			}
+			if strings.Contains(string(dest), "A") {
+				known = ""
+			}
+			out = append(out, l)
+		}
+	}
+	return out, changed
+}
+
+// operand returns the symbol or constant of an A instruction or the label of an L instruction.
+func (l asmLine) operand() SymbolOrConstant {
+	p := Parser{currentInstruction: l.inst, currentType: l.typ}
+	s, _ := p.symbol()
+	return s
+}
+
+// fields returns the dest, comp and jump mnemonics of a C instruction.
+func (l asmLine) fields() (Mnemonic, Mnemonic, Mnemonic) {
+	p := Parser{currentInstruction: l.inst, currentType: C_Instruction}
+	dest, _ := p.dest()
+	comp, _ := p.comp()
+	jump, _ := p.jump()
+	return dest, comp, jump
+}
+
+// writesOnlyA returns true if the instruction has no effect other than writing A. Example: @SP, A=M
+func (l asmLine) writesOnlyA() bool {
+	if l.typ == A_Instruction {
+		return true
+	}
+	dest, _, jump := l.fields()
+	return l.typ == C_Instruction && dest == "A" && jump == "null"
+}
+
+// removable returns true if removing the instruction does not change the addresses of variables.
+func (l asmLine) removable(labels map[SymbolOrConstant]bool) bool {
+	if l.typ != A_Instruction || !l.firstUse {
+		return true
+	}
+	s := l.operand()
+	_, predefined := predefinedSymbols[s]
+	return isConst(s) || predefined || labels[s]
+}
+
+// cancels returns true if prev is M=M+1 and comp is M-1, or prev is M=M-1 and comp is M+1.
+func cancels(prev asmLine, comp Mnemonic) bool {
+	if prev.typ != C_Instruction {
+		return false
+	}
+	switch prev.inst {
+	case "M=M+1":
+		return comp == "M-1"
+	case "M=M-1":
+		return comp == "M+1"
+	}
+	return false
+}
+
+// jumpsToNext returns true if the given label is one of the labels at the beginning of rest.
+func jumpsToNext(rest []asmLine, label SymbolOrConstant) bool {
+	for _, l := range rest {
+		if l.typ != L_Instruction {
+			return false
+		}
+		if l.operand() == label {
+			return true
+		}
+	}
+	return false
+}
+
+// nextInstruction returns the first A or C instruction in rest or nil if there is none.
+func nextInstruction(rest []asmLine) *asmLine {
+	for i := range rest {
+		if rest[i].typ != L_Instruction {
+			return &rest[i]
+		}
+	}
+	return nil
+}
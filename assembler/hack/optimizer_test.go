@@ -0,0 +1,60 @@
+package hack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"redundant A load", "@SP\nM=M+1\n@SP\nD=M\n", "@SP\nM=M+1\nD=M\n"},
+		{"dead A load", "@R13\n@SP\nD=M\n", "@SP\nD=M\n"},
+		{"dead A write", "@SP\nA=M\n@5\nD=A\n", "@5\nD=A\n"},
+		{"push and pop", "@SP\nA=M\nM=D\n@SP\nM=M+1\n@SP\nM=M-1\nA=M\nD=M\n", "@SP\nA=M\nM=D\n@SP\nA=M\nD=M\n"},
+		{"push and pop to A", "@SP\nM=M+1\n@SP\nAM=M-1\nD=M\n", "@SP\nA=M\nD=M\n"},
+		{"jump to the next instruction", "D=1\n@NEXT\n0;JMP\n(NEXT)\n@5\nD=A\n", "D=1\n(NEXT)\n@5\nD=A\n"},
+		{"jump to the next C instruction", "@NEXT\nD;JGT\n(NEXT)\nD=A\n", "@NEXT\n(NEXT)\nD=A\n"},
+		{"labels end rewrites", "@SP\nM=M+1\n(L)\n@SP\nM=M-1\n@L\n0;JMP\n", "@SP\nM=M+1\n(L)\n@SP\nM=M-1\n@L\n0;JMP\n"},
+		{"first use of a variable", "@x\n@y\nM=1\n@x\nM=1\n", "@x\n@y\nM=1\n@x\nM=1\n"},
+		{"comments and macros", "// push 1\n#macro ONE\n@1\n#endmacro\nONE\nONE\nD=A\n", "@1\nD=A\n"},
+	}
+	for _, test := range tests {
+		out := &bytes.Buffer{}
+		report, err := Optimize(strings.NewReader(test.input), out)
+		if err != nil {
+			t.Fatalf("%s: Optimize failed: %v", test.name, err)
+		}
+		if diff := cmp.Diff(test.expected, out.String()); diff != "" {
+			t.Errorf("%s: Optimize mismatch (-want +got):\n%s", test.name, diff)
+		}
+		after := strings.Count(test.expected, "\n") - strings.Count(test.expected, "(")
+		if report.After != after {
+			t.Errorf("%s: report.After = %d, want %d", test.name, report.After, after)
+		}
+	}
+}
+
+func TestHackOptimize(t *testing.T) {
+	asmCode := "@SP\nM=M+1\n@SP\nM=M-1\n@i\nM=1\n"
+	result, err := Assemble(strings.NewReader(asmCode), Options{Optimize: true})
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+	if expected := (OptimizeReport{Before: 6, After: 2}); result.Optimized != expected {
+		t.Errorf("Optimized = %+v, want %+v", result.Optimized, expected)
+	}
+	expected := []uint16{0x0010, 0xEFC8}
+	if diff := cmp.Diff(expected, result.Words); diff != "" {
+		t.Errorf("Words mismatch (-want +got):\n%s", diff)
+	}
+	if got := result.Optimized.String(); got != "optimized 6 -> 2 instructions (saved 4)" {
+		t.Errorf("String() = %q", got)
+	}
+}
@@ -30,6 +30,9 @@ type Parser struct {
 	scanner            *bufio.Scanner
 	currentInstruction Instruction
 	currentType        InstructionType
+	lineNum            int          // the 1-based line number of the current instruction
+	origins            []lineOrigin // the origin of each line if the input is preprocessed
+	isa                *ISA         // the instruction set of the C instructions. nil means the standard Hack instruction set
 }
 
 func NewParser(scanner *bufio.Scanner) *Parser {
@@ -44,6 +47,7 @@ func (p *Parser) advance() bool {
 	if !ok {
 		return false
 	}
+	p.lineNum++
 	line := p.text()
 	if isEmptyLine(line) || isCommentLine(line) {
 		// skip empty or comment line
@@ -55,10 +59,45 @@ func (p *Parser) advance() bool {
 	return true
 }
 
-// text returns the current instruction. It removes all spaces from the instruction
+// text returns the current instruction. It removes the trailing comment and all spaces from the instruction
 func (p *Parser) text() string {
-	// remove spaces
-	return strings.ReplaceAll(p.scanner.Text(), " ", "")
+	code, _, _ := strings.Cut(p.scanner.Text(), "//")
+	return removeSpaces(code)
+}
+
+// origin returns the origin of the current line.
+func (p *Parser) origin() lineOrigin {
+	if p.lineNum-1 < len(p.origins) {
+		return p.origins[p.lineNum-1]
+	}
+	return lineOrigin{pos: Position{Line: p.lineNum, Column: 1}}
+}
+
+// column returns the column of the character at the given offset in the current instruction. The offset is counted in the instruction without spaces. Example: for "  D = M", offset 2 ("M") -> column 7
+func (p *Parser) column(offset int) int {
+	raw := p.scanner.Text()
+	for i, c := range raw {
+		if c == ' ' || c == '\t' {
+			continue
+		}
+		if offset == 0 {
+			return i + 1
+		}
+		offset--
+	}
+	return 1
+}
+
+// pos returns the position of the character at the given offset in the current instruction.
+func (p *Parser) pos(offset int) Position {
+	pos := p.origin().pos
+	pos.Column = p.column(offset)
+	return pos
+}
+
+// errorf adds a diagnostic at the given offset of the current instruction to diags.
+func (p *Parser) errorf(diags *Diagnostics, offset int, format string, args ...any) {
+	*diags = append(*diags, p.origin().diagnostic(p.column(offset), format, args...))
 }
 
 // isEmptyLine returns true if the given line is empty
@@ -68,7 +107,7 @@ func isEmptyLine(line string) bool {
 
 // isCommentLine returns true if the given line is a comment
 func isCommentLine(line string) bool {
-	return line[0:2] == "//"
+	return strings.HasPrefix(line, "//")
 }
 
 // isConst returns true if the given SymbolOrConstant is a constant
@@ -77,6 +116,31 @@ func isConst(s SymbolOrConstant) bool {
 	return err == nil
 }
 
+// isValidSymbol returns true if the given symbol is a sequence of letters, digits, "_", ".", "$" and ":" that does not begin with a digit
+func isValidSymbol(s SymbolOrConstant) bool {
+	if len(s) == 0 || '0' <= s[0] && s[0] <= '9' {
+		return false
+	}
+	for _, c := range s {
+		if !isSymbolChar(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isSymbolChar returns true if the given character can be used in a symbol
+func isSymbolChar(c rune) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	case c == '_', c == '.', c == '$', c == ':':
+		return true
+	}
+	return false
+}
+
+// getInstructionType returns the type of the given instruction
 func getInstructionType(inst Instruction) InstructionType {
 	switch {
 	case inst[0] == '@':
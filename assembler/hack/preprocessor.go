@@ -0,0 +1,403 @@
+package hack
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+preprocessor expands the directives of an assembly file before the label pass.
+
+Macros are defined with #macro and #endmacro. Parameters are referenced with "%name" in the body and local labels are written as "%%name". Each expansion gives the local labels a unique name "MACRO$name.N".
+
+	#macro PUSH_CONST value
+	@%value
+	D=A
+	@SP
+	A=M
+	M=D
+	@SP
+	M=M+1
+	#endmacro
+
+	PUSH_CONST 7
+
+A macro is called by writing its name as the first word of a line followed by comma separated arguments.
+
+Another file is inserted with #include. The path is relative to the directory of the including file, and the lines of the included file keep their own positions. A file that includes itself directly or through other files is an error.
+
+	#include "lib/Math.asm"
+*/
+
+// maxExpansionDepth is the maximum depth of nested macro calls. It stops recursive macros.
+const maxExpansionDepth = 64
+
+// lineOrigin is a struct that represents where a preprocessed line comes from.
+type lineOrigin struct {
+	pos       Position   // the position of the line in its file. Column is always 1
+	expansion []Position // the macro call sites the line was expanded from, innermost first
+}
+
+// diagnostic returns a diagnostic at the given column of the line.
+func (o lineOrigin) diagnostic(column int, format string, args ...any) Diagnostic {
+	pos := o.pos
+	pos.Column = column
+	return Diagnostic{Pos: pos, Message: fmt.Sprintf(format, args...), Expansion: o.expansion}
+}
+
+// sourceLine is a struct that represents a line of an assembly file and its origin.
+type sourceLine struct {
+	text   string
+	origin lineOrigin
+}
+
+// macro is a struct that represents a macro definition.
+type macro struct {
+	name   string
+	params []string
+	body   []sourceLine
+	pos    Position
+}
+
+// preprocessor is a struct that expands directives line by line. The expanded lines are written to out and the origin of each written line is appended to origins. If sink is not nil, the expanded lines are passed to it instead, so nothing is kept.
+type preprocessor struct {
+	macros       map[string]*macro
+	defining     *macro // the macro whose body is being read
+	expansions   int    // for generating unique local labels
+	out          io.Writer
+	origins      []lineOrigin
+	sink         func(sourceLine)
+	files        []string // the files being processed, the outermost first. It is used to detect include cycles
+	defines      map[string]string
+	conditionals []conditional   // the open conditional blocks, the outermost first
+	outer        int             // the number of conditional blocks opened outside the current file or macro expansion. They cannot be switched or closed inside it
+	data         []dataBlock     // the blocks of the data directives
+	globals      []linkageSymbol // the symbols exported by .global
+	externs      []linkageSymbol // the symbols imported by .extern
+	dataEmitted  bool            // true if the initialization code is passed to sink
+	isa          *ISA            // the instruction set whose C instructions cannot be macro names
+	diags        Diagnostics
+}
+
+func newPreprocessor(out io.Writer) *preprocessor {
+	return &preprocessor{
+		macros:  map[string]*macro{},
+		defines: map[string]string{},
+		out:     out,
+	}
+}
+
+// configure applies the options to the preprocessor: the instruction set, the defines and the macro files.
+func (pp *preprocessor) configure(opts Options) {
+	pp.isa = opts.ISA
+	for name, value := range opts.Defines {
+		if !isValidSymbol(SymbolOrConstant(name)) {
+			pp.diags.add(Position{File: opts.FileName}, "invalid define name %q", name)
+			continue
+		}
+		// a value is one word like the value of #define in a file, and it cannot start a comment
+		if value != "" && (strings.ContainsFunc(value, unicode.IsSpace) || strings.Contains(value, "//")) {
+			pp.diags.add(Position{File: opts.FileName}, "invalid value %q of define %s: want one word without a comment", value, name)
+			continue
+		}
+		pp.defines[name] = value
+	}
+	for _, macroFile := range opts.MacroFiles {
+		pp.loadMacroFile(macroFile)
+	}
+}
+
+// process reads an assembly file line by line and expands it. fileName is used in the positions of the lines.
+func (pp *preprocessor) process(asmFile io.Reader, fileName string) {
+	pp.files = append(pp.files, filepath.Clean(fileName))
+	defer func() { pp.files = pp.files[:len(pp.files)-1] }()
+	outer := pp.outer
+	pp.outer = len(pp.conditionals)
+	scanner := bufio.NewScanner(asmFile)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		pp.line(sourceLine{
+			text:   scanner.Text(),
+			origin: lineOrigin{pos: Position{File: fileName, Line: lineNum, Column: 1}},
+		}, 0)
+	}
+	if err := scanner.Err(); err != nil {
+		pp.diags.add(Position{File: fileName}, "%v", err)
+	}
+	if m := pp.defining; m != nil {
+		pp.diags.add(m.pos, "macro %s is not closed with #endmacro", m.name)
+		pp.defining = nil
+	}
+	pp.closeConditionals()
+	pp.outer = outer
+}
+
+// loadMacroFile reads macro definitions from the given file. The file must not contain instructions.
+func (pp *preprocessor) loadMacroFile(fileName string) {
+	macroFile, err := os.Open(fileName)
+	if err != nil {
+		pp.diags.add(Position{File: fileName}, "%v", err)
+		return
+	}
+	defer macroFile.Close()
+
+	out, origins, sink := pp.out, pp.origins, pp.sink
+	var buf strings.Builder
+	pp.out, pp.origins, pp.sink = &buf, nil, nil
+	pp.process(macroFile, fileName)
+	for i, line := range strings.Split(buf.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "//") {
+			pp.diags = append(pp.diags, pp.origins[i].diagnostic(1, "macro file must contain only macro definitions"))
+		}
+	}
+	pp.out, pp.origins, pp.sink = out, origins, sink
+}
+
+// emit writes the line to the output.
+func (pp *preprocessor) emit(l sourceLine) {
+	if pp.sink != nil {
+		// the initialization code of the data goes before the first instruction
+		if code, _, _ := cutComment(l.text); strings.TrimSpace(code) != "" {
+			pp.flushData()
+		}
+		pp.sink(l)
+		return
+	}
+	io.WriteString(pp.out, l.text+"\n")
+	pp.origins = append(pp.origins, l.origin)
+}
+
+// errorf adds a diagnostic at the beginning of the line.
+func (pp *preprocessor) errorf(l sourceLine, format string, args ...any) {
+	pp.diags = append(pp.diags, l.origin.diagnostic(1, format, args...))
+}
+
+// line processes a line. depth is the depth of the macro call that produced the line.
+func (pp *preprocessor) line(l sourceLine, depth int) {
+	code, _, _ := cutComment(l.text)
+	fields := strings.Fields(code)
+
+	if m := pp.defining; m != nil {
+		switch {
+		case len(fields) > 0 && fields[0] == "#endmacro":
+			pp.macros[m.name] = m
+			pp.defining = nil
+		case len(fields) > 0 && fields[0] == "#macro":
+			pp.errorf(l, "macro definitions cannot be nested")
+		default:
+			m.body = append(m.body, l)
+		}
+		return
+	}
+
+	if len(fields) > 0 && isConditional(fields[0]) {
+		pp.conditional(l, fields)
+		return
+	}
+	if !pp.active() {
+		// the line is in a disabled branch
+		return
+	}
+	if len(fields) == 0 {
+		pp.emit(l)
+		return
+	}
+	switch fields[0] {
+	case "#macro":
+		pp.defineMacro(l, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(code), "#macro")))
+	case "#endmacro":
+		pp.errorf(l, "#endmacro without #macro")
+	case "#include":
+		pp.include(l, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(code), "#include")))
+	case "#define":
+		pp.define(l, fields)
+	case ".data", ".word", ".string":
+		pp.dataDirective(l, fields[0], strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(code), fields[0])))
+	case ".global", ".extern":
+		pp.linkageDirective(l, fields)
+	default:
+		l.text = pp.replaceDefines(l.text)
+		code, _, _ = cutComment(l.text)
+		fields = strings.Fields(code)
+		// a define can rewrite the line to nothing or to a comment
+		if len(fields) == 0 {
+			pp.emit(l)
+			return
+		}
+		if m, ok := pp.macros[fields[0]]; ok {
+			args := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(code), fields[0]))
+			pp.expand(m, l, args, depth)
+			return
+		}
+		pp.emit(l)
+	}
+}
+
+// cutComment slices the line around its comment like strings.Cut(text, "//"), but "//" in a quoted string is not a comment, so the text of .string and #include is kept. Example: `.string url "a//b" // link` -> `.string url "a//b" `, " link", true
+func cutComment(text string) (code, comment string, found bool) {
+	inQuote := false
+	for i := 0; i < len(text); i++ {
+		switch {
+		case inQuote && text[i] == '\\':
+			i++ // skip the escaped character
+		case text[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && strings.HasPrefix(text[i:], "//"):
+			return text[:i], text[i+2:], true
+		}
+	}
+	return text, "", false
+}
+
+// include processes the file of an #include directive. arg is the text after #include. Example: `"lib/Math.asm"`
+func (pp *preprocessor) include(l sourceLine, arg string) {
+	name, err := strconv.Unquote(arg)
+	if err != nil || !strings.HasPrefix(arg, `"`) || name == "" {
+		pp.errorf(l, `invalid #include %s: want #include "file.asm"`, arg)
+		return
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(l.origin.pos.File), path)
+	}
+	if i := slices.Index(pp.files, path); i != -1 {
+		cycle := append(slices.Clone(pp.files[i:]), path)
+		pp.errorf(l, "include cycle: %s", strings.Join(cycle, " -> "))
+		return
+	}
+	includedFile, err := os.Open(path)
+	if err != nil {
+		pp.errorf(l, "%v", err)
+		return
+	}
+	defer includedFile.Close()
+	pp.process(includedFile, path)
+}
+
+// defineMacro starts a macro definition. header is the text after #macro. Example: "PUSH_CONST value"
+func (pp *preprocessor) defineMacro(l sourceLine, header string) {
+	name, rest := header, ""
+	if i := strings.IndexAny(header, " \t"); i != -1 {
+		name, rest = header[:i], header[i+1:]
+	}
+	m := &macro{name: name, params: splitArgs(rest), pos: l.origin.pos}
+	// the body is read even if the header is invalid so that it is not assembled
+	pp.defining = m
+	switch {
+	case !isValidSymbol(SymbolOrConstant(name)):
+		pp.errorf(l, "invalid macro name %q", name)
+	case isCInstruction(name, pp.isa):
+		pp.errorf(l, "macro name %q is a C instruction", name)
+	case pp.macros[name] != nil:
+		pp.errorf(l, "macro %s is already defined at %v", name, pp.macros[name].pos)
+	}
+	for i, param := range m.params {
+		if !isValidSymbol(SymbolOrConstant(param)) {
+			pp.errorf(l, "invalid macro parameter %q", param)
+		} else if slices.Contains(m.params[:i], param) {
+			pp.errorf(l, "duplicate macro parameter %q", param)
+		}
+	}
+}
+
+// expand writes the body of the macro with the parameters replaced by the arguments.
+func (pp *preprocessor) expand(m *macro, call sourceLine, args string, depth int) {
+	if depth >= maxExpansionDepth {
+		pp.errorf(call, "macro %s is expanded too deeply (recursive macro?)", m.name)
+		return
+	}
+	argList := splitArgs(args)
+	if len(argList) != len(m.params) {
+		pp.errorf(call, "macro %s takes %d arguments but %d were given", m.name, len(m.params), len(argList))
+		return
+	}
+	values := map[string]string{}
+	for i, param := range m.params {
+		values[param] = argList[i]
+	}
+	id := pp.expansions
+	pp.expansions++
+
+	outer := pp.outer
+	pp.outer = len(pp.conditionals)
+	expansion := append([]Position{call.origin.pos}, call.origin.expansion...)
+	for _, body := range m.body {
+		l := sourceLine{origin: lineOrigin{pos: body.origin.pos, expansion: expansion}}
+		text, err := substitute(body.text, m.name, values, id)
+		if err != nil {
+			pp.errorf(l, "%v", err)
+			continue
+		}
+		l.text = text
+		pp.line(l, depth+1)
+	}
+	pp.closeConditionals()
+	pp.outer = outer
+}
+
+// substitute replaces "%param" with its value and "%%label" with a local label unique to the expansion id. Comments are kept as they are. Example: "@%%LOOP" -> "@PUSH$LOOP.3"
+func substitute(text string, macroName string, values map[string]string, id int) (string, error) {
+	code, comment, hasComment := cutComment(text)
+	var b strings.Builder
+	for i := 0; i < len(code); i++ {
+		if code[i] != '%' {
+			b.WriteByte(code[i])
+			continue
+		}
+		local := strings.HasPrefix(code[i:], "%%")
+		start := i + 1
+		if local {
+			start++
+		}
+		end := start
+		for end < len(code) && isSymbolChar(rune(code[end])) {
+			end++
+		}
+		name := code[start:end]
+		switch value, ok := values[name]; {
+		case name == "":
+			return "", fmt.Errorf("missing name after %q", code[i:start])
+		case local:
+			b.WriteString(macroName + "$" + name + "." + strconv.Itoa(id))
+		case ok:
+			b.WriteString(value)
+		default:
+			return "", fmt.Errorf("unknown macro parameter %q", name)
+		}
+		i = end - 1
+	}
+	if hasComment {
+		b.WriteString("//" + comment)
+	}
+	return b.String(), nil
+}
+
+// splitArgs splits comma separated arguments and trims spaces. Example: "a, b" -> ["a", "b"], "" -> []
+func splitArgs(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	args := strings.Split(s, ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	return args
+}
+
+// isCInstruction returns true if the given text is a valid C instruction of the instruction set. Example: "D", "M=D", "0;JMP"
+func isCInstruction(text string, isa *ISA) bool {
+	p := Parser{currentInstruction: Instruction(removeSpaces(text)), currentType: C_Instruction}
+	destMnemonic, _ := p.dest()
+	compMnemonic, _ := p.comp()
+	jumpMnemonic, _ := p.jump()
+	_, destErr := isa.dest(destMnemonic)
+	_, compErr := isa.comp(compMnemonic)
+	_, jumpErr := isa.jump(jumpMnemonic)
+	return destErr == nil && compErr == nil && jumpErr == nil
+}
@@ -0,0 +1,226 @@
+package hack
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPreprocessorMacro(t *testing.T) {
+	asmCode := `#macro PUSH_CONST value
+@%value
+D=A
+@SP
+A=M
+M=D
+@SP
+M=M+1
+#endmacro
+#macro WAIT_KEY
+(%%LOOP)
+@KBD
+D=M
+@%%LOOP
+D;JEQ // 100% busy wait
+#endmacro
+PUSH_CONST 7
+WAIT_KEY
+WAIT_KEY
+`
+	expected := `@7
+D=A
+@SP
+A=M
+M=D
+@SP
+M=M+1
+(WAIT_KEY$LOOP.1)
+@KBD
+D=M
+@WAIT_KEY$LOOP.1
+D;JEQ // 100% busy wait
+(WAIT_KEY$LOOP.2)
+@KBD
+D=M
+@WAIT_KEY$LOOP.2
+D;JEQ // 100% busy wait
+`
+	var buf bytes.Buffer
+	pp := newPreprocessor(&buf)
+	pp.process(strings.NewReader(asmCode), "Prog.asm")
+	if err := pp.diags.Err(); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("process mismatch (-want +got):\n%s", diff)
+	}
+	// the origins point at the macro bodies
+	if got, want := pp.origins[0].pos, (Position{"Prog.asm", 2, 1}); got != want {
+		t.Errorf("origins[0].pos = %v, want %v", got, want)
+	}
+	if got, want := pp.origins[0].expansion, []Position{{"Prog.asm", 17, 1}}; !cmp.Equal(got, want) {
+		t.Errorf("origins[0].expansion = %v, want %v", got, want)
+	}
+}
+
+func TestHackMacro(t *testing.T) {
+	asmCode := `#macro PUSH_D
+@SP
+A=M
+M=D
+@SP
+M=M+1
+#endmacro
+#macro PUSH_CONST value
+@%value
+D=A
+PUSH_D
+#endmacro
+PUSH_CONST 2
+`
+	expected := `0000000000000010
+1110110000010000
+0000000000000000
+1111110000100000
+1110001100001000
+0000000000000000
+1111110111001000
+`
+	testHack(t, asmCode, expected)
+}
+
+func TestHackMacroDiagnostics(t *testing.T) {
+	asmCode := `#macro BAD x
+D=%x
+@%y
+#endmacro
+#macro OUTER
+BAD Q
+#endmacro
+OUTER
+BAD 1, 2
+#endmacro
+#macro REC
+REC
+#endmacro
+#macro D
+#endmacro
+`
+	expected := Diagnostics{
+		{Pos: Position{"Prog.asm", 2, 3}, Message: `invalid comp mnemonic "Q"`, Expansion: []Position{{"Prog.asm", 6, 1}, {"Prog.asm", 8, 1}}},
+		{Pos: Position{"Prog.asm", 3, 1}, Message: `unknown macro parameter "y"`, Expansion: []Position{{"Prog.asm", 6, 1}, {"Prog.asm", 8, 1}}},
+		{Pos: Position{"Prog.asm", 9, 1}, Message: `macro BAD takes 1 arguments but 2 were given`},
+		{Pos: Position{"Prog.asm", 10, 1}, Message: `#endmacro without #macro`},
+		{Pos: Position{"Prog.asm", 14, 1}, Message: `macro name "D" is a C instruction`},
+	}
+	err := HackWithOptions(strings.NewReader(asmCode), &bytes.Buffer{}, Options{FileName: "Prog.asm"})
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("HackWithOptions returned %v, want Diagnostics", err)
+	}
+	if diff := cmp.Diff(expected, diags); diff != "" {
+		t.Errorf("HackWithOptions diagnostics mismatch (-want +got):\n%s", diff)
+	}
+	if !strings.Contains(diags[0].Error(), "Prog.asm:2:3: invalid comp mnemonic \"Q\" (expanded from Prog.asm:6:1, Prog.asm:8:1)") {
+		t.Errorf("Error() = %q", diags[0].Error())
+	}
+
+	// a recursive macro is stopped
+	err = Hack(strings.NewReader("#macro REC\nREC\n#endmacro\nREC\n"), &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "expanded too deeply") {
+		t.Errorf("Hack with a recursive macro returned %v", err)
+	}
+}
+
+func TestHackMacroFile(t *testing.T) {
+	macroFile := filepath.Join(t.TempDir(), "macros.asm")
+	err := os.WriteFile(macroFile, []byte("// stack macros\n#macro INC_SP\n@SP\nM=M+1\n#endmacro\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hackFile := &bytes.Buffer{}
+	err = HackWithOptions(strings.NewReader("INC_SP\n"), hackFile, Options{MacroFiles: []string{macroFile}})
+	if err != nil {
+		t.Fatalf("HackWithOptions failed: %v", err)
+	}
+	if expected := "0000000000000000\n1111110111001000\n"; hackFile.String() != expected {
+		t.Errorf("HackWithOptions = %q, want %q", hackFile.String(), expected)
+	}
+
+	// a macro file must not contain instructions
+	os.WriteFile(macroFile, []byte("@SP\n"), 0644)
+	if err := HackWithOptions(strings.NewReader(""), &bytes.Buffer{}, Options{MacroFiles: []string{macroFile}}); err == nil {
+		t.Errorf("HackWithOptions expected an error for a macro file with instructions")
+	}
+}
+
+func TestHackInclude(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Main.asm":       "#include \"lib/Math.asm\"\n@INC\n0;JMP\n",
+		"lib/Math.asm":   "// math routines\n#include \"Util.asm\"\n(INC)\nINC_R0\n",
+		"lib/Util.asm":   "#macro INC_R0\n@R0\nM=M+1\n#endmacro\n",
+		"Bad.asm":        "#include \"lib/Broken.asm\"\n",
+		"lib/Broken.asm": "@R0\nX=1\n",
+		"Cycle.asm":      "#include \"lib/CycleA.asm\"\n",
+		"lib/CycleA.asm": "#include \"../Cycle.asm\"\n",
+		"Missing.asm":    "#include \"Nothing.asm\"\n#include Math.asm\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	src, _ := os.ReadFile(path("Main.asm"))
+	result, err := Assemble(bytes.NewReader(src), Options{FileName: path("Main.asm")})
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+	if diff := cmp.Diff([]uint16{0x0000, 0xFDC8, 0x0000, 0xEA87}, result.Words); diff != "" {
+		t.Errorf("Assemble words mismatch (-want +got):\n%s", diff)
+	}
+	want := SourceMapEntry{Address: 0, File: path("lib/Util.asm"), Line: 2, Expansion: []Position{{path("lib/Math.asm"), 4, 1}}}
+	if diff := cmp.Diff(want, result.SourceMap().Entries[0]); diff != "" {
+		t.Errorf("source map entry mismatch (-want +got):\n%s", diff)
+	}
+
+	tests := []struct {
+		file     string
+		expected Diagnostics
+	}{
+		{file: "Bad.asm", expected: Diagnostics{
+			{Pos: Position{path("lib/Broken.asm"), 2, 1}, Message: `invalid dest mnemonic "X"`},
+		}},
+		{file: "Cycle.asm", expected: Diagnostics{
+			{Pos: Position{path("lib/CycleA.asm"), 1, 1}, Message: "include cycle: " + path("Cycle.asm") + " -> " + path("lib/CycleA.asm") + " -> " + path("Cycle.asm")},
+		}},
+		{file: "Missing.asm", expected: Diagnostics{
+			{Pos: Position{path("Missing.asm"), 1, 1}, Message: "open " + path("Nothing.asm") + ": no such file or directory"},
+			{Pos: Position{path("Missing.asm"), 2, 1}, Message: `invalid #include Math.asm: want #include "file.asm"`},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			src, _ := os.ReadFile(path(test.file))
+			_, err := Assemble(bytes.NewReader(src), Options{FileName: path(test.file)})
+			var diags Diagnostics
+			if !errors.As(err, &diags) {
+				t.Fatalf("Assemble returned %v, want Diagnostics", err)
+			}
+			if diff := cmp.Diff(test.expected, diags); diff != "" {
+				t.Errorf("Assemble diagnostics mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
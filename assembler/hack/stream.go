@@ -0,0 +1,164 @@
+package hack
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+/*
+stream.go is a single-pass assembler. It reads the assembly file once and never keeps its text, so it works for generated programs that fill the whole ROM.
+
+An A instruction whose value is known when it is read is converted at once. An A instruction that refers to a symbol that is not defined yet is a forward reference: a placeholder word is written and the line is recorded. When the file ends, every label is known, and the forward references are patched in the order they were read. The symbols that are still unknown become variables in the order of their first use, which is the order of the second pass, so the result is the same as [Assemble].
+
+The memory is bounded by the symbols, the forward references and the binary code, which is at most 32768 words.
+*/
+
+// forwardRef is a struct that represents an A instruction that refers to a symbol that was not defined when it was read.
+type forwardRef struct {
+	address int
+	line    sourceLine
+}
+
+// streamAssembler is a struct that represents the state of the single-pass assembler.
+type streamAssembler struct {
+	symbolTable SymbolTable
+	labelPos    map[SymbolOrConstant]Position // the position of each label to report duplicates
+	words       []uint16
+	forwardRefs []forwardRef
+	pp          *preprocessor // the preprocessor that passes the lines. Its data blocks are reserved before the first instruction
+	dataBound   bool
+	overflow    romOverflow
+	limit       int  // Options.VariableLimit
+	isa         *ISA // Options.ISA
+	diags       Diagnostics
+}
+
+// AssembleStream converts an assembly language file to binary code in a single pass. The result is the same as [Assemble], but the file is read only once and its text is not kept. The result has no source map. opts.Optimize is not supported because the optimizer needs the whole program.
+func AssembleStream(asmFile io.Reader, opts Options) (Result, error) {
+	if opts.Optimize {
+		return Result{}, errors.New("the optimizer cannot be used in a single pass")
+	}
+	s := &streamAssembler{symbolTable: NewSymbolTable(), labelPos: map[SymbolOrConstant]Position{}, limit: opts.VariableLimit, isa: opts.ISA}
+	pp := newPreprocessor(nil)
+	pp.sink = s.line
+	s.pp = pp
+	pp.configure(opts)
+	pp.process(asmFile, opts.FileName)
+	pp.flushData()
+	s.bindData()
+	s.patch()
+	s.overflow.report(&s.diags, len(s.words))
+
+	diags := append(pp.diags, s.diags...)
+	if err := diags.Err(); err != nil {
+		return Result{}, err
+	}
+	diags.sort()
+	return Result{Words: s.words, SymbolTable: s.symbolTable, Data: newDataReport(pp.data), Warnings: diags}, nil
+}
+
+// lineParser returns a parser of the single line for the given instruction set.
+func lineParser(l sourceLine, isa *ISA) *Parser {
+	return &Parser{scanner: bufio.NewScanner(strings.NewReader(l.text)), origins: []lineOrigin{l.origin}, isa: isa}
+}
+
+// line converts a preprocessed line. Labels are added to the symbol table and instructions are appended to the binary code. An instruction with a problem still takes its address so that the following labels get the same addresses as in the first pass.
+func (s *streamAssembler) line(l sourceLine) {
+	p := lineParser(l, s.isa)
+	if !p.advance() {
+		return
+	}
+	s.bindData()
+	if p.currentType == L_Instruction {
+		labelSymbol, err := p.symbol()
+		if err != nil {
+			p.errorf(&s.diags, 0, "%v", err)
+			return
+		}
+		if !isValidSymbol(labelSymbol) {
+			p.errorf(&s.diags, 1, "invalid label %q", labelSymbol)
+			return
+		}
+		if err := s.symbolTable.addLabel(labelSymbol, len(s.words)); err != nil {
+			if prev, ok := s.labelPos[labelSymbol]; ok {
+				p.errorf(&s.diags, 1, "%v at %v", err, prev)
+			} else {
+				p.errorf(&s.diags, 1, "%v", err)
+			}
+			return
+		}
+		s.labelPos[labelSymbol] = p.pos(1)
+		return
+	}
+
+	s.overflow.check(p, len(s.words))
+	switch p.currentType {
+	case A_Instruction:
+		symOrConst, err := p.symbol()
+		if err != nil {
+			p.errorf(&s.diags, 0, "%v", err)
+			s.words = append(s.words, 0)
+			return
+		}
+		if !isConst(symOrConst) && s.isForward(symOrConst) {
+			s.forwardRefs = append(s.forwardRefs, forwardRef{address: len(s.words), line: l})
+			s.words = append(s.words, 0)
+			return
+		}
+		s.words = append(s.words, s.aInstructionCode(p, symOrConst))
+	case C_Instruction:
+		code, _ := p.cInstructionCode(&s.diags)
+		s.words = append(s.words, BinaryCode(code).word())
+	}
+}
+
+// bindData reserves the RAM of the data blocks once. The preprocessor accepts no data directives after the first instruction, so every block is known at that point.
+func (s *streamAssembler) bindData() {
+	if !s.dataBound {
+		s.dataBound = true
+		bindData(&s.symbolTable, s.pp.data, &s.diags)
+	}
+}
+
+// isForward returns true if the value of an A instruction refers to a symbol that is not in the symbol table yet. Such a symbol is a label defined later or a variable.
+func (s *streamAssembler) isForward(symOrConst SymbolOrConstant) bool {
+	forward := false
+	evalExpression(string(symOrConst), func(sym SymbolOrConstant) (int, error) {
+		if val, ok := s.symbolTable.table[sym]; ok {
+			return val, nil
+		}
+		forward = forward || isValidSymbol(sym)
+		return 0, nil
+	})
+	return forward
+}
+
+// aInstructionCode converts the value of the current A instruction to a word with the symbol table. It reports the problem to diags and returns 0 if the value is invalid. New variables are checked against the capacity of RAM.
+func (s *streamAssembler) aInstructionCode(p *Parser, symOrConst SymbolOrConstant) uint16 {
+	variableCount := s.symbolTable.variableCount
+	code, err := symbol(symOrConst, &s.symbolTable)
+	if err != nil {
+		// point at the part of the expression that has the problem
+		offset := 1
+		if e, ok := err.(*exprError); ok {
+			offset += e.offset
+		}
+		p.errorf(&s.diags, offset, "%v", err)
+		return 0
+	}
+	p.checkVariables(&s.diags, &s.symbolTable, symOrConst, variableCount, s.limit)
+	return BinaryCode("0" + code).word()
+}
+
+// patch resolves the forward references. Every label is defined at this point, so the remaining symbols become variables.
+func (s *streamAssembler) patch() {
+	for _, ref := range s.forwardRefs {
+		p := lineParser(ref.line, s.isa)
+		p.advance()
+		symOrConst, _ := p.symbol()
+		s.words[ref.address] = s.aInstructionCode(p, symOrConst)
+	}
+	s.forwardRefs = nil
+}
@@ -0,0 +1,132 @@
+package hack
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAssembleStream(t *testing.T) {
+	tests := map[string]string{
+		"forward label": `@END
+0;JMP
+(END)
+@END
+0;JMP
+`,
+		"variables in order of first use": `@b
+M=1
+@LOOP
+0;JMP
+@a
+M=0
+(LOOP)
+@b+1
+D=M
+@a
+M=D
+(b.end)
+@b.end
+`,
+		"expression with a forward label": `@END-1
+D=A
+@2*x+END
+(END)
+@END+SCREEN
+`,
+		"macro": `#macro INC x
+@%x
+M=M+1
+#endmacro
+INC counter
+@LOOP
+(LOOP)
+INC R1
+`,
+	}
+	for name, asmCode := range tests {
+		t.Run(name, func(t *testing.T) {
+			testAssembleStream(t, asmCode)
+		})
+	}
+}
+
+func TestAssembleStreamFiles(t *testing.T) {
+	for _, fileName := range []string{"../asm_files/rect/Rect.asm", "../asm_files/max/Max.asm", "../asm_files/Prog.asm", "../../vm/vm_files/FibonacciElement/FibonacciElement.asm"} {
+		t.Run(fileName, func(t *testing.T) {
+			src, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testAssembleStream(t, string(src))
+		})
+	}
+}
+
+// TestAssembleStreamFullROM assembles a program that fills the ROM with forward jumps and variables.
+func TestAssembleStreamFullROM(t *testing.T) {
+	var sb strings.Builder
+	n := 32768/4 - 1
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "@L%d\n0;JMP\n(L%d)\n@v%d\nM=M+1\n", i+1, i, i%100)
+	}
+	fmt.Fprintf(&sb, "(L%d)\n@L%d\n0;JMP\n", n, n)
+	testAssembleStream(t, sb.String())
+}
+
+func testAssembleStream(t *testing.T, asmCode string) {
+	t.Helper()
+	want, err := Assemble(strings.NewReader(asmCode), Options{})
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+	got, err := AssembleStream(strings.NewReader(asmCode), Options{})
+	if err != nil {
+		t.Fatalf("AssembleStream failed: %v", err)
+	}
+	if diff := cmp.Diff(want.Words, got.Words); diff != "" {
+		t.Errorf("AssembleStream words mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want.SymbolTable.Symbols(), got.SymbolTable.Symbols()); diff != "" {
+		t.Errorf("AssembleStream symbols mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAssembleStreamDiagnostics(t *testing.T) {
+	asmCode := `@1
+X=A
+@END+1/0
+(LOOP)
+@LOOP*(2
+(LOOP)
+@40000
+@x-1
+(END)
+`
+	_, want := Assemble(strings.NewReader(asmCode), Options{FileName: "Prog.asm"})
+	_, got := AssembleStream(strings.NewReader(asmCode), Options{FileName: "Prog.asm"})
+	if want == nil {
+		t.Fatal("Assemble returned no error")
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("AssembleStream diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHackStream(t *testing.T) {
+	asmCode := "@END\n0;JMP\n(END)\n"
+	var hackFile bytes.Buffer
+	if err := HackWithOptions(strings.NewReader(asmCode), &hackFile, Options{Stream: true}); err != nil {
+		t.Fatalf("HackWithOptions failed: %v", err)
+	}
+	if want := "0000000000000010\n1110101010000111\n"; hackFile.String() != want {
+		t.Errorf("HackWithOptions wrote %q, want %q", hackFile.String(), want)
+	}
+	if err := HackWithOptions(strings.NewReader(asmCode), &hackFile, Options{Stream: true, Listing: &bytes.Buffer{}}); err == nil {
+		t.Error("HackWithOptions with a listing in a single pass returned no error")
+	}
+}
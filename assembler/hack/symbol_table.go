@@ -1,43 +1,100 @@
 package hack
 
-import "errors"
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
 
-// SymbolTable is a struct that represents a symbol table. It keeps track of the variables and labels in the assembly code. The table is a map of symbols to memory addresses. variableCount is the counter for the next available RAM space for variables.
+// SymbolTable is a struct that represents a symbol table. It keeps track of the variables and labels in the assembly code. The table is a map of symbols to memory addresses. variableCount is the counter for the next available RAM space for variables. labels is the set of symbols defined by L instructions. data is the set of symbols of RAM blocks reserved by data directives.
 type SymbolTable struct {
 	table         map[SymbolOrConstant]int
 	variableCount int
+	labels        map[SymbolOrConstant]bool
+	data          map[SymbolOrConstant]bool
+}
+
+// SymbolKind is the kind of a symbol: predefined, label or variable.
+type SymbolKind int
+
+const (
+	SymbolPredefined SymbolKind = iota // a predefined symbol of the Hack platform. Example: SP, R0, SCREEN
+	SymbolLabel                        // a label defined by an L instruction. Its value is a ROM address
+	SymbolVariable                     // a variable allocated by the assembler. Its value is a RAM address
+	SymbolData                         // a block reserved by .data, .word or .string. Its value is the RAM address of the first word
+)
+
+var symbolKindNames = [...]string{
+	SymbolPredefined: "predefined",
+	SymbolLabel:      "label",
+	SymbolVariable:   "variable",
+	SymbolData:       "data",
+}
+
+// String returns the name of the kind. Example: "label"
+func (k SymbolKind) String() string {
+	if k < 0 || int(k) >= len(symbolKindNames) {
+		return fmt.Sprintf("SymbolKind(%d)", int(k))
+	}
+	return symbolKindNames[k]
+}
+
+// parseSymbolKind returns the kind of the given name. Example: "label" -> SymbolLabel
+func parseSymbolKind(name string) (SymbolKind, error) {
+	for k, n := range symbolKindNames {
+		if n == name {
+			return SymbolKind(k), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid symbol kind %q", name)
+}
+
+// Symbol is a struct that represents an entry of the symbol table. Value is a ROM address for labels and a RAM address for predefined symbols and variables.
+type Symbol struct {
+	Name  SymbolOrConstant
+	Kind  SymbolKind
+	Value int
+}
+
+// predefinedSymbols is a map of the predefined symbols of the Hack platform to their addresses.
+var predefinedSymbols = map[SymbolOrConstant]int{
+	"R0":     0,
+	"R1":     1,
+	"R2":     2,
+	"R3":     3,
+	"R4":     4,
+	"R5":     5,
+	"R6":     6,
+	"R7":     7,
+	"R8":     8,
+	"R9":     9,
+	"R10":    10,
+	"R11":    11,
+	"R12":    12,
+	"R13":    13,
+	"R14":    14,
+	"R15":    15,
+	"SCREEN": 16384,
+	"KBD":    24576,
+	"SP":     0,
+	"LCL":    1,
+	"ARG":    2,
+	"THIS":   3,
+	"THAT":   4,
 }
 
 // NewSymbolTable returns a new symbol table with the predefined symbols and variables.
 func NewSymbolTable() SymbolTable {
-	table := map[SymbolOrConstant]int{
-		"R0":     0,
-		"R1":     1,
-		"R2":     2,
-		"R3":     3,
-		"R4":     4,
-		"R5":     5,
-		"R6":     6,
-		"R7":     7,
-		"R8":     8,
-		"R9":     9,
-		"R10":    10,
-		"R11":    11,
-		"R12":    12,
-		"R13":    13,
-		"R14":    14,
-		"R15":    15,
-		"SCREEN": 16384,
-		"KBD":    24576,
-		"SP":     0,
-		"LCL":    1,
-		"ARG":    2,
-		"THIS":   3,
-		"THAT":   4,
-	}
 	return SymbolTable{
-		table:         table,
+		table:         maps.Clone(predefinedSymbols),
 		variableCount: 16,
+		labels:        map[SymbolOrConstant]bool{},
+		data:          map[SymbolOrConstant]bool{},
 	}
 }
 
@@ -53,11 +110,127 @@ func (s *SymbolTable) addVariable(symbol SymbolOrConstant) {
 	s.variableCount++
 }
 
-// addLabel adds a label to the symbol table
-func (s *SymbolTable) addLabel(label SymbolOrConstant, count int) {
-	if !s.contains(label) {
-		s.table[label] = count
-	} else {
-		panic(errors.New("defined label is defined again"))
+// resolve returns the value of the given symbol. If the symbol is not defined, it is added as a new variable.
+func (s *SymbolTable) resolve(symbol SymbolOrConstant) (int, error) {
+	if val, ok := s.table[symbol]; ok {
+		return val, nil
+	}
+	if !isValidSymbol(symbol) {
+		return 0, fmt.Errorf("invalid symbol %q", symbol)
+	}
+	s.addVariable(symbol)
+	return s.table[symbol], nil
+}
+
+// addLabel adds a label to the symbol table. It returns an error if the label is already defined or is a predefined symbol.
+func (s *SymbolTable) addLabel(label SymbolOrConstant, count int) error {
+	if _, ok := predefinedSymbols[label]; ok {
+		return fmt.Errorf("label %s conflicts with the predefined symbol", label)
+	}
+	if s.contains(label) {
+		return fmt.Errorf("label %s is already defined", label)
+	}
+	s.table[label] = count
+	if s.labels == nil {
+		s.labels = map[SymbolOrConstant]bool{}
+	}
+	s.labels[label] = true
+	return nil
+}
+
+// addData reserves size words of RAM for a data block at the next free address. It returns an error if the name is already defined or is a predefined symbol.
+func (s *SymbolTable) addData(name SymbolOrConstant, size int) error {
+	if _, ok := predefinedSymbols[name]; ok {
+		return fmt.Errorf("data %s conflicts with the predefined symbol", name)
+	}
+	if s.contains(name) {
+		return fmt.Errorf("data %s is already defined", name)
+	}
+	s.table[name] = s.variableCount
+	s.variableCount += size
+	if s.data == nil {
+		s.data = map[SymbolOrConstant]bool{}
+	}
+	s.data[name] = true
+	return nil
+}
+
+// kind returns the kind of the given symbol in the table.
+func (s *SymbolTable) kind(symbol SymbolOrConstant) SymbolKind {
+	if s.labels[symbol] {
+		return SymbolLabel
+	}
+	if s.data[symbol] {
+		return SymbolData
+	}
+	if _, ok := predefinedSymbols[symbol]; ok {
+		return SymbolPredefined
+	}
+	return SymbolVariable
+}
+
+// Lookup returns the symbol of the given name. It returns false if the name is not in the table.
+func (s *SymbolTable) Lookup(name SymbolOrConstant) (Symbol, bool) {
+	value, ok := s.table[name]
+	if !ok {
+		return Symbol{}, false
+	}
+	return Symbol{Name: name, Kind: s.kind(name), Value: value}, true
+}
+
+// Symbols returns every symbol in the table sorted by kind, value and name: predefined symbols first, then labels and variables.
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.table))
+	for name, value := range s.table {
+		symbols = append(symbols, Symbol{Name: name, Kind: s.kind(name), Value: value})
+	}
+	slices.SortFunc(symbols, func(a, b Symbol) int {
+		return cmp.Or(cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.Value, b.Value), cmp.Compare(a.Name, b.Name))
+	})
+	return symbols
+}
+
+// WriteSymbols writes the symbols as a .sym file. Each line has the name, the kind and the value of a symbol. Variables and data allocated in the screen or keyboard memory map are marked with a comment.
+//
+//	LOOP      label       10
+//	i         variable    16
+func WriteSymbols(w io.Writer, symbols []Symbol) error {
+	bw := bufio.NewWriter(w)
+	for _, sym := range symbols {
+		fmt.Fprintf(bw, "%-16s  %-10s  %d", sym.Name, sym.Kind, sym.Value)
+		if (sym.Kind == SymbolVariable || sym.Kind == SymbolData) && sym.Value >= predefinedSymbols["SCREEN"] {
+			fmt.Fprint(bw, "  // overflows into the memory map")
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// ReadSymbols reads symbols written by [WriteSymbols]. Empty lines and comments are ignored.
+func ReadSymbols(r io.Reader) ([]Symbol, error) {
+	var symbols []Symbol
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("read symbols: line %d: invalid symbol %q", lineNum, scanner.Text())
+		}
+		kind, err := parseSymbolKind(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("read symbols: line %d: %w", lineNum, err)
+		}
+		value, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("read symbols: line %d: invalid value %q", lineNum, fields[2])
+		}
+		symbols = append(symbols, Symbol{Name: SymbolOrConstant(fields[0]), Kind: kind, Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read symbols: %w", err)
 	}
+	return symbols, nil
 }
@@ -0,0 +1,105 @@
+package hack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAssembleSymbolTable(t *testing.T) {
+	asmCode := `@i
+M=1
+(LOOP)
+@sum
+M=D
+@LOOP
+0;JMP
+`
+	result, err := Assemble(strings.NewReader(asmCode), Options{})
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+	if len(result.Words) != 6 {
+		t.Errorf("len(Words) = %d, want 6", len(result.Words))
+	}
+	tests := []struct {
+		name     SymbolOrConstant
+		expected Symbol
+	}{
+		{"LOOP", Symbol{Name: "LOOP", Kind: SymbolLabel, Value: 2}},
+		{"i", Symbol{Name: "i", Kind: SymbolVariable, Value: 16}},
+		{"sum", Symbol{Name: "sum", Kind: SymbolVariable, Value: 17}},
+		{"SCREEN", Symbol{Name: "SCREEN", Kind: SymbolPredefined, Value: 16384}},
+	}
+	for _, test := range tests {
+		got, ok := result.SymbolTable.Lookup(test.name)
+		if !ok || got != test.expected {
+			t.Errorf("Lookup(%q) = %v, %v, want %v", test.name, got, ok, test.expected)
+		}
+	}
+	if _, ok := result.SymbolTable.Lookup("END"); ok {
+		t.Errorf("Lookup(%q) expected no symbol", "END")
+	}
+
+	symbols := result.SymbolTable.Symbols()
+	if len(symbols) != len(predefinedSymbols)+3 {
+		t.Fatalf("len(Symbols()) = %d, want %d", len(symbols), len(predefinedSymbols)+3)
+	}
+	// predefined symbols come first, then labels and variables
+	expectedTail := []Symbol{tests[0].expected, tests[1].expected, tests[2].expected}
+	if diff := cmp.Diff(expectedTail, symbols[len(symbols)-3:]); diff != "" {
+		t.Errorf("Symbols() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteSymbols(t *testing.T) {
+	symbols := []Symbol{
+		{Name: "KBD", Kind: SymbolPredefined, Value: 24576},
+		{Name: "LOOP", Kind: SymbolLabel, Value: 10},
+		{Name: "i", Kind: SymbolVariable, Value: 16},
+		{Name: "big", Kind: SymbolVariable, Value: 16384},
+	}
+	expected := `KBD               predefined  24576
+LOOP              label       10
+i                 variable    16
+big               variable    16384  // overflows into the memory map
+`
+	buf := &bytes.Buffer{}
+	if err := WriteSymbols(buf, symbols); err != nil {
+		t.Fatalf("WriteSymbols failed: %v", err)
+	}
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("WriteSymbols mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err := ReadSymbols(buf)
+	if err != nil {
+		t.Fatalf("ReadSymbols failed: %v", err)
+	}
+	if diff := cmp.Diff(symbols, got); diff != "" {
+		t.Errorf("ReadSymbols mismatch (-want +got):\n%s", diff)
+	}
+	for _, input := range []string{"LOOP label\n", "LOOP constant 3\n", "LOOP label x\n"} {
+		if _, err := ReadSymbols(strings.NewReader(input)); err == nil {
+			t.Errorf("ReadSymbols(%q) expected an error", input)
+		}
+	}
+}
+
+func TestHackSymbols(t *testing.T) {
+	symbols := &bytes.Buffer{}
+	err := HackWithOptions(strings.NewReader("(START)\n@x\n@START\n"), &bytes.Buffer{}, Options{Symbols: symbols})
+	if err != nil {
+		t.Fatalf("HackWithOptions failed: %v", err)
+	}
+	got, err := ReadSymbols(symbols)
+	if err != nil {
+		t.Fatalf("ReadSymbols failed: %v", err)
+	}
+	expected := []Symbol{{Name: "START", Kind: SymbolLabel, Value: 0}, {Name: "x", Kind: SymbolVariable, Value: 16}}
+	if diff := cmp.Diff(expected, got[len(got)-2:]); diff != "" {
+		t.Errorf("symbols mismatch (-want +got):\n%s", diff)
+	}
+}
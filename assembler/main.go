@@ -1,14 +1,178 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/Kaichi-Irie/nand2tetris-go/assembler/hack"
 )
 
+// usage: go run main.go [-format hack|bin|ihex|memb|memh|logisim] [-listing] [-sourcemap] [-sym] [-O] [-stream] [-varlimit n] [-D name[=value]]... [-isa name|file] <input.asm>
+//
+//	go run main.go -lint [-varlimit n] <input.asm>...                prints warnings and errors, exits with 1 if there are any
+//	go run main.go -fmt [-check] <input.asm>...                      formats files in place, or lists the files that are not formatted
+//	go run main.go -c <input.asm>                                    writes a relocatable object <input>.hobj
+//	go run main.go [-format f] -o <output> <input.hobj|input.asm>... links objects into one program
+//
+// Errors are printed to stderr. The exit code is 1 if the input has errors or a file cannot be read or written, and 2 if the command line is invalid.
 func main() {
-	err := hack.HackFromFile(os.Args[1])
+	defines := hack.DefineFlags{}
+	flag.Var(defines, "D", "define a name like #define. Example: -D DEBUG, -D SCREEN_BASE=16384. It can be given more than once")
+	formatName := flag.String("format", "hack", "the format of the output file: hack, bin, ihex, memb, memh or logisim")
+	listing := flag.Bool("listing", false, "write a listing file <input>.lst")
+	sourceMap := flag.Bool("sourcemap", false, "write a JSON source map <input>.map.json")
+	symbols := flag.Bool("sym", false, "write the symbol table <input>.sym")
+	optimize := flag.Bool("O", false, "remove redundant instructions with the peephole optimizer")
+	variableLimit := flag.Int("varlimit", 0, "warn about variables above the given RAM address. Example: 255 for programs translated from VM code")
+	stream := flag.Bool("stream", false, "read the input once with the single-pass assembler. It cannot be used with -listing, -sourcemap and -O")
+	object := flag.Bool("c", false, "write a relocatable object <input>.hobj instead of binary code")
+	output := flag.String("o", "", "link the input objects or assembly files into the given binary code file")
+	lint := flag.Bool("lint", false, "check the input assembly files for suspicious code and print the warnings instead of assembling")
+	formatSource := flag.Bool("fmt", false, "format the input assembly files in place instead of assembling")
+	check := flag.Bool("check", false, "with -fmt, print the files that are not formatted without writing them and exit with 1 if there are any")
+	isaName := flag.String("isa", "hack", "the instruction set: a registered name (hack, hack-shift) or an ISA file")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		exit(2, errors.New("usage: assembler [flags] <input.asm>..."))
+	}
+	path := flag.Arg(0)
+	isa, err := hack.FindISA(*isaName)
 	if err != nil {
-		panic(err)
+		exit(2, err)
+	}
+
+	if *formatSource {
+		found := false
+		for _, path := range flag.Args() {
+			changed, err := hack.FormatFile(path, hack.FormatterOptions{}, *check)
+			if err != nil {
+				exit(1, err)
+			}
+			if changed && *check {
+				fmt.Println(path)
+			}
+			found = found || changed
+		}
+		if found && *check {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *lint {
+		found := false
+		for _, path := range flag.Args() {
+			f, err := os.Open(path)
+			if err != nil {
+				exit(1, err)
+			}
+			diags := hack.Lint(f, hack.Options{FileName: path, VariableLimit: *variableLimit, Defines: defines, ISA: isa})
+			f.Close()
+			for _, d := range diags {
+				fmt.Println(d.Error())
+			}
+			found = found || len(diags) > 0
+		}
+		if found {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *output != "" {
+		format, err := hack.ParseFormat(*formatName)
+		if err != nil {
+			exit(2, err)
+		}
+		hackFile, err := os.Create(*output)
+		if err != nil {
+			exit(1, err)
+		}
+		defer hackFile.Close()
+		if err := hack.LinkFiles(flag.Args(), hackFile, format); err != nil {
+			exit(1, err)
+		}
+		return
+	}
+	if *object {
+		asmFile, err := os.Open(path)
+		if err != nil {
+			exit(1, err)
+		}
+		defer asmFile.Close()
+		obj, err := hack.AssembleObject(asmFile, hack.Options{FileName: path, Defines: defines, ISA: isa})
+		if err != nil {
+			exit(1, err)
+		}
+		objFile, err := os.Create(path[:len(path)-len(filepath.Ext(path))] + hack.ObjectExt)
+		if err != nil {
+			exit(1, err)
+		}
+		defer objFile.Close()
+		if err := hack.WriteObject(objFile, obj); err != nil {
+			exit(1, err)
+		}
+		return
+	}
+
+	if filepath.Ext(path) != ".asm" {
+		// disassemble the binary code file and print the assembly code. The format is detected from the extension
+		format, err := hack.FormatFromPath(path)
+		if err != nil {
+			exit(2, err)
+		}
+		hackFile, err := os.Open(path)
+		if err != nil {
+			exit(1, err)
+		}
+		defer hackFile.Close()
+		err = hack.Disassemble(hackFile, os.Stdout, hack.DisassembleOptions{Labels: true, PredefinedSymbols: true, Format: format, ISA: isa})
+		if err != nil {
+			exit(1, err)
+		}
+		return
 	}
+	format, err := hack.ParseFormat(*formatName)
+	if err != nil {
+		exit(2, err)
+	}
+	opts := hack.Options{Format: format, Optimize: *optimize, Stream: *stream, VariableLimit: *variableLimit, Defines: defines, ISA: isa}
+	stem := path[:len(path)-len(".asm")]
+	if *listing {
+		listingFile, err := os.Create(stem + ".lst")
+		if err != nil {
+			exit(1, err)
+		}
+		defer listingFile.Close()
+		opts.Listing = listingFile
+	}
+	if *sourceMap {
+		sourceMapFile, err := os.Create(stem + ".map.json")
+		if err != nil {
+			exit(1, err)
+		}
+		defer sourceMapFile.Close()
+		opts.SourceMap = sourceMapFile
+	}
+	if *symbols {
+		symbolFile, err := os.Create(stem + ".sym")
+		if err != nil {
+			exit(1, err)
+		}
+		defer symbolFile.Close()
+		opts.Symbols = symbolFile
+	}
+	err = hack.HackFromFileWithOptions(path, opts)
+	if err != nil {
+		exit(1, err)
+	}
+}
+
+// exit prints the error to stderr and exits with the code: 1 for the errors of the input and the files, and 2 for the errors of the command line.
+func exit(code int, err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(code)
 }
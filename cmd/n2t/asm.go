@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/assembler/hack"
+	"github.com/Kaichi-Irie/nand2tetris-go/vm/vmtranslator"
+)
+
+// asmFlags is a struct that represents the flags of the commands that assemble.
+type asmFlags struct {
+	format        string
+	isa           string
+	optimize      vmtranslator.Level
+	variableLimit int
+	defines       hack.DefineFlags
+}
+
+// define defines the flags on fs. The format flag is defined by defineFormat for the commands that write binary code.
+func (f *asmFlags) define(fs *flag.FlagSet) {
+	f.format = "hack"
+	f.defines = hack.DefineFlags{}
+	fs.StringVar(&f.isa, "isa", "hack", "the instruction set: a registered name (hack, hack-shift) or an ISA file")
+	fs.Var(&f.optimize, "O", "the optimization level: -O (or -O=1) removes redundant instructions with the peephole optimizer, and -O=2 also optimizes the VM code")
+	fs.IntVar(&f.variableLimit, "varlimit", 0, "warn about variables above the given RAM address. Example: 255 for programs translated from VM code")
+	fs.Var(f.defines, "D", "define a name like #define. Example: -D DEBUG, -D SCREEN_BASE=16384. It can be given more than once")
+}
+
+// defineFormat defines the -format flag on fs.
+func (f *asmFlags) defineFormat(fs *flag.FlagSet) {
+	fs.StringVar(&f.format, "format", "hack", "the format of the binary code: hack, bin, ihex, memb, memh or logisim")
+}
+
+// options returns the assembler options of the flags.
+func (f *asmFlags) options(fileName string) (hack.Options, error) {
+	format, err := hack.ParseFormat(f.format)
+	if err != nil {
+		return hack.Options{}, usagef("%v", err)
+	}
+	isa, err := hack.FindISA(f.isa)
+	if err != nil {
+		return hack.Options{}, usagef("%v", err)
+	}
+	return hack.Options{FileName: fileName, Format: format, ISA: isa, Optimize: f.optimize >= 1, VariableLimit: f.variableLimit, Defines: f.defines}, nil
+}
+
+// assemble assembles the program and prints the reports and the warnings. It returns the binary code in opts.Format.
+func (e *env) assemble(src []byte, opts hack.Options) ([]byte, hack.Result, error) {
+	var out bytes.Buffer
+	result, err := hack.AssembleTo(bytes.NewReader(src), &out, opts)
+	if err != nil {
+		return nil, hack.Result{}, err
+	}
+	if opts.Optimize {
+		e.infof("%v", result.Optimized)
+	}
+	if result.Data.Words > 0 {
+		e.infof("%v", result.Data)
+	}
+	for _, w := range result.Warnings {
+		e.infof("%v", w.Error())
+	}
+	e.debugf("assembled %s: %d instructions", opts.FileName, len(result.Words))
+	return out.Bytes(), result, nil
+}
+
+var asmCommand = &command{
+	name:    "asm",
+	args:    "[input.asm|-]",
+	summary: "assemble an assembly file into binary code",
+	setup: func(fs *flag.FlagSet) func(e *env, args []string) error {
+		var f asmFlags
+		f.define(fs)
+		f.defineFormat(fs)
+		output := fs.String("o", "", "the output file. The default is the input with the extension of -format, or stdout for stdin")
+		listing := fs.String("listing", "", "write a listing of addresses, binary code and source lines to the file")
+		sourceMap := fs.String("sourcemap", "", "write a JSON source map to the file")
+		symbols := fs.String("sym", "", "write the symbol table to the file")
+		stream := fs.Bool("stream", false, "read the input once with the single-pass assembler. It cannot be used with -listing, -sourcemap and -O")
+		return func(e *env, args []string) error {
+			input, err := singleInput(args)
+			if err != nil {
+				return err
+			}
+			opts, err := f.options(displayName(input))
+			if err != nil {
+				return err
+			}
+			opts.Stream = *stream
+			src, err := e.readInput(input)
+			if err != nil {
+				return err
+			}
+			// the side files are kept in buffers and written after the program is assembled
+			var listingBuf, sourceMapBuf, symbolsBuf bytes.Buffer
+			if *listing != "" {
+				opts.Listing = &listingBuf
+			}
+			if *sourceMap != "" {
+				opts.SourceMap = &sourceMapBuf
+			}
+			if *symbols != "" {
+				opts.Symbols = &symbolsBuf
+			}
+			code, _, err := e.assemble(src, opts)
+			if err != nil {
+				return err
+			}
+			if *output == "" {
+				*output = replaceExt(input, opts.Format.Ext())
+			}
+			for _, out := range []struct {
+				path string
+				data []byte
+			}{{*output, code}, {*listing, listingBuf.Bytes()}, {*sourceMap, sourceMapBuf.Bytes()}, {*symbols, symbolsBuf.Bytes()}} {
+				if out.path == "" {
+					continue
+				}
+				if err := e.writeOutput(out.path, out.data); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	},
+}
+
+var disasmCommand = &command{
+	name:    "disasm",
+	args:    "[input.hack|-]",
+	summary: "disassemble binary code into an assembly file",
+	setup: func(fs *flag.FlagSet) func(e *env, args []string) error {
+		output := fs.String("o", "-", "the output file")
+		formatName := fs.String("format", "", "the format of the input. The default is detected from the extension, or hack for stdin")
+		isaName := fs.String("isa", "hack", "the instruction set: a registered name (hack, hack-shift) or an ISA file")
+		labels := fs.Bool("labels", true, "synthesize a label for every jump target")
+		symbols := fs.Bool("symbols", true, "use the predefined symbols such as SP and SCREEN")
+		return func(e *env, args []string) error {
+			input, err := singleInput(args)
+			if err != nil {
+				return err
+			}
+			format, err := inputFormat(input, *formatName)
+			if err != nil {
+				return err
+			}
+			isa, err := hack.FindISA(*isaName)
+			if err != nil {
+				return usagef("%v", err)
+			}
+			src, err := e.readInput(input)
+			if err != nil {
+				return err
+			}
+			var out bytes.Buffer
+			opts := hack.DisassembleOptions{Labels: *labels, PredefinedSymbols: *symbols, Format: format, ISA: isa}
+			if err := hack.Disassemble(bytes.NewReader(src), &out, opts); err != nil {
+				return fmt.Errorf("%s: %w", displayName(input), err)
+			}
+			return e.writeOutput(*output, out.Bytes())
+		}
+	},
+}
+
+// inputFormat returns the format of the flag, or the format of the extension of the input if the flag is empty. Example: "Prog.hex" -> FormatIntelHex
+func inputFormat(input, name string) (hack.Format, error) {
+	var format hack.Format
+	var err error
+	switch {
+	case name != "":
+		format, err = hack.ParseFormat(name)
+	case input == "-":
+		format = hack.FormatHack
+	default:
+		format, err = hack.FormatFromPath(input)
+	}
+	if err != nil {
+		return 0, usagef("%v", err)
+	}
+	return format, nil
+}
+
+var linkCommand = &command{
+	name:    "link",
+	args:    "<input.hobj|input.asm>...",
+	summary: "link relocatable objects and assembly files into one program",
+	setup: func(fs *flag.FlagSet) func(e *env, args []string) error {
+		var f asmFlags
+		f.define(fs)
+		f.defineFormat(fs)
+		output := fs.String("o", "", "the output file (required)")
+		return func(e *env, args []string) error {
+			if len(args) == 0 {
+				return usagef("no inputs")
+			}
+			if *output == "" {
+				return usagef("-o is required")
+			}
+			var objects []hack.Object
+			for _, path := range args {
+				if filepath.Ext(path) != ".asm" {
+					obj, err := hack.ReadObjectFromFile(path)
+					if err != nil {
+						return err
+					}
+					objects = append(objects, obj)
+					continue
+				}
+				opts, err := f.options(path)
+				if err != nil {
+					return err
+				}
+				src, err := e.readInput(path)
+				if err != nil {
+					return err
+				}
+				obj, err := hack.AssembleObject(bytes.NewReader(src), opts)
+				if err != nil {
+					return err
+				}
+				objects = append(objects, obj)
+			}
+			format, err := hack.ParseFormat(f.format)
+			if err != nil {
+				return usagef("%v", err)
+			}
+			result, err := hack.Link(objects)
+			if err != nil {
+				return err
+			}
+			var out bytes.Buffer
+			if err := hack.WriteWords(&out, result.Words, format); err != nil {
+				return err
+			}
+			e.debugf("linked %d objects: %d instructions", len(objects), len(result.Words))
+			return e.writeOutput(*output, out.Bytes())
+		}
+	},
+}
+
+var lintCommand = &command{
+	name:    "lint",
+	args:    "[input.asm|input.vm|directory|-]...",
+	summary: "print the warnings and errors of assembly files and the stack errors of VM files to stdout",
+	setup: func(fs *flag.FlagSet) func(e *env, args []string) error {
+		var f asmFlags
+		f.define(fs)
+		return func(e *env, args []string) error {
+			if len(args) == 0 {
+				args = []string{"-"}
+			}
+			found := false
+			for _, path := range args {
+				if isDir(path) || filepath.Ext(path) == ".vm" {
+					problems, err := e.lintVM(path)
+					if err != nil {
+						return err
+					}
+					found = found || problems
+					continue
+				}
+				opts, err := f.options(displayName(path))
+				if err != nil {
+					return err
+				}
+				src, err := e.readInput(path)
+				if err != nil {
+					return err
+				}
+				diags := hack.Lint(bytes.NewReader(src), opts)
+				for _, d := range diags {
+					fmt.Fprintln(e.stdout, d.Error())
+				}
+				found = found || len(diags) > 0
+			}
+			if found {
+				return exitError{code: exitFailure}
+			}
+			return nil
+		}
+	},
+}
+
+var fmtCommand = &command{
+	name:    "fmt",
+	args:    "[input.asm|-]...",
+	summary: "format assembly files in place, or stdin to stdout",
+	setup: func(fs *flag.FlagSet) func(e *env, args []string) error {
+		check := fs.Bool("check", false, "print the files that are not formatted without writing them, and exit with 1 if there are any")
+		return func(e *env, args []string) error {
+			if len(args) == 0 {
+				args = []string{"-"}
+			}
+			found := false
+			for _, path := range args {
+				src, err := e.readInput(path)
+				if err != nil {
+					return err
+				}
+				formatted, err := hack.FormatSource(bytes.NewReader(src), displayName(path), hack.FormatterOptions{})
+				if err != nil {
+					return err
+				}
+				changed := !bytes.Equal(src, formatted)
+				found = found || changed
+				switch {
+				case *check:
+					if changed {
+						fmt.Fprintln(e.stdout, displayName(path))
+					}
+				case path == "-" || changed:
+					if err := e.writeOutput(path, formatted); err != nil {
+						return err
+					}
+				}
+			}
+			if found && *check {
+				return exitError{code: exitFailure}
+			}
+			return nil
+		}
+	},
+}
+
+// replaceExt replaces the extension of the path. "-" is kept. Example: "Prog.asm", ".hack" -> "Prog.hack"
+func replaceExt(path, ext string) string {
+	if path == "-" {
+		return path
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
+
+// isDir returns true if the path is a directory.
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
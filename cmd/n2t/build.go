@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/assembler/hack"
+	"github.com/Kaichi-Irie/nand2tetris-go/emulator"
+	"github.com/Kaichi-Irie/nand2tetris-go/vm/vminterpreter"
+	"github.com/Kaichi-Irie/nand2tetris-go/vm/vmtranslator"
+)
+
+// buildFlags is a struct that represents the flags of the commands that build a program from its source.
+type buildFlags struct {
+	asmFlags
+	libs      listFlags
+	bootstrap string
+	keep      bool
+}
+
+// define defines the flags on fs.
+func (f *buildFlags) define(fs *flag.FlagSet) {
+	f.asmFlags.define(fs)
+	f.libs = nil
+	fs.Var(&f.libs, "lib", "a directory of VM files added to the program unless it has a file of the same name. Example: the Jack OS. It can be given more than once")
+	fs.StringVar(&f.bootstrap, "bootstrap", "auto", "write the bootstrap code that calls Sys.init: auto (if there is a Sys.vm), on or off")
+	fs.BoolVar(&f.keep, "keep", false, "write the intermediate .vm and .asm files next to the inputs")
+}
+
+// build compiles, translates and assembles the input: a .jack, .vm or .asm file or a directory of .jack and .vm files. It returns the binary code in the format of the flags and the assembled program.
+func (e *env) build(input string, f *buildFlags) ([]byte, hack.Result, error) {
+	if filepath.Ext(input) == ".asm" {
+		src, err := e.readInput(input)
+		if err != nil {
+			return nil, hack.Result{}, err
+		}
+		opts, err := f.options(input)
+		if err != nil {
+			return nil, hack.Result{}, err
+		}
+		return e.assemble(src, opts)
+	}
+	sources, err := e.vmSources(input, f)
+	if err != nil {
+		return nil, hack.Result{}, err
+	}
+
+	asmPath := defaultOutput(input, ".asm")
+	asm, err := e.translate(sources, f.bootstrap, f.optimize)
+	if err != nil {
+		return nil, hack.Result{}, err
+	}
+	if f.keep {
+		if err := e.writeOutput(asmPath, asm); err != nil {
+			return nil, hack.Result{}, err
+		}
+	}
+	opts, err := f.options(asmPath)
+	if err != nil {
+		return nil, hack.Result{}, err
+	}
+	// the VM translator has already optimized the code
+	opts.Optimize = false
+	return e.assemble(asm, opts)
+}
+
+// vmSources compiles the Jack classes of the input and returns the VM files of the program with the libraries: a .jack or .vm file or a directory of .jack and .vm files.
+func (e *env) vmSources(input string, f *buildFlags) ([]vmSource, error) {
+	var jackFiles, vmFiles []string
+	switch {
+	case input == "-":
+		return nil, usagef("the input must be a file or a directory")
+	case isDir(input):
+		var err error
+		if jackFiles, err = filesIn(input, ".jack"); err != nil {
+			return nil, err
+		}
+		if vmFiles, err = filesIn(input, ".vm"); err != nil {
+			return nil, err
+		}
+	case filepath.Ext(input) == ".jack":
+		jackFiles = []string{input}
+	case filepath.Ext(input) == ".vm":
+		vmFiles = []string{input}
+	default:
+		return nil, usagef("input %s must be a .jack, .vm or .asm file or a directory", input)
+	}
+
+	// Jack classes replace the VM files of the same name, which are usually their old output
+	jackSources, err := e.readJackSources(jackFiles)
+	if err != nil {
+		return nil, err
+	}
+	var sources []vmSource
+	for _, source := range jackSources {
+		code, err := e.compile(source)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, vmSource{name: stem(source.path), path: replaceExt(source.path, ".vm"), code: code})
+		if f.keep {
+			if err := e.writeOutput(replaceExt(source.path, ".vm"), code); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, file := range vmFiles {
+		if slices.ContainsFunc(sources, func(s vmSource) bool { return s.name == stem(file) }) {
+			continue
+		}
+		code, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, vmSource{name: stem(file), path: file, code: code})
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%s has no .jack or .vm files", input)
+	}
+	return e.addLibraries(sources, f.libs)
+}
+
+var buildCommand = &command{
+	name:    "build",
+	args:    "<input.jack|input.vm|input.asm|directory>",
+	summary: "compile, translate and assemble a program into binary code",
+	setup: func(fs *flag.FlagSet) func(e *env, args []string) error {
+		var f buildFlags
+		f.define(fs)
+		f.defineFormat(fs)
+		output := fs.String("o", "", "the output file. The default is <input> or <directory>/<directory> with the extension of -format")
+		return func(e *env, args []string) error {
+			if len(args) != 1 {
+				return usagef("want one input, got %d", len(args))
+			}
+			code, _, err := e.build(args[0], &f)
+			if err != nil {
+				return err
+			}
+			if *output == "" {
+				format, _ := hack.ParseFormat(f.format)
+				*output = defaultOutput(args[0], format.Ext())
+			}
+			return e.writeOutput(*output, code)
+		}
+	},
+}
+
+var runCommand = &command{
+	name:    "run",
+	args:    "<input.hack|input.jack|input.vm|input.asm|directory>",
+	summary: "run a program on the CPU emulator, building it first if it is a source, or on the VM interpreter",
+	setup: func(fs *flag.FlagSet) func(e *env, args []string) error {
+		var f buildFlags
+		f.define(fs)
+		maxCycles := fs.Int("cycles", 1000000, "the maximum number of instructions to execute. 0 means no limit")
+		set := fs.String("set", "", "comma separated RAM values to set before running. Example: 0=2,1=3")
+		dump := fs.String("dump", "0:16", "the RAM range to print after running. Example: 0:16")
+		interpret := fs.Bool("vm", false, "run a .jack or .vm program on the VM interpreter instead of building it. -cycles counts VM commands")
+		return func(e *env, args []string) error {
+			if len(args) != 1 {
+				return usagef("want one input, got %d", len(args))
+			}
+			input := args[0]
+			isa, err := hack.FindISA(f.isa)
+			if err != nil {
+				return usagef("%v", err)
+			}
+			start, end, err := emulator.ParseRange(*dump)
+			if err != nil {
+				return usagef("%v", err)
+			}
+			if *interpret {
+				return e.interpret(input, &f, *maxCycles, *set, start, end)
+			}
+
+			c := emulator.New()
+			c.ISA = isa
+			var sourceMap hack.SourceMap
+			if format, err := hack.FormatFromPath(input); err == nil && filepath.Ext(input) != ".asm" {
+				src, err := e.readInput(input)
+				if err != nil {
+					return err
+				}
+				if err := c.LoadFormat(bytes.NewReader(src), format); err != nil {
+					return fmt.Errorf("load %s: %w", input, err)
+				}
+			} else {
+				_, result, err := e.build(input, &f)
+				if err != nil {
+					return err
+				}
+				if err := c.LoadWords(result.Words); err != nil {
+					return err
+				}
+				sourceMap = result.SourceMap()
+			}
+			if err := emulator.ParseRAMAssignments(c, *set); err != nil {
+				return usagef("%v", err)
+			}
+
+			executed, runErr := c.Run(*maxCycles)
+			fmt.Fprintf(e.stdout, "cycles: %d\nA: %d\nD: %d\nPC: %d", executed, c.A, c.D, c.PC)
+			if entry, ok := sourceMap.Lookup(int(c.PC)); ok {
+				fmt.Fprintf(e.stdout, " (%s:%d)", entry.File, entry.Line)
+			}
+			fmt.Fprintln(e.stdout)
+			if err := e.dumpRAM(c, start, end); err != nil {
+				return err
+			}
+			if runErr != nil {
+				return runErr
+			}
+			if !c.Halted() {
+				return exitError{code: exitNoHalt, msg: fmt.Sprintf("program did not halt within %d cycles", *maxCycles)}
+			}
+			e.debugf("halted after %d cycles", executed)
+			return nil
+		}
+	},
+}
+
+// interpret runs the VM program of the input on the VM interpreter and prints the state like the run command. The input is a .jack or .vm file or a directory.
+func (e *env) interpret(input string, f *buildFlags, maxSteps int, set string, start, end int) error {
+	if ext := filepath.Ext(input); ext != ".jack" && ext != ".vm" && !isDir(input) {
+		return usagef("-vm needs a .jack or .vm file or a directory, got %s", input)
+	}
+	sources, err := e.vmSources(input, f)
+	if err != nil {
+		return err
+	}
+	opts := vminterpreter.Options{}
+	if opts.Bootstrap, err = bootstrapFlag(sources, f.bootstrap); err != nil {
+		return err
+	}
+	var vmSources []vmtranslator.Source
+	for _, s := range sources {
+		vmSources = append(vmSources, vmtranslator.Source{Name: s.name, File: bytes.NewReader(s.code), Path: s.path})
+	}
+	m, err := vminterpreter.Load(vmSources, opts)
+	if err != nil {
+		return err
+	}
+	if err := emulator.ParseRAMAssignments(m, set); err != nil {
+		return usagef("%v", err)
+	}
+
+	executed, runErr := m.Run(maxSteps)
+	file, line, function := m.Position()
+	fmt.Fprintf(e.stdout, "steps: %d\nat: %s:%d", executed, file, line)
+	if function != "" {
+		fmt.Fprintf(e.stdout, " (%s)", function)
+	}
+	fmt.Fprintln(e.stdout)
+	if err := e.dumpRAM(m, start, end); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if !m.Halted() {
+		return exitError{code: exitNoHalt, msg: fmt.Sprintf("program did not halt within %d steps", maxSteps)}
+	}
+	e.debugf("halted after %d steps", executed)
+	return nil
+}
+
+// dumpRAM prints RAM[start..end-1].
+func (e *env) dumpRAM(mem emulator.Memory, start, end int) error {
+	for addr := start; addr < end; addr++ {
+		v, err := mem.Peek(addr)
+		if err != nil {
+			return usagef("%v", err)
+		}
+		fmt.Fprintf(e.stdout, "RAM[%d]: %d\n", addr, v)
+	}
+	return nil
+}
+
+// listFlags is the value of a flag that can be given more than once.
+type listFlags []string
+
+func (l *listFlags) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlags) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
@@ -0,0 +1,201 @@
+// n2t is the command line tool of the whole Hack toolchain: the Jack compiler, the VM translator, the assembler and the CPU emulator.
+//
+// usage: n2t <command> [flags] [arguments]
+//
+// Generated files and reports are written only where the flags say, and "-" means stdin or stdout, so the commands can be chained in scripts and Makefiles. Messages go to stderr. The exit code is 0 on success, 1 if the input has errors or a file cannot be read or written, 2 if the command line is invalid and 3 if a program run by "n2t run" does not halt.
+//
+//	n2t jack Square            # compiles Square/*.jack to Square/*.vm
+//	n2t vm -o - Prog.vm        # prints the assembly code
+//	n2t build -lib os Pong     # compiles, translates and assembles Pong to Pong/Pong.hack
+//	n2t run -set 0=3 Prog.asm  # assembles Prog.asm in memory and runs it
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// exit codes
+const (
+	exitOK      = 0
+	exitFailure = 1 // the input has errors or a file cannot be read or written
+	exitUsage   = 2 // the command line is invalid
+	exitNoHalt  = 3 // the program run by "n2t run" did not halt within the cycle limit
+)
+
+// command is a struct that represents a subcommand of n2t.
+type command struct {
+	name    string
+	args    string // the arguments in the usage line. Example: "[input.asm|-]"
+	summary string
+	// setup defines the flags of the command on fs and returns the function that runs the command with the arguments after the flags
+	setup func(fs *flag.FlagSet) func(e *env, args []string) error
+}
+
+// commands lists the subcommands in the order of the help message.
+var commands = []*command{asmCommand, disasmCommand, linkCommand, lintCommand, fmtCommand, vmCommand, jackCommand, buildCommand, runCommand}
+
+// env is a struct that represents the standard streams and the verbosity of a run of n2t.
+type env struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	quiet          bool // -q: only errors are printed
+	verbose        bool // -v: each step is printed
+}
+
+// infof prints a message such as a warning or a report to stderr unless -q is given.
+func (e *env) infof(format string, args ...any) {
+	if !e.quiet {
+		fmt.Fprintf(e.stderr, format+"\n", args...)
+	}
+}
+
+// debugf prints a message about a step to stderr if -v is given.
+func (e *env) debugf(format string, args ...any) {
+	if e.verbose && !e.quiet {
+		fmt.Fprintf(e.stderr, format+"\n", args...)
+	}
+}
+
+// usageError is an error of the command line. It makes n2t exit with exitUsage.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// usagef returns a usageError.
+func usagef(format string, args ...any) error {
+	return usageError{fmt.Sprintf(format, args...)}
+}
+
+// exitError is an error with its own exit code. An empty message prints nothing.
+type exitError struct {
+	code int
+	msg  string
+}
+
+func (e exitError) Error() string {
+	return e.msg
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs n2t with the given arguments and streams and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	e := &env{stdin: stdin, stdout: stdout, stderr: stderr}
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+	var cmd *command
+	for _, c := range commands {
+		if c.name == args[0] {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "n2t: unknown command %q\n", args[0])
+		printUsage(stderr)
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet("n2t "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.BoolVar(&e.quiet, "q", false, "print only errors")
+	fs.BoolVar(&e.verbose, "v", false, "print each step")
+	runCmd := cmd.setup(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: n2t %s [flags] %s\n\n%s\n\nflags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	err := runCmd(e, fs.Args())
+	var usageErr usageError
+	var exitErr exitError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(stderr, "n2t %s: %v\n", cmd.name, err)
+		fs.Usage()
+		return exitUsage
+	case errors.As(err, &exitErr):
+		if exitErr.msg != "" {
+			fmt.Fprintf(stderr, "n2t %s: %s\n", cmd.name, exitErr.msg)
+		}
+		return exitErr.code
+	}
+	// diagnostics have one problem per line
+	for _, line := range strings.Split(err.Error(), "\n") {
+		fmt.Fprintf(stderr, "n2t %s: %s\n", cmd.name, line)
+	}
+	return exitFailure
+}
+
+// printUsage prints the list of the commands.
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: n2t <command> [flags] [arguments]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-7s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nRun \"n2t <command> -h\" for the flags of a command. \"-\" as a file name means stdin or stdout.")
+}
+
+// readInput reads the input file. "-" reads stdin.
+func (e *env) readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(e.stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// writeOutput writes the output file. "-" writes stdout. Outputs are written only after the command succeeds, so a failed run leaves no partial file.
+func (e *env) writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := e.stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	e.debugf("wrote %s", path)
+	return nil
+}
+
+// singleInput returns the only argument, or "-" if there is none.
+func singleInput(args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		return "-", nil
+	case 1:
+		return args[0], nil
+	}
+	return "", usagef("want one input, got %d", len(args))
+}
+
+// displayName returns the name of the input used in diagnostics. Example: "-" -> "stdin"
+func displayName(path string) string {
+	if path == "-" {
+		return "stdin"
+	}
+	return path
+}
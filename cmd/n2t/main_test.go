@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runN2t runs n2t with the given arguments and stdin and returns the exit code, stdout and stderr.
+func runN2t(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr strings.Builder
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestExitCodes(t *testing.T) {
+	// an infinite loop that is not the terminating loop (END) @END 0;JMP
+	loop := filepath.Join(t.TempDir(), "Loop.asm")
+	if err := os.WriteFile(loop, []byte("(LOOP)\n@1\nD=A\n@LOOP\n0;JMP\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// a function that returns with an empty stack
+	empty := filepath.Join(t.TempDir(), "Empty.vm")
+	if err := os.WriteFile(empty, []byte("function Empty.f 0\nreturn\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		code  int
+	}{
+		{"no command", "", nil, exitUsage},
+		{"unknown command", "", []string{"make"}, exitUsage},
+		{"unknown flag", "", []string{"asm", "-x"}, exitUsage},
+		{"help", "", []string{"asm", "-h"}, exitOK},
+		{"assembled", "@1\nD=A\n", []string{"asm"}, exitOK},
+		{"invalid instruction", "D=X\n", []string{"asm"}, exitFailure},
+		{"missing file", "", []string{"asm", "NoSuchFile.asm"}, exitFailure},
+		{"lint warnings", "(LOOP)\n@1\n", []string{"lint"}, exitFailure},
+		{"stack errors", "", []string{"lint", empty}, exitFailure},
+		{"optimization level", "push constant 2\npush constant 3\nadd\n", []string{"vm", "-O=2"}, exitOK},
+		{"invalid optimization level", "", []string{"vm", "-O=3"}, exitUsage},
+		{"not halted", "", []string{"run", "-cycles", "10", loop}, exitNoHalt},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code, _, stderr := runN2t(test.stdin, test.args...); code != test.code {
+				t.Errorf("n2t %v exited with %d, want %d\nstderr: %s", test.args, code, test.code, stderr)
+			}
+		})
+	}
+}
+
+func TestStdinToStdout(t *testing.T) {
+	code, stdout, stderr := runN2t("@2\nD=A\n@3\nD=D+A\n", "asm", "-q")
+	if code != exitOK {
+		t.Fatalf("n2t asm exited with %d: %s", code, stderr)
+	}
+	if want := "0000000000000010\n1110110000010000\n0000000000000011\n1110000010010000\n"; stdout != want {
+		t.Errorf("n2t asm printed %q, want %q", stdout, want)
+	}
+	if stderr != "" {
+		t.Errorf("n2t asm -q printed %q to stderr, want nothing", stderr)
+	}
+
+	// the output of each stage can be the input of the next
+	code, asm, stderr := runN2t("push constant 7\npush constant 8\nadd\n", "vm")
+	if code != exitOK {
+		t.Fatalf("n2t vm exited with %d: %s", code, stderr)
+	}
+	code, stdout, stderr = runN2t(asm, "asm")
+	if code != exitOK || !strings.HasPrefix(stdout, "0000000000000111\n") {
+		t.Errorf("n2t asm of the VM output exited with %d and printed %q: %s", code, stdout, stderr)
+	}
+}
+
+func TestBuildAndRun(t *testing.T) {
+	dir := t.TempDir()
+	sys := "function Sys.init 0\npush constant 3\npush constant 4\ncall Main.add 2\npop static 0\nlabel END\ngoto END\n"
+	main := "function Main.add 0\npush argument 0\npush argument 1\nadd\nreturn\n"
+	for name, code := range map[string]string{"Sys.vm": sys, "Main.vm": main} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(code), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	code, _, stderr := runN2t("", "build", "-keep", dir)
+	if code != exitOK {
+		t.Fatalf("n2t build exited with %d: %s", code, stderr)
+	}
+	for _, ext := range []string{".asm", ".hack"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.Base(dir)+ext)); err != nil {
+			t.Errorf("n2t build did not write the %s file: %v", ext, err)
+		}
+	}
+
+	// Sys.static 0 is the first variable at RAM address 16
+	code, stdout, stderr := runN2t("", "run", "-dump", "16:17", dir)
+	if code != exitOK {
+		t.Fatalf("n2t run exited with %d: %s", code, stderr)
+	}
+	if !strings.HasSuffix(stdout, "RAM[16]: 7\n") {
+		t.Errorf("n2t run printed %q, want RAM[16]: 7", stdout)
+	}
+
+	// the VM interpreter leaves the same static variable
+	code, stdout, stderr = runN2t("", "run", "-vm", "-dump", "16:17", dir)
+	if code != exitOK {
+		t.Fatalf("n2t run -vm exited with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "(Sys.init)") || !strings.HasSuffix(stdout, "RAM[16]: 7\n") {
+		t.Errorf("n2t run -vm printed %q, want the position in Sys.init and RAM[16]: 7", stdout)
+	}
+}
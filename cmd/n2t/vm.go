@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/jackcompiler/jackanalyzer"
+	"github.com/Kaichi-Irie/nand2tetris-go/progress"
+	"github.com/Kaichi-Irie/nand2tetris-go/vm/vmtranslator"
+)
+
+// vmSource is a struct that represents a VM file in memory. name is the base name without the .vm extension and path is the file used in errors. Example: {"Main", "Pong/Main.vm", code}
+type vmSource struct {
+	name string
+	path string
+	code []byte
+}
+
+// filesIn returns the files with the extension in the directory in sorted order.
+func filesIn(dir, ext string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// stem returns the base name of the path without the extension. Example: "Pong/Main.jack" -> "Main"
+func stem(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// readVMSources reads the VM files given as .vm files, directories or "-". The VM code from stdin is named "Main".
+func (e *env) readVMSources(paths []string) ([]vmSource, error) {
+	var sources []vmSource
+	for _, path := range paths {
+		var files []string
+		switch {
+		case path == "-":
+			code, err := e.readInput(path)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, vmSource{name: "Main", path: displayName(path), code: code})
+			continue
+		case isDir(path):
+			var err error
+			if files, err = filesIn(path, ".vm"); err != nil {
+				return nil, err
+			}
+		case filepath.Ext(path) == ".vm":
+			files = []string{path}
+		default:
+			return nil, usagef("input %s must be a .vm file or a directory", path)
+		}
+		for _, file := range files {
+			code, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, vmSource{name: stem(file), path: file, code: code})
+		}
+	}
+	return sources, nil
+}
+
+// lintVM prints the parse errors and the stack errors of a .vm file or the .vm files of a directory to stdout. It returns true if there are any.
+func (e *env) lintVM(path string) (bool, error) {
+	sources, err := e.readVMSources([]string{path})
+	if err != nil {
+		return false, err
+	}
+	found := false
+	for _, source := range sources {
+		_, err := vmtranslator.VerifyStackFile(bytes.NewReader(source.code), source.path)
+		var parseErrs vmtranslator.ParseErrors
+		var stackErrs vmtranslator.StackErrors
+		switch {
+		case err == nil:
+			continue
+		case errors.As(err, &parseErrs), errors.As(err, &stackErrs):
+			fmt.Fprintln(e.stdout, err)
+			found = true
+		default:
+			return false, err
+		}
+	}
+	return found, nil
+}
+
+// addLibraries appends the VM files of the library directories whose names are not in sources. Example: the .vm files of the Jack OS
+func (e *env) addLibraries(sources []vmSource, libs []string) ([]vmSource, error) {
+	for _, lib := range libs {
+		if !isDir(lib) {
+			return nil, fmt.Errorf("library %s is not a directory", lib)
+		}
+		files, err := filesIn(lib, ".vm")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if slices.ContainsFunc(sources, func(s vmSource) bool { return s.name == stem(file) }) {
+				continue
+			}
+			code, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, vmSource{name: stem(file), path: file, code: code})
+			e.debugf("using %s", file)
+		}
+	}
+	return sources, nil
+}
+
+// translate translates the VM files to Hack assembly code. bootstrap is "auto", "on" or "off" as in bootstrapFlag. level is the optimization level of the -O flag.
+func (e *env) translate(sources []vmSource, bootstrap string, level vmtranslator.Level) ([]byte, error) {
+	opts := vmtranslator.Options{Progress: progress.Func(func(ev progress.Event) {
+		switch ev.Kind {
+		case progress.FileFinished:
+			e.debugf("translated %s: %d VM commands in %v", ev.File, ev.Count, ev.Elapsed)
+		case progress.Report:
+			e.infof("%s", ev.Message)
+		}
+	})}
+	level.Apply(&opts)
+	var err error
+	if opts.Bootstrap, err = bootstrapFlag(sources, bootstrap); err != nil {
+		return nil, err
+	}
+
+	var vmSources []vmtranslator.Source
+	for _, s := range sources {
+		vmSources = append(vmSources, vmtranslator.Source{Name: s.name, File: bytes.NewReader(s.code), Path: s.path})
+	}
+	var out bytes.Buffer
+	report, err := vmtranslator.TranslateSources(&out, vmSources, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Optimize {
+		e.infof("%v", report)
+	}
+	return out.Bytes(), nil
+}
+
+// bootstrapFlag returns whether the bootstrap code that calls Sys.init is written. bootstrap is "auto", "on" or "off". With "auto", the bootstrap code is written if there is a Sys.vm.
+func bootstrapFlag(sources []vmSource, bootstrap string) (bool, error) {
+	hasSys := slices.ContainsFunc(sources, func(s vmSource) bool { return s.name == "Sys" })
+	switch bootstrap {
+	case "auto":
+		return hasSys, nil
+	case "on":
+		if !hasSys {
+			return false, fmt.Errorf("the bootstrap code calls Sys.init, but there is no Sys.vm")
+		}
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return false, usagef("invalid -bootstrap %q: want auto, on or off", bootstrap)
+}
+
+// defaultOutput returns the output of a single file or directory input with the extension. Example: "Prog.vm" -> "Prog.asm", "Pong" -> "Pong/Pong.asm", "-" -> "-"
+func defaultOutput(input, ext string) string {
+	if isDir(input) {
+		return filepath.Join(input, filepath.Base(filepath.Clean(input))+ext)
+	}
+	return replaceExt(input, ext)
+}
+
+var vmCommand = &command{
+	name:    "vm",
+	args:    "[input.vm|directory|-]...",
+	summary: "translate VM files into an assembly file",
+	setup: func(fs *flag.FlagSet) func(e *env, args []string) error {
+		output := fs.String("o", "", "the output file. The default is <input>.asm, <directory>/<directory>.asm, or stdout for stdin. It is required for several inputs")
+		var level vmtranslator.Level
+		fs.Var(&level, "O", "the optimization level: -O (or -O=1) removes redundant instructions with the peephole optimizer, and -O=2 also optimizes the VM code. Comments are removed")
+		bootstrap := fs.String("bootstrap", "auto", "write the bootstrap code that calls Sys.init: auto (if there is a Sys.vm), on or off. Without it, an infinite loop is written at the end")
+		return func(e *env, args []string) error {
+			if len(args) == 0 {
+				args = []string{"-"}
+			}
+			if *output == "" {
+				if len(args) > 1 {
+					return usagef("-o is required for several inputs")
+				}
+				*output = defaultOutput(args[0], ".asm")
+			}
+			sources, err := e.readVMSources(args)
+			if err != nil {
+				return err
+			}
+			asm, err := e.translate(sources, *bootstrap, level)
+			if err != nil {
+				return err
+			}
+			return e.writeOutput(*output, asm)
+		}
+	},
+}
+
+// jackSource is a struct that represents a Jack class to compile. path is "-" for stdin.
+type jackSource struct {
+	path string
+	code []byte
+}
+
+// readJackSources reads the Jack files given as .jack files, directories or "-".
+func (e *env) readJackSources(paths []string) ([]jackSource, error) {
+	var sources []jackSource
+	for _, path := range paths {
+		var files []string
+		switch {
+		case path == "-":
+			files = []string{path}
+		case isDir(path):
+			var err error
+			if files, err = filesIn(path, ".jack"); err != nil {
+				return nil, err
+			}
+		case filepath.Ext(path) == ".jack":
+			files = []string{path}
+		default:
+			return nil, usagef("input %s must be a .jack file or a directory", path)
+		}
+		for _, file := range files {
+			code, err := e.readInput(file)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, jackSource{path: file, code: code})
+		}
+	}
+	return sources, nil
+}
+
+// compile compiles a Jack class to VM code.
+func (e *env) compile(source jackSource) ([]byte, error) {
+	if len(bytes.TrimSpace(source.code)) == 0 {
+		return nil, fmt.Errorf("%s: no class", displayName(source.path))
+	}
+	var out bytes.Buffer
+	if err := jackanalyzer.Compile(&out, bytes.NewReader(source.code)); err != nil {
+		return nil, fmt.Errorf("%s: %w", displayName(source.path), err)
+	}
+	e.debugf("compiled %s", displayName(source.path))
+	return out.Bytes(), nil
+}
+
+var jackCommand = &command{
+	name:    "jack",
+	args:    "[input.jack|directory|-]...",
+	summary: "compile Jack classes into VM files",
+	setup: func(fs *flag.FlagSet) func(e *env, args []string) error {
+		output := fs.String("o", "", "the output file of a single class. \"-\" is stdout. The default is <input>.vm, or stdout for stdin")
+		dir := fs.String("d", "", "the directory of the output files. The default is the directory of each input")
+		return func(e *env, args []string) error {
+			if len(args) == 0 {
+				args = []string{"-"}
+			}
+			if *output != "" && *dir != "" {
+				return usagef("-o and -d cannot be used together")
+			}
+			sources, err := e.readJackSources(args)
+			if err != nil {
+				return err
+			}
+			if *output != "" && len(sources) != 1 {
+				return usagef("-o needs exactly one class, got %d", len(sources))
+			}
+			// compile everything before writing, so an error leaves no files
+			codes := make([][]byte, len(sources))
+			for i, source := range sources {
+				if codes[i], err = e.compile(source); err != nil {
+					return err
+				}
+			}
+			for i, source := range sources {
+				path := *output
+				switch {
+				case path != "":
+				case *dir != "" && source.path != "-":
+					path = filepath.Join(*dir, stem(source.path)+".vm")
+				default:
+					path = replaceExt(source.path, ".vm")
+				}
+				if err := e.writeOutput(path, codes[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	},
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/assembler/hack"
+	"github.com/Kaichi-Irie/nand2tetris-go/emulator"
+)
+
+// usage: go run ./emulator/cmd [-cycles n] [-set addr=value,...] [-dump start:end] [-map input.map.json] [-isa name|file] <input.hack>
+func main() {
+	maxCycles := flag.Int("cycles", 1000000, "the maximum number of instructions to execute. 0 means no limit")
+	set := flag.String("set", "", "comma separated RAM values to set before running. Example: 0=2,1=3")
+	dump := flag.String("dump", "0:16", "the RAM range to print after running. Example: 0:16")
+	mapFile := flag.String("map", "", "the source map written by the assembler. The source line of PC is printed if given")
+	isaName := flag.String("isa", "hack", "the instruction set of the CPU: a registered name (hack, hack-shift) or an ISA file")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: emulator [-cycles n] [-set addr=value,...] [-dump start:end] [-map input.map.json] [-isa name|file] <input.hack>")
+		os.Exit(2)
+	}
+
+	c, err := emulator.NewFromFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if c.ISA, err = hack.FindISA(*isaName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := emulator.ParseRAMAssignments(c, *set); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	start, end, err := emulator.ParseRange(*dump)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var sourceMap hack.SourceMap
+	if *mapFile != "" {
+		sourceMap, err = hack.ReadSourceMapFromFile(*mapFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	executed, err := c.Run(*maxCycles)
+	fmt.Printf("cycles: %d\nA: %d\nD: %d\nPC: %d", executed, c.A, c.D, c.PC)
+	if e, ok := sourceMap.Lookup(int(c.PC)); ok {
+		fmt.Printf(" (%s:%d)", e.File, e.Line)
+	}
+	fmt.Println()
+	for addr := start; addr < end; addr++ {
+		v, perr := c.Peek(addr)
+		if perr != nil {
+			fmt.Fprintln(os.Stderr, perr)
+			os.Exit(2)
+		}
+		fmt.Printf("RAM[%d]: %d\n", addr, v)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if !c.Halted() {
+		fmt.Fprintf(os.Stderr, "program did not halt within %d cycles\n", *maxCycles)
+		os.Exit(3)
+	}
+}
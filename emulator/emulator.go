@@ -0,0 +1,209 @@
+// emulator package simulates the Hack computer. It loads a Hack binary program into ROM and executes it cycle by cycle on the Hack CPU, RAM, SCREEN and KBD memory maps.
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/assembler/hack"
+)
+
+const (
+	ROMSize    = 32768 // the number of words in the instruction memory
+	RAMSize    = 24577 // the number of addressable words in the data memory, RAM[0..16383] + SCREEN + KBD
+	ScreenBase = 16384 // the base address of the screen memory map
+	ScreenSize = 8192  // the number of words in the screen memory map
+	KBD        = 24576 // the address of the keyboard memory map
+)
+
+// ErrHalted is returned by Step when the program has reached its terminating infinite loop. Example: (END) @END 0;JMP
+var ErrHalted = errors.New("program halted")
+
+// Computer is a struct that represents the state of the Hack computer: ROM, RAM (including SCREEN and KBD), the A and D registers and the program counter.
+type Computer struct {
+	ROM      [ROMSize]uint16
+	RAM      [RAMSize]int16
+	A        int16
+	D        int16
+	PC       uint16
+	Cycles   int       // the number of executed instructions
+	ROMCount int       // the number of instructions loaded into ROM
+	ISA      *hack.ISA // the instruction set of the CPU. nil means the standard Hack instruction set
+}
+
+// New returns a new Computer with empty ROM and RAM.
+func New() *Computer {
+	return &Computer{}
+}
+
+// NewFromFile returns a new Computer with the given binary code file loaded into ROM. The format of the file is detected from its extension. Example: ".hack", ".bin", ".hex"
+func NewFromFile(hackFilePath string) (*Computer, error) {
+	format, err := hack.FormatFromPath(hackFilePath)
+	if err != nil {
+		return nil, err
+	}
+	hackFile, err := os.Open(hackFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer hackFile.Close()
+
+	c := New()
+	if err := c.LoadFormat(hackFile, format); err != nil {
+		return nil, fmt.Errorf("load %s: %w", hackFilePath, err)
+	}
+	return c, nil
+}
+
+// Load reads a Hack binary program and loads it into ROM starting at address 0. Each line of the input must be a 16-bit binary number written with "0" and "1". Empty lines are ignored. The input is the same format as the output of [hack.Hack].
+func (c *Computer) Load(hackFile io.Reader) error {
+	return c.LoadFormat(hackFile, hack.FormatHack)
+}
+
+// LoadFormat reads a Hack binary program in the given format and loads it into ROM starting at address 0.
+func (c *Computer) LoadFormat(hackFile io.Reader, format hack.Format) error {
+	words, err := hack.ReadWords(hackFile, format)
+	if err != nil {
+		return err
+	}
+	return c.LoadWords(words)
+}
+
+// LoadWords loads the given instructions into ROM starting at address 0.
+func (c *Computer) LoadWords(words []uint16) error {
+	if len(words) > ROMSize {
+		return fmt.Errorf("program of %d instructions exceeds ROM size %d", len(words), ROMSize)
+	}
+	c.ROM = [ROMSize]uint16{}
+	copy(c.ROM[:], words)
+	c.ROMCount = len(words)
+	return nil
+}
+
+// Reset sets the program counter to 0 as the reset bit of the Hack CPU does. RAM, ROM and the registers are kept.
+func (c *Computer) Reset() {
+	c.PC = 0
+	c.Cycles = 0
+}
+
+// Peek returns the value of RAM[addr]. It returns an error if addr is out of the data memory.
+func (c *Computer) Peek(addr int) (int16, error) {
+	if addr < 0 || addr >= RAMSize {
+		return 0, fmt.Errorf("address %d is out of RAM", addr)
+	}
+	return c.RAM[addr], nil
+}
+
+// Poke sets RAM[addr] to value. It returns an error if addr is out of the data memory.
+func (c *Computer) Poke(addr int, value int16) error {
+	if addr < 0 || addr >= RAMSize {
+		return fmt.Errorf("address %d is out of RAM", addr)
+	}
+	c.RAM[addr] = value
+	return nil
+}
+
+// SetKey sets the keyboard memory map to the given key code. 0 means no key is pressed.
+func (c *Computer) SetKey(key int16) {
+	c.RAM[KBD] = key
+}
+
+// Screen returns the screen memory map. The returned slice shares memory with RAM.
+func (c *Computer) Screen() []int16 {
+	return c.RAM[ScreenBase : ScreenBase+ScreenSize]
+}
+
+// Halted returns true if the current instruction is the terminating infinite loop of a Hack program: an A instruction that loads its own address followed by an unconditional jump. Example: (END) @END 0;JMP
+func (c *Computer) Halted() bool {
+	pc := int(c.PC)
+	if pc+1 >= ROMSize {
+		return false
+	}
+	a, j := c.ROM[pc], c.ROM[pc+1]
+	return isAInstruction(a) && int(a) == pc && !isAInstruction(j) && j&0b111 == 0b111
+}
+
+// Step executes the instruction at ROM[PC]. It returns [ErrHalted] without executing anything if the program has reached its terminating infinite loop.
+func (c *Computer) Step() error {
+	if c.Halted() {
+		return ErrHalted
+	}
+	inst := c.ROM[c.PC]
+	if isAInstruction(inst) {
+		c.A = int16(inst)
+		c.PC++
+		c.Cycles++
+		return nil
+	}
+
+	// C instruction: 1xxa cccc ccdd djjj. M is read only if the a bit is set
+	var m int16
+	if inst>>12&1 == 1 {
+		var err error
+		if m, err = c.Peek(int(uint16(c.A))); err != nil {
+			return fmt.Errorf("pc %d: %w", c.PC, err)
+		}
+	}
+	out := c.ISA.Compute(inst, c.D, c.A, m)
+
+	// the jump target is the value of A before the instruction is executed
+	target := uint16(c.A)
+	if inst>>3&1 == 1 {
+		if err := c.writeMemory(int(uint16(c.A)), out); err != nil {
+			return fmt.Errorf("pc %d: %w", c.PC, err)
+		}
+	}
+	if inst>>4&1 == 1 {
+		c.D = out
+	}
+	if inst>>5&1 == 1 {
+		c.A = out
+	}
+	if jumps(out, inst&0b111) {
+		if target >= ROMSize {
+			return fmt.Errorf("pc %d: jump address %d is out of ROM", c.PC, target)
+		}
+		c.PC = target
+	} else {
+		c.PC++
+	}
+	c.Cycles++
+	return nil
+}
+
+// Run executes instructions until the program halts or maxCycles instructions have been executed. If maxCycles is 0 or negative, Run executes until the program halts. It returns the number of executed instructions. Reaching the terminating infinite loop is not an error.
+func (c *Computer) Run(maxCycles int) (int, error) {
+	executed := 0
+	for maxCycles <= 0 || executed < maxCycles {
+		err := c.Step()
+		if errors.Is(err, ErrHalted) {
+			return executed, nil
+		}
+		if err != nil {
+			return executed, err
+		}
+		executed++
+	}
+	return executed, nil
+}
+
+// writeMemory writes value to RAM[addr]. Writes to the keyboard memory map are ignored as in the Hack platform.
+func (c *Computer) writeMemory(addr int, value int16) error {
+	if addr == KBD {
+		return nil
+	}
+	return c.Poke(addr, value)
+}
+
+// isAInstruction returns true if the most significant bit of the given instruction is 0
+func isAInstruction(inst uint16) bool {
+	return inst>>15 == 0
+}
+
+// jumps returns true if the jump condition given by the 3 jump bits j1 j2 j3 holds for the ALU output.
+func jumps(out int16, jjj uint16) bool {
+	lt, eq, gt := jjj>>2&1 == 1, jjj>>1&1 == 1, jjj&1 == 1
+	return lt && out < 0 || eq && out == 0 || gt && out > 0
+}
@@ -0,0 +1,281 @@
+package emulator
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/assembler/hack"
+)
+
+// assemble converts the given Hack assembly code to a new Computer with the binary code loaded into ROM.
+func assemble(t *testing.T, asmCode string) *Computer {
+	t.Helper()
+	hackFile := &bytes.Buffer{}
+	if err := hack.Hack(strings.NewReader(asmCode), hackFile); err != nil {
+		t.Fatalf("Hack failed: %v", err)
+	}
+	c := New()
+	if err := c.Load(hackFile); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return c
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []uint16
+		hasError bool
+	}{
+		{"0000000000000010\n1110110000010000\n", []uint16{2, 0b1110110000010000}, false},
+		{"\n0000000000000111\n\n", []uint16{7}, false},
+		{"000000000000001\n", nil, true},  // 15 bits
+		{"000000000000002a\n", nil, true}, // invalid character
+	}
+	for _, test := range tests {
+		c := New()
+		err := c.Load(strings.NewReader(test.input))
+		if (err != nil) != test.hasError {
+			t.Errorf("Load(%q) error = %v, want error: %v", test.input, err, test.hasError)
+			continue
+		}
+		if test.hasError {
+			continue
+		}
+		if c.ROMCount != len(test.expected) {
+			t.Errorf("Load(%q) loaded %d instructions, want %d", test.input, c.ROMCount, len(test.expected))
+		}
+		for i, want := range test.expected {
+			if c.ROM[i] != want {
+				t.Errorf("Load(%q) ROM[%d] = %016b, want %016b", test.input, i, c.ROM[i], want)
+			}
+		}
+	}
+}
+
+func TestStep(t *testing.T) {
+	c := assemble(t, `@7
+D=A
+@3
+D=D-A
+@100
+M=D
+AM=M+1
+`)
+	for range 7 {
+		if err := c.Step(); err != nil {
+			t.Fatalf("Step failed: %v", err)
+		}
+	}
+	if c.D != 4 {
+		t.Errorf("D = %d, want 4", c.D)
+	}
+	// AM=M+1 writes RAM[100] with the old A and then sets A
+	if c.RAM[100] != 5 {
+		t.Errorf("RAM[100] = %d, want 5", c.RAM[100])
+	}
+	if c.A != 5 {
+		t.Errorf("A = %d, want 5", c.A)
+	}
+	if c.PC != 7 || c.Cycles != 7 {
+		t.Errorf("PC = %d, Cycles = %d, want 7, 7", c.PC, c.Cycles)
+	}
+}
+
+func TestComp(t *testing.T) {
+	// every comp mnemonic with D=5, A=3 and M=RAM[3]=-2
+	tests := []struct {
+		comp     string
+		expected int16
+	}{
+		{"0", 0}, {"1", 1}, {"-1", -1},
+		{"D", 5}, {"A", 3}, {"M", -2},
+		{"!D", ^5}, {"!A", ^3}, {"!M", ^-2},
+		{"-D", -5}, {"-A", -3}, {"-M", 2},
+		{"D+1", 6}, {"A+1", 4}, {"M+1", -1},
+		{"D-1", 4}, {"A-1", 2}, {"M-1", -3},
+		{"D+A", 8}, {"D+M", 3},
+		{"D-A", 2}, {"D-M", 7},
+		{"A-D", -2}, {"M-D", -7},
+		{"D&A", 5 & 3}, {"D&M", 5 & -2},
+		{"D|A", 5 | 3}, {"D|M", 5 | -2},
+	}
+	for _, test := range tests {
+		c := assemble(t, "@5\nD=A\n@3\nD="+test.comp+"\n")
+		c.RAM[3] = -2
+		if _, err := c.Run(4); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		if c.D != test.expected {
+			t.Errorf("D=%s: D = %d, want %d", test.comp, c.D, test.expected)
+		}
+	}
+}
+
+func TestJump(t *testing.T) {
+	tests := []struct {
+		jump  string
+		value int16
+		taken bool
+	}{
+		{"JGT", 1, true}, {"JGT", 0, false}, {"JGT", -1, false},
+		{"JEQ", 0, true}, {"JEQ", 1, false},
+		{"JGE", 0, true}, {"JGE", -1, false},
+		{"JLT", -1, true}, {"JLT", 0, false},
+		{"JNE", 1, true}, {"JNE", 0, false},
+		{"JLE", 0, true}, {"JLE", 1, false},
+		{"JMP", 1, true},
+	}
+	for _, test := range tests {
+		c := assemble(t, "@0\nD=M\n@10\nD;"+test.jump+"\n")
+		c.RAM[0] = test.value
+		if _, err := c.Run(4); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		want := uint16(4)
+		if test.taken {
+			want = 10
+		}
+		if c.PC != want {
+			t.Errorf("D;%s with D=%d: PC = %d, want %d", test.jump, test.value, c.PC, want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		asmFilePath string
+		ram         map[int]int16
+		expected    map[int]int16
+		halts       bool
+	}{
+		// Add.asm has no terminating loop, so it runs until the budget is exhausted
+		{"../assembler/asm_files/add/Add.asm", nil, map[int]int16{0: 5}, false},
+		{"../assembler/asm_files/max/Max.asm", map[int]int16{0: 3, 1: 8}, map[int]int16{2: 8}, true},
+		{"../assembler/asm_files/max/Max.asm", map[int]int16{0: 9, 1: -4}, map[int]int16{2: 9}, true},
+		{"../assembler/asm_files/rect/Rect.asm", map[int]int16{0: 3}, map[int]int16{ScreenBase: -1, ScreenBase + 32: -1, ScreenBase + 64: -1, ScreenBase + 96: 0}, true},
+	}
+	for _, test := range tests {
+		asmCode, err := os.ReadFile(test.asmFilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := assemble(t, string(asmCode))
+		for addr, v := range test.ram {
+			c.RAM[addr] = v
+		}
+		if _, err := c.Run(10000); err != nil {
+			t.Fatalf("%s: Run failed: %v", test.asmFilePath, err)
+		}
+		if c.Halted() != test.halts {
+			t.Errorf("%s: Halted() = %v, want %v", test.asmFilePath, c.Halted(), test.halts)
+		}
+		for addr, want := range test.expected {
+			if got, _ := c.Peek(addr); got != want {
+				t.Errorf("%s: RAM[%d] = %d, want %d", test.asmFilePath, addr, got, want)
+			}
+		}
+	}
+}
+
+func TestRunBudget(t *testing.T) {
+	// an infinite loop that is not a terminating loop
+	c := assemble(t, "(LOOP)\n@0\nM=M+1\n@LOOP\n0;JMP\n")
+	executed, err := c.Run(100)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if executed != 100 || c.Halted() {
+		t.Errorf("Run(100) executed %d instructions, halted: %v", executed, c.Halted())
+	}
+	if c.RAM[0] != 25 {
+		t.Errorf("RAM[0] = %d, want 25", c.RAM[0])
+	}
+}
+
+func TestStepErrors(t *testing.T) {
+	c := assemble(t, "@32767\nA=A+1\nM=1\n")
+	c.Run(2)
+	if err := c.Step(); err == nil {
+		t.Errorf("expected an error when writing out of RAM")
+	}
+
+	c = assemble(t, "@END\n0;JMP\n(END)\n@END\n0;JMP\n")
+	c.Run(0)
+	if err := c.Step(); !errors.Is(err, ErrHalted) {
+		t.Errorf("Step() = %v, want ErrHalted", err)
+	}
+}
+
+func TestKeyboard(t *testing.T) {
+	c := assemble(t, "@KBD\nD=M\nM=1\n")
+	c.SetKey(65)
+	c.Run(3)
+	if c.D != 65 {
+		t.Errorf("D = %d, want 65", c.D)
+	}
+	if c.RAM[KBD] != 65 {
+		t.Errorf("RAM[KBD] = %d, want 65: writes to KBD must be ignored", c.RAM[KBD])
+	}
+}
+
+func TestShiftISA(t *testing.T) {
+	isa, _ := hack.LookupISA("hack-shift")
+	result, err := hack.Assemble(strings.NewReader("@R0\nD=M\nD=D<<\nD=D<<\n@R1\nM=D\nM=M>>\n(END)\n@END\n0;JMP\n"), hack.Options{ISA: isa})
+	if err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+	c := New()
+	c.ISA = isa
+	if err := c.LoadWords(result.Words); err != nil {
+		t.Fatal(err)
+	}
+	c.RAM[0] = -3
+	if _, err := c.Run(100); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if c.D != -12 || c.RAM[1] != -6 {
+		t.Errorf("D = %d, RAM[1] = %d, want -12, -6", c.D, c.RAM[1])
+	}
+}
+
+// TestOptimizedVMPrograms checks that the peephole optimizer does not change what the VM translator output computes.
+func TestOptimizedVMPrograms(t *testing.T) {
+	files := []string{"BasicLoop", "BasicTest", "FibonacciSeries", "PointerTest", "SimpleAdd", "StackTest", "StaticTest"}
+	for _, name := range files {
+		src, err := os.ReadFile("../vm/vm_files/" + name + ".asm")
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		var computers [2]*Computer
+		for i, optimize := range []bool{false, true} {
+			result, err := hack.Assemble(bytes.NewReader(src), hack.Options{Optimize: optimize})
+			if err != nil {
+				t.Fatalf("Assemble(%s) failed: %v", name, err)
+			}
+			if optimize && result.Optimized.Saved() <= 0 {
+				t.Errorf("%s: %v, want some instructions saved", name, result.Optimized)
+			}
+			c := New()
+			if err := c.LoadWords(result.Words); err != nil {
+				t.Fatalf("LoadWords failed: %v", err)
+			}
+			// the segments of the VM: SP, LCL, ARG, THIS, THAT and the arguments
+			c.RAM[0], c.RAM[1], c.RAM[2], c.RAM[3], c.RAM[4] = 256, 300, 400, 3000, 3010
+			c.RAM[400], c.RAM[401] = 6, 3000
+			if _, err := c.Run(100000); err != nil {
+				t.Fatalf("Run(%s) failed: %v", name, err)
+			}
+			computers[i] = c
+		}
+		if computers[0].RAM != computers[1].RAM {
+			t.Errorf("%s: the optimized program computes a different RAM", name)
+		}
+		if computers[1].Cycles >= computers[0].Cycles {
+			t.Errorf("%s: the optimized program takes %d cycles, want less than %d", name, computers[1].Cycles, computers[0].Cycles)
+		}
+	}
+}
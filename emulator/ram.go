@@ -0,0 +1,52 @@
+package emulator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Memory is an interface that represents a RAM that is read and written by address. It is implemented by Computer and by the machine of the VM interpreter.
+type Memory interface {
+	Peek(addr int) (int16, error)
+	Poke(addr int, value int16) error
+}
+
+// ParseRAMAssignments sets the RAM values given as "addr=value,addr=value" in mem. An empty string sets nothing. Example: "0=2,1=3" sets RAM[0] to 2 and RAM[1] to 3
+func ParseRAMAssignments(mem Memory, s string) error {
+	if s == "" {
+		return nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("invalid RAM value %q", kv)
+		}
+		addr, err := strconv.Atoi(k)
+		if err != nil {
+			return fmt.Errorf("invalid RAM address %q", k)
+		}
+		value, err := strconv.ParseInt(v, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid RAM value %q", v)
+		}
+		if err := mem.Poke(addr, int16(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseRange parses a RAM range given as "start:end". start is included and end is not. An empty string is the empty range from 0 to 0. Example: "0:16" -> 0, 16
+func ParseRange(s string) (start, end int, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	k, v, ok := strings.Cut(s, ":")
+	start, err1 := strconv.Atoi(k)
+	end, err2 := strconv.Atoi(v)
+	if !ok || err1 != nil || err2 != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid RAM range %q", s)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,44 @@
+package emulator
+
+import (
+	"testing"
+)
+
+func TestParseRAMAssignments(t *testing.T) {
+	c := New()
+	if err := ParseRAMAssignments(c, "0=2,1=-3,24576=65"); err != nil {
+		t.Fatalf("ParseRAMAssignments failed: %v", err)
+	}
+	if c.RAM[0] != 2 || c.RAM[1] != -3 || c.RAM[KBD] != 65 {
+		t.Errorf("RAM[0], RAM[1], RAM[KBD] = %d, %d, %d, want 2, -3, 65", c.RAM[0], c.RAM[1], c.RAM[KBD])
+	}
+	if err := ParseRAMAssignments(c, ""); err != nil {
+		t.Errorf("ParseRAMAssignments(\"\") = %v, want nil", err)
+	}
+	for _, s := range []string{"0", "x=1", "0=40000", "0=1,", "30000=1"} {
+		if err := ParseRAMAssignments(New(), s); err == nil {
+			t.Errorf("ParseRAMAssignments(%q) returned no error", s)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		input      string
+		start, end int
+		hasError   bool
+	}{
+		{"0:16", 0, 16, false},
+		{"256:256", 256, 256, false},
+		{"", 0, 0, false},
+		{"16", 0, 0, true},
+		{"16:0", 0, 0, true},
+		{"a:b", 0, 0, true},
+	}
+	for _, test := range tests {
+		start, end, err := ParseRange(test.input)
+		if (err != nil) != test.hasError || start != test.start || end != test.end {
+			t.Errorf("ParseRange(%q) = %d, %d, %v, want %d, %d, error: %v", test.input, start, end, err, test.start, test.end, test.hasError)
+		}
+	}
+}
@@ -16,7 +16,7 @@ type CompilationEngine struct {
 	labelCount   int // for generating unique labels
 }
 
-func New(vmwriter io.Writer, r io.Reader, className string) *CompilationEngine {
+func New(vmwriter io.Writer, r io.Reader) *CompilationEngine {
 	return &CompilationEngine{
 		vmwriter:     vw.New(vmwriter),
 		t:            tk.New(r),
@@ -26,8 +26,8 @@ func New(vmwriter io.Writer, r io.Reader, className string) *CompilationEngine {
 	}
 }
 
-func NewWithFirstToken(vmwriter io.Writer, r io.Reader, className string) *CompilationEngine {
-	ce := New(vmwriter, r, className)
+func NewWithFirstToken(vmwriter io.Writer, r io.Reader) *CompilationEngine {
+	ce := New(vmwriter, r)
 	t, err := tk.NewWithFirstToken(r)
 	if err != nil {
 		panic(err)
@@ -36,8 +36,8 @@ func NewWithFirstToken(vmwriter io.Writer, r io.Reader, className string) *Compi
 	return ce
 }
 
-func NewWithVMWriter(vmwriter io.Writer, r io.Reader, className string) *CompilationEngine {
-	ce := NewWithFirstToken(vmwriter, r, className)
+func NewWithVMWriter(vmwriter io.Writer, r io.Reader) *CompilationEngine {
+	ce := NewWithFirstToken(vmwriter, r)
 	ce.vmwriter = vw.New(vmwriter)
 	return ce
 }
@@ -17,9 +17,8 @@ import (
 func TestNew(t *testing.T) {
 	input := strings.NewReader("class Test { }")
 	output := &bytes.Buffer{}
-	className := "Test"
 
-	engine := New(output, input, className)
+	engine := New(output, input)
 
 	if engine == nil {
 		t.Fatal("New() returned nil")
@@ -44,9 +43,8 @@ func TestNew(t *testing.T) {
 func TestNewWithFirstToken(t *testing.T) {
 	input := strings.NewReader("class Test { }")
 	output := &bytes.Buffer{}
-	className := "Test"
 
-	engine := NewWithFirstToken(output, input, className)
+	engine := NewWithFirstToken(output, input)
 
 	if engine == nil {
 		t.Fatal("NewWithFirstToken() returned nil")
@@ -78,7 +76,6 @@ func TestNewWithFirstToken(t *testing.T) {
 func TestNewWithFirstToken_EmptyInput(t *testing.T) {
 	input := strings.NewReader("")
 	output := &bytes.Buffer{}
-	className := "Test"
 
 	defer func() {
 		if r := recover(); r == nil {
@@ -86,7 +83,7 @@ func TestNewWithFirstToken_EmptyInput(t *testing.T) {
 		}
 	}()
 
-	_ = NewWithFirstToken(output, input, className)
+	_ = NewWithFirstToken(output, input)
 }
 
 // Mock reader that returns an error
@@ -99,7 +96,6 @@ func (e *errorReader) Read(p []byte) (n int, err error) {
 func TestNewWithFirstTokenReaderError(t *testing.T) {
 	input := &errorReader{}
 	output := &bytes.Buffer{}
-	className := "Test"
 
 	defer func() {
 		if r := recover(); r == nil {
@@ -107,15 +103,14 @@ func TestNewWithFirstTokenReaderError(t *testing.T) {
 		}
 	}()
 
-	_ = NewWithFirstToken(output, input, className)
+	_ = NewWithFirstToken(output, input)
 }
 
 func TestNewWithVMWriter(t *testing.T) {
 	input := strings.NewReader("class Test { }")
 	output := &bytes.Buffer{}
-	className := "Test"
 
-	engine := NewWithVMWriter(output, input, className)
+	engine := NewWithVMWriter(output, input)
 
 	if engine == nil {
 		t.Fatal("NewWithVMWriter() returned nil")
@@ -177,8 +172,7 @@ func TestCompilationEngineStructure(t *testing.T) {
 func TestLookup(t *testing.T) {
 	input := strings.NewReader("")
 	output := &bytes.Buffer{}
-	className := "Test"
-	engine := New(output, input, className)
+	engine := New(output, input)
 
 	// Setup symbol tables
 	classVar := st.Identifier{Name: "classVar", Kind: st.STATIC, T: "int", Index: 0}
@@ -36,7 +36,7 @@ call String.appendChar 2
 	}
 	for _, test := range tests {
 		vmFile := &bytes.Buffer{}
-		ce := NewWithVMWriter(vmFile, strings.NewReader(test.jackCode), "")
+		ce := NewWithVMWriter(vmFile, strings.NewReader(test.jackCode))
 		err := ce.CompileTerm(false)
 		if err != nil {
 			t.Errorf("CompileClass() error: %v", err)
@@ -78,7 +78,7 @@ push that 0
 		}}
 	for _, test := range tests {
 		vmFile := &bytes.Buffer{}
-		ce := NewWithVMWriter(vmFile, strings.NewReader(test.jackCode), "")
+		ce := NewWithVMWriter(vmFile, strings.NewReader(test.jackCode))
 		ce.classST = &st.SymbolTable{}
 		ce.subroutineST = &st.SymbolTable{}
 		ce.subroutineST.VariableMap = variables
@@ -141,7 +141,7 @@ not
 	}
 	for _, test := range tests {
 		vmFile := &bytes.Buffer{}
-		ce := NewWithVMWriter(vmFile, strings.NewReader(test.jackCode), "")
+		ce := NewWithVMWriter(vmFile, strings.NewReader(test.jackCode))
 		err := ce.CompileExpression(false)
 		if err != nil {
 			t.Errorf("CompileExpression() error: %v", err)
@@ -105,7 +105,7 @@ pop that 0`,
 
 	for _, test := range tests {
 		vmFile := &bytes.Buffer{}
-		ce := NewWithVMWriter(vmFile, strings.NewReader(test.jackCode), "")
+		ce := NewWithVMWriter(vmFile, strings.NewReader(test.jackCode))
 
 		// Define the variables in the symbol table
 		for _, id := range test.Variables {
@@ -164,7 +164,7 @@ label label1`,
 	}
 	for _, test := range tests {
 		vmFile := &bytes.Buffer{}
-		ce := NewWithVMWriter(vmFile, strings.NewReader(test.jackCode), "")
+		ce := NewWithVMWriter(vmFile, strings.NewReader(test.jackCode))
 
 		// Define the variables in the symbol table
 		for _, id := range Variables {
@@ -216,7 +216,7 @@ func TestCompileWhile(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{}
-			ce := NewWithVMWriter(vmFile, strings.NewReader(tt.jackCode), "TestClass")
+			ce := NewWithVMWriter(vmFile, strings.NewReader(tt.jackCode))
 
 			// Define the variables in the symbol table
 			ce.subroutineST.SetCurrentScope("TestClass.testFunc", st.KINDFUNCTION, st.VOIDFUNC)
@@ -283,7 +283,7 @@ func TestCompileDo(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{}
-			ce := NewWithVMWriter(vmFile, strings.NewReader(tt.jackCode), tt.className)
+			ce := NewWithVMWriter(vmFile, strings.NewReader(tt.jackCode))
 
 			// Set up context
 			ce.classST.SetCurrentScope(tt.className, st.KINDCLASS, st.NOTVOIDFUNC)
@@ -366,7 +366,7 @@ func TestCompileReturn(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{}
-			ce := NewWithVMWriter(vmFile, strings.NewReader(tt.jackCode), "TestClass")
+			ce := NewWithVMWriter(vmFile, strings.NewReader(tt.jackCode))
 
 			// Set up context
 			funcType := st.NOTVOIDFUNC
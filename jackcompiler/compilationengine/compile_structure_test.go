@@ -204,7 +204,7 @@ return
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{}
 			// Use NewWithVMWriter to capture VM output
-			ce := NewWithVMWriter(vmFile, strings.NewReader(tt.jackCode), tt.className)
+			ce := NewWithVMWriter(vmFile, strings.NewReader(tt.jackCode))
 			err := ce.CompileClass()
 			if err != nil {
 				t.Fatalf("CompileClass() error: %v", err)
@@ -285,7 +285,7 @@ func TestCompileClassVarDec(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{} // Not used for checking output here
 			// Need to use NewWithFirstToken because CompileClassVarDec expects the token to be ready
-			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode), "TestClass")
+			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode))
 
 			// Manually set the class scope for context
 			ce.classST.SetCurrentScope("TestClass", st.KINDCLASS, st.NOTVOIDFUNC)
@@ -366,7 +366,7 @@ return
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{}
-			ce := NewWithVMWriter(vmFile, strings.NewReader(tt.jackCode), tt.className)
+			ce := NewWithVMWriter(vmFile, strings.NewReader(tt.jackCode))
 
 			// Set up class context (needed for method/constructor this/alloc)
 			ce.classST.SetCurrentScope(tt.className, st.KINDCLASS, st.NOTVOIDFUNC)
@@ -444,7 +444,7 @@ func TestCompileVarDec(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{} // Not used
-			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode), "TestClass")
+			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode))
 
 			// Set up subroutine context
 			ce.subroutineST.SetCurrentScope("Test.testFunc", st.KINDFUNCTION, st.VOIDFUNC)
@@ -539,7 +539,7 @@ func TestCompileParameterList(t *testing.T) {
 			vmFile := &bytes.Buffer{} // Not used
 			// Need to wrap the code slightly for the tokenizer
 			reader := strings.NewReader(tt.jackCode + ")") // Add closing paren for context
-			ce := NewWithFirstToken(vmFile, reader, "TestClass")
+			ce := NewWithFirstToken(vmFile, reader)
 
 			// Set up subroutine context
 			kind := st.KINDFUNCTION
@@ -635,7 +635,7 @@ return
 			vmFile := &bytes.Buffer{}
 			// Need to wrap code slightly for tokenizer
 			reader := strings.NewReader(tt.jackCode)
-			ce := NewWithVMWriter(vmFile, reader, tt.className)
+			ce := NewWithVMWriter(vmFile, reader)
 
 			// Set up context
 			ce.classST.SetCurrentScope(tt.className, st.KINDCLASS, st.NOTVOIDFUNC)
@@ -31,7 +31,7 @@ func TestProcessKeyWord(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{}
-			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode), "Test")
+			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode))
 
 			err := ce.ProcessKeyWord(tt.expectedKW)
 
@@ -70,7 +70,7 @@ func TestProcessType(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{}
-			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode), "Test")
+			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode))
 
 			err := ce.ProcessType()
 
@@ -108,7 +108,7 @@ func TestProcessSymbol(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{}
-			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode), "Test")
+			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode))
 
 			err := ce.ProcessSymbol(tt.expectedSymbol)
 
@@ -144,7 +144,7 @@ func TestProcessIdentifier(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{}
-			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode), "Test")
+			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode))
 
 			err := ce.ProcessIdentifier()
 
@@ -180,7 +180,7 @@ func TestProcessStringConst(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{}
-			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode), "Test")
+			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode))
 
 			err := ce.ProcessStringConst()
 
@@ -216,7 +216,7 @@ func TestProcessIntConst(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			vmFile := &bytes.Buffer{}
-			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode), "Test")
+			ce := NewWithFirstToken(vmFile, strings.NewReader(tt.jackCode))
 
 			err := ce.ProcessIntConst()
 
@@ -1,15 +1,30 @@
 package jackanalyzer
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/Kaichi-Irie/nand2tetris-go/jackcompiler/compilationengine"
+	"github.com/Kaichi-Irie/nand2tetris-go/progress"
 )
 
+// Options is a struct that controls how Analize compiles Jack files.
+type Options struct {
+	Progress progress.Reporter // receives the progress events. The default prints the messages to stdout. progress.Discard prints nothing
+}
+
 func Analize(path string) error {
-	fmt.Println("jack analyzer")
+	return AnalizeWithOptions(path, Options{})
+}
+
+// AnalizeWithOptions compiles a .jack file or the .jack files of a directory to .vm files next to them. The compiled files and "done" are reported to opts.Progress.
+func AnalizeWithOptions(path string, opts Options) error {
+	r := progress.OrStdout(opts.Progress)
+	r.Report(progress.Event{Kind: progress.Started, Tool: progress.ToolJackAnalyzer, Message: "jack analyzer"})
 	info, err := os.Stat(path)
 	if err != nil {
 		return err
@@ -27,25 +42,61 @@ func Analize(path string) error {
 	} else {
 		return fmt.Errorf("input path must be a .jack file or a directory")
 	}
+	start := time.Now()
 	for _, jackFilePath := range jackFilePaths {
-		className := jackFilePath[:len(jackFilePath)-5]
-		jackFile, err := os.Open(jackFilePath)
-		if err != nil {
-			return err
-		}
-		defer jackFile.Close()
-		vmFile, err := os.Create(className + ".vm")
-		if err != nil {
-			return err
-		}
-
-		ce := compilationengine.NewWithVMWriter(vmFile, jackFile, className)
-		err = ce.CompileClass()
+		r.Report(progress.Event{Kind: progress.FileStarted, Tool: progress.ToolJackAnalyzer, File: jackFilePath})
+		fileStart := time.Now()
+		vmFilePath := jackFilePath[:len(jackFilePath)-5] + ".vm"
+		lines, err := compileFile(jackFilePath, vmFilePath)
 		if err != nil {
 			return err
 		}
-		fmt.Println("compiled", jackFilePath, "to", vmFile.Name())
+		r.Report(progress.Event{
+			Kind:    progress.FileFinished,
+			Tool:    progress.ToolJackAnalyzer,
+			File:    jackFilePath,
+			Output:  vmFilePath,
+			Count:   lines,
+			Elapsed: time.Since(fileStart),
+			Message: fmt.Sprintf("compiled %s to %s", jackFilePath, vmFilePath),
+		})
 	}
-	fmt.Println("done")
+	r.Report(progress.Event{Kind: progress.Finished, Tool: progress.ToolJackAnalyzer, Elapsed: time.Since(start), Message: "done"})
 	return nil
 }
+
+// compileFile compiles the Jack class of jackFilePath to vmFilePath and returns the number of lines of the VM code. Both files are closed before it returns, and an error in closing the VM file is returned.
+func compileFile(jackFilePath, vmFilePath string) (lines int, err error) {
+	jackFile, err := os.Open(jackFilePath)
+	if err != nil {
+		return 0, err
+	}
+	defer jackFile.Close()
+	vmFile, err := os.Create(vmFilePath)
+	if err != nil {
+		return 0, err
+	}
+	counter := &lineCounter{w: vmFile}
+	if err := Compile(counter, jackFile); err != nil {
+		vmFile.Close()
+		return 0, err
+	}
+	return counter.lines, vmFile.Close()
+}
+
+// Compile compiles a Jack class and writes the VM code to vmFile. It prints nothing.
+func Compile(vmFile io.Writer, jackFile io.Reader) error {
+	ce := compilationengine.NewWithVMWriter(vmFile, jackFile)
+	return ce.CompileClass()
+}
+
+// lineCounter is a writer that counts the lines written to w. Each line of VM code is a command.
+type lineCounter struct {
+	w     io.Writer
+	lines int
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	c.lines += bytes.Count(p, []byte("\n"))
+	return c.w.Write(p)
+}
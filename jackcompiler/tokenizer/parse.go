@@ -84,7 +84,6 @@ func ParseStringConst(s string) (Token, error) {
 		return Token{}, fmt.Errorf("cannot find closing quote")
 	}
 	s = s[0 : idx+2]
-	fmt.Println("s:", s)
 	// check if the string contains any quotes or newlines inside
 	if i := strings.IndexAny(s, "\n\r"); i != -1 {
 		return Token{}, fmt.Errorf("string constant contains quotes or newlines")
@@ -0,0 +1,117 @@
+/*
+This file defines the progress events of the tools: the assembler, the VM translator and the Jack analyzer. A tool reports an event to a Reporter at each step instead of printing it, so a program that uses the tools as a library can print the events, collect them or ignore them. The command line entry points use Stdout, which prints the same messages as before.
+*/
+
+// progress package provides the events that the tools of the toolchain report while they work.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Kind is the kind of an event.
+type Kind int
+
+const (
+	Started      Kind = iota // a tool started. Example: "VMTranslator"
+	FileStarted              // a tool started to read an input file
+	FileFinished             // a tool finished an input file. Count and Elapsed are set
+	Report                   // a summary such as the report of the optimizer
+	Warning                  // a warning that does not stop the tool
+	Finished                 // a tool finished all its inputs. Elapsed is set
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Started:
+		return "started"
+	case FileStarted:
+		return "file started"
+	case FileFinished:
+		return "file finished"
+	case Report:
+		return "report"
+	case Warning:
+		return "warning"
+	case Finished:
+		return "finished"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Tool names used in Event.Tool.
+const (
+	ToolAssembler    = "hack"
+	ToolVMTranslator = "vmtranslator"
+	ToolJackAnalyzer = "jackanalyzer"
+)
+
+// Event is a struct that represents a step of a tool. Example: {Kind: FileFinished, Tool: "vmtranslator", File: "Main.vm", Output: "Prog.asm", Count: 42, Elapsed: 1ms, Message: "Translated Main.vm to Prog.asm"}
+type Event struct {
+	Kind    Kind
+	Tool    string        // ToolAssembler, ToolVMTranslator or ToolJackAnalyzer
+	File    string        // the input file of FileStarted and FileFinished
+	Output  string        // the output file of FileFinished if it is known
+	Count   int           // the number of instructions written for FileFinished: Hack instructions for the assembler and VM commands for the VM translator and the Jack analyzer
+	Elapsed time.Duration // the time spent on the file for FileFinished, or on all the inputs for Finished
+	Message string        // the line the command line tool prints for the event. Empty if it prints nothing
+}
+
+// Reporter is the interface that receives the events of a tool. Report is called in the goroutine of the tool, in the order of the steps.
+type Reporter interface {
+	Report(e Event)
+}
+
+// Func is a function that implements Reporter. Example: progress.Func(func(e progress.Event) { events = append(events, e) })
+type Func func(e Event)
+
+// Report calls f(e).
+func (f Func) Report(e Event) {
+	f(e)
+}
+
+// Discard is a Reporter that ignores all events.
+var Discard Reporter = discard{}
+
+type discard struct{}
+
+func (discard) Report(Event) {}
+
+// Printer is a Reporter that prints the message of each event to W, one per line. Events without a message are not printed. A nil W means os.Stdout.
+type Printer struct {
+	W io.Writer
+}
+
+// Report prints the message of e.
+func (p Printer) Report(e Event) {
+	if e.Message == "" {
+		return
+	}
+	w := p.W
+	if w == nil {
+		w = os.Stdout
+	}
+	fmt.Fprintln(w, e.Message)
+}
+
+// Stdout is the Reporter that prints the messages to stdout. It is the default of the command line entry points such as hack.HackFromFile.
+var Stdout Reporter = Printer{}
+
+// OrStdout returns r, or Stdout if r is nil.
+func OrStdout(r Reporter) Reporter {
+	if r == nil {
+		return Stdout
+	}
+	return r
+}
+
+// OrDiscard returns r, or Discard if r is nil.
+func OrDiscard(r Reporter) Reporter {
+	if r == nil {
+		return Discard
+	}
+	return r
+}
@@ -0,0 +1,38 @@
+package progress
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrinter(t *testing.T) {
+	var out strings.Builder
+	p := Printer{W: &out}
+	for _, e := range []Event{
+		{Kind: Started, Tool: ToolAssembler, Message: "Hack"},
+		{Kind: FileStarted, Tool: ToolAssembler, File: "Prog.asm"},
+		{Kind: FileFinished, Tool: ToolAssembler, File: "Prog.asm", Count: 4},
+		{Kind: Finished, Tool: ToolAssembler, Message: "done"},
+	} {
+		p.Report(e)
+	}
+	if want := "Hack\ndone\n"; out.String() != want {
+		t.Errorf("Printer printed %q, want %q", out.String(), want)
+	}
+}
+
+func TestOrStdout(t *testing.T) {
+	if OrStdout(nil) != Stdout {
+		t.Errorf("OrStdout(nil) is not Stdout")
+	}
+	if OrDiscard(nil) != Discard {
+		t.Errorf("OrDiscard(nil) is not Discard")
+	}
+	var got []Kind
+	r := Func(func(e Event) { got = append(got, e.Kind) })
+	OrStdout(r).Report(Event{Kind: Warning})
+	OrDiscard(r).Report(Event{Kind: Report})
+	if len(got) != 2 || got[0] != Warning || got[1] != Report {
+		t.Errorf("the given reporter received %v, want [warning report]", got)
+	}
+}
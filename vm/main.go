@@ -1,14 +1,27 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"os"
 
 	"github.com/Kaichi-Irie/nand2tetris-go/vm/vmtranslator"
 )
 
+// usage: go run main.go [-O[=level]] <input.vm|directory>
 func main() {
-	err := vmtranslator.VMTranslator(os.Args[1])
+	var level vmtranslator.Level
+	flag.Var(&level, "O", "the optimization level: -O (or -O=1) removes redundant instructions with the peephole optimizer, and -O=2 also optimizes the VM code")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: vm [-O[=level]] <input.vm|directory>")
+		os.Exit(2)
+	}
+	var opts vmtranslator.Options
+	level.Apply(&opts)
+	err := vmtranslator.VMTranslatorWithOptions(flag.Arg(0), opts)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
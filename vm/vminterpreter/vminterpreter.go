@@ -0,0 +1,556 @@
+/*
+This file implements an interpreter that runs VM code directly, without translating it to Hack assembly code. The VM files are compiled once into a compact list of instructions whose labels and function names are resolved to indexes, and the instructions are executed on a RAM with the memory map of the Hack platform: the segment pointers SP, LCL, ARG, THIS and THAT in RAM[0..4], temp in RAM[5..12], static variables from RAM[16], the stack from RAM[256], and the screen and the keyboard at the same addresses as the CPU emulator. gt and lt compare their operands as signed 16-bit numbers. The translated code compares the difference of the operands with 0 instead, so it gives the opposite result when the difference overflows; Options.TranslatorComparisons copies that behaviour. With it, a program leaves the same values in RAM as its translated code, except for the return addresses in the call frames, which are instruction indexes instead of ROM addresses.
+*/
+
+// vminterpreter package runs VM programs directly with the semantics of the VM translator.
+package vminterpreter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/emulator"
+	"github.com/Kaichi-Irie/nand2tetris-go/vm/vmtranslator"
+)
+
+// addresses of the Hack platform used by the VM
+const (
+	SP         = 0   // the stack pointer
+	LCL        = 1   // the base address of the local segment
+	ARG        = 2   // the base address of the argument segment
+	THIS       = 3   // the base address of the this segment. pointer 0
+	THAT       = 4   // the base address of the that segment. pointer 1
+	TempBase   = 5   // the address of temp 0. The temp segment is RAM[5..12]
+	StaticBase = 16  // the address of the first static variable
+	StaticLast = 255 // the address of the last static variable
+	StackBase  = 256 // the address of the stack set by the bootstrap code
+)
+
+// ErrHalted is returned by Step when the program has stopped: it has reached an infinite loop such as "label END" "goto END", the end of the code of a program without the bootstrap code, or the return of Sys.init.
+var ErrHalted = errors.New("program halted")
+
+// Options is a struct that controls how Load prepares a VM program.
+type Options struct {
+	Bootstrap             bool // if true, SP is set to 256 and Sys.init is called first as the bootstrap code of the VM translator does. Otherwise the program starts at the first command of the first file
+	TranslatorComparisons bool // if true, gt and lt compare the 16-bit difference x-y with 0 like the translated code, so they give the opposite result when x-y overflows. Example: gt of 32767 and -1 is false. Otherwise they compare x and y as signed numbers
+}
+
+// opcode is the operation of an instruction.
+type opcode uint8
+
+const (
+	opPushConstant opcode = iota // push a
+	opPushSegment                // push RAM[RAM[a]+b] for local, argument, this and that
+	opPushFixed                  // push RAM[a] for static, temp and pointer
+	opPopSegment                 // RAM[RAM[a]+b] = pop
+	opPopFixed                   // RAM[a] = pop
+	opAdd
+	opSub
+	opNeg
+	opEq
+	opGt
+	opLt
+	opAnd
+	opOr
+	opNot
+	opGoto     // goto a
+	opIfGoto   // goto a if pop != 0
+	opFunction // push 0 b times
+	opCall     // call the function at a with b arguments
+	opReturn
+	opHalt // the end of the program
+)
+
+// instruction is a struct that represents a compiled VM command. The meaning of a and b depends on op.
+type instruction struct {
+	op   opcode
+	a, b int
+}
+
+// position is a struct that represents the source of an instruction used in errors. Example: {"Main.vm", 12, "Main.main"}
+type position struct {
+	file     string
+	line     int
+	function string
+}
+
+func (p position) String() string {
+	if p.function == "" {
+		return fmt.Sprintf("%s:%d", p.file, p.line)
+	}
+	return fmt.Sprintf("%s:%d (%s)", p.file, p.line, p.function)
+}
+
+// Machine is a struct that represents a VM program and the state of its execution: the RAM of the Hack platform and the index of the next instruction.
+type Machine struct {
+	RAM   [emulator.RAMSize]int16
+	Steps int // the number of executed VM commands. function commands count as one command
+
+	code      []instruction
+	positions []position
+	pc        int
+
+	translatorComparisons bool
+}
+
+// Load compiles the VM files in order and returns a Machine ready to run them. Invalid commands are returned as [vmtranslator.ParseErrors], and undefined labels and functions as errors with their file and line.
+func Load(sources []vmtranslator.Source, opts Options) (*Machine, error) {
+	l := &loader{functions: map[string]int{}, statics: map[string]int{}}
+	if opts.Bootstrap {
+		// the bootstrap code is "call Sys.init 0" and the end of the program, where Sys.init returns to
+		l.emit(instruction{op: opCall}, position{file: "bootstrap"})
+		l.calls = append(l.calls, pendingRef{index: 0, name: "Sys.init", pos: position{file: "bootstrap"}})
+		l.emit(instruction{op: opHalt}, position{file: "bootstrap"})
+	}
+	for _, source := range sources {
+		if err := l.load(source); err != nil {
+			return nil, err
+		}
+	}
+	l.emit(instruction{op: opHalt}, position{file: "end"})
+	if err := l.resolve(); err != nil {
+		return nil, err
+	}
+	// return addresses are stored in RAM as 16-bit words
+	if len(l.code) > 1<<16 {
+		return nil, fmt.Errorf("program of %d VM commands is too large", len(l.code))
+	}
+
+	m := &Machine{code: l.code, positions: l.positions, translatorComparisons: opts.TranslatorComparisons}
+	if opts.Bootstrap {
+		m.RAM[SP] = StackBase
+	}
+	return m, nil
+}
+
+// LoadPath loads a .vm file or the .vm files of a directory in sorted order. A directory is loaded with the bootstrap code and must have a Sys.vm as VMTranslator requires.
+func LoadPath(path string) (*Machine, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	switch {
+	case info.IsDir():
+		if paths, err = filepath.Glob(filepath.Join(path, "*.vm")); err != nil {
+			return nil, err
+		}
+		slices.Sort(paths)
+		if !slices.Contains(paths, filepath.Join(path, "Sys.vm")) {
+			return nil, fmt.Errorf("Sys.vm must be included in the given directory")
+		}
+	case filepath.Ext(path) == ".vm":
+		paths = []string{path}
+	default:
+		return nil, fmt.Errorf("input file must be a .vm file or a directory")
+	}
+
+	var sources []vmtranslator.Source
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		base := filepath.Base(p)
+		sources = append(sources, vmtranslator.Source{Name: strings.TrimSuffix(base, ".vm"), File: f, Path: p})
+	}
+	return Load(sources, Options{Bootstrap: info.IsDir()})
+}
+
+// pendingRef is a struct that represents a goto or a call whose target is resolved after all files are loaded.
+type pendingRef struct {
+	index int    // the index of the instruction
+	name  string // the full label name or the function name. Example: "Main.main$LOOP", "Math.multiply"
+	pos   position
+}
+
+// loader is a struct that compiles VM files into instructions.
+type loader struct {
+	code      []instruction
+	positions []position
+	labels    map[string]int // the index of each label of the current file. Example: "Main.main$LOOP" -> 42
+	functions map[string]int // the index of each function. Example: "Main.main" -> 40
+	statics   map[string]int // the address of each static variable. Example: "Main.0" -> 16
+	gotos     []pendingRef
+	calls     []pendingRef
+}
+
+func (l *loader) emit(inst instruction, pos position) {
+	l.code = append(l.code, inst)
+	l.positions = append(l.positions, pos)
+}
+
+// load compiles a VM file. Labels are local to the function they are defined in, as the VM translator resolves them. Invalid commands are returned as [vmtranslator.ParseErrors].
+func (l *loader) load(source vmtranslator.Source) error {
+	file := source.Path
+	if file == "" {
+		file = source.Name + ".vm"
+	}
+	commands, err := vmtranslator.Parse(source.File, file)
+	if err != nil {
+		return err
+	}
+	l.labels = map[string]int{}
+	l.gotos = l.gotos[:0]
+	function := ""
+	for _, c := range commands {
+		if c.Type == vmtranslator.C_FUNCTION {
+			function = c.Arg1
+		}
+		pos := position{file: file, line: c.Line, function: function}
+		inst, err := l.compile(c, source.Name, function, pos)
+		if err != nil {
+			return fmt.Errorf("%s: %w", pos, err)
+		}
+		if inst != nil {
+			l.emit(*inst, pos)
+		}
+	}
+	// labels are resolved per file because they are local to a function
+	for _, ref := range l.gotos {
+		target, ok := l.labels[ref.name]
+		if !ok {
+			return fmt.Errorf("%s: undefined label %s", ref.pos, ref.name)
+		}
+		l.code[ref.index].a = target
+	}
+	return nil
+}
+
+// arithmetic is the opcode of each arithmetic and logical command.
+var arithmetic = map[string]opcode{"add": opAdd, "sub": opSub, "neg": opNeg, "eq": opEq, "gt": opGt, "lt": opLt, "and": opAnd, "or": opOr, "not": opNot}
+
+// compile compiles a valid VM command. It returns nil for a label, which has no instruction. function is the name of the current function.
+func (l *loader) compile(c vmtranslator.Command, stem, function string, pos position) (*instruction, error) {
+	label := c.Arg1
+	if function != "" {
+		label = function + "$" + c.Arg1
+	}
+	switch c.Type {
+	case vmtranslator.C_ARITHMETIC:
+		return &instruction{op: arithmetic[c.Arg1]}, nil
+	case vmtranslator.C_PUSH, vmtranslator.C_POP:
+		return l.compileSegment(c.Type == vmtranslator.C_PUSH, c.Arg1, c.Arg2, stem)
+	case vmtranslator.C_LABEL:
+		if _, ok := l.labels[label]; ok {
+			return nil, fmt.Errorf("label %s is already defined", c.Arg1)
+		}
+		l.labels[label] = len(l.code)
+		return nil, nil
+	case vmtranslator.C_GOTO, vmtranslator.C_IF:
+		l.gotos = append(l.gotos, pendingRef{index: len(l.code), name: label, pos: pos})
+		if c.Type == vmtranslator.C_GOTO {
+			return &instruction{op: opGoto}, nil
+		}
+		return &instruction{op: opIfGoto}, nil
+	case vmtranslator.C_FUNCTION:
+		if _, ok := l.functions[c.Arg1]; ok {
+			return nil, fmt.Errorf("function %s is already defined", c.Arg1)
+		}
+		l.functions[c.Arg1] = len(l.code)
+		return &instruction{op: opFunction, b: c.Arg2}, nil
+	case vmtranslator.C_CALL:
+		l.calls = append(l.calls, pendingRef{index: len(l.code), name: c.Arg1, pos: pos})
+		return &instruction{op: opCall, b: c.Arg2}, nil
+	}
+	return &instruction{op: opReturn}, nil
+}
+
+// compileSegment compiles "push segment i" or "pop segment i" whose segment and index are valid. The addresses of temp, pointer and static are fixed when the program is loaded. It returns an error if the static variables do not fit in RAM[16..255].
+func (l *loader) compileSegment(push bool, segment string, i int, stem string) (*instruction, error) {
+	var addr int
+	switch segment {
+	case "constant":
+		return &instruction{op: opPushConstant, a: i}, nil
+	case "local", "argument", "this", "that":
+		base := map[string]int{"local": LCL, "argument": ARG, "this": THIS, "that": THAT}[segment]
+		if push {
+			return &instruction{op: opPushSegment, a: base, b: i}, nil
+		}
+		return &instruction{op: opPopSegment, a: base, b: i}, nil
+	case "temp":
+		addr = TempBase + i
+	case "pointer":
+		addr = THIS + i
+	case "static":
+		// static variables get addresses in the order of their first use, as the assembler allocates the variables of the translated code
+		name := fmt.Sprintf("%s.%d", stem, i)
+		var ok bool
+		if addr, ok = l.statics[name]; !ok {
+			addr = StaticBase + len(l.statics)
+			if addr > StaticLast {
+				return nil, fmt.Errorf("static variable %s is at RAM[%d], beyond the static segment RAM[%d..%d]", name, addr, StaticBase, StaticLast)
+			}
+			l.statics[name] = addr
+		}
+	}
+	if push {
+		return &instruction{op: opPushFixed, a: addr}, nil
+	}
+	return &instruction{op: opPopFixed, a: addr}, nil
+}
+
+// resolve sets the targets of the calls after all functions are defined.
+func (l *loader) resolve() error {
+	for _, ref := range l.calls {
+		target, ok := l.functions[ref.name]
+		if !ok {
+			if ref.name == "Sys.init" && ref.pos.file == "bootstrap" {
+				return fmt.Errorf("the bootstrap code calls Sys.init, but it is not defined")
+			}
+			return fmt.Errorf("%s: undefined function %s", ref.pos, ref.name)
+		}
+		l.code[ref.index].a = target
+	}
+	return nil
+}
+
+// Peek returns the value of RAM[addr]. It returns an error if addr is out of the data memory.
+func (m *Machine) Peek(addr int) (int16, error) {
+	if addr < 0 || addr >= emulator.RAMSize {
+		return 0, fmt.Errorf("address %d is out of RAM", addr)
+	}
+	return m.RAM[addr], nil
+}
+
+// Poke sets RAM[addr] to value. It returns an error if addr is out of the data memory.
+func (m *Machine) Poke(addr int, value int16) error {
+	if addr < 0 || addr >= emulator.RAMSize {
+		return fmt.Errorf("address %d is out of RAM", addr)
+	}
+	m.RAM[addr] = value
+	return nil
+}
+
+// SetKey sets the keyboard memory map to the given key code. 0 means no key is pressed.
+func (m *Machine) SetKey(key int16) {
+	m.RAM[emulator.KBD] = key
+}
+
+// Screen returns the screen memory map. The returned slice shares memory with RAM.
+func (m *Machine) Screen() []int16 {
+	return m.RAM[emulator.ScreenBase : emulator.ScreenBase+emulator.ScreenSize]
+}
+
+// Halted returns true if the program has stopped: the next instruction is the end of the program or a goto to itself. Example: label END goto END
+func (m *Machine) Halted() bool {
+	inst := m.code[m.pc]
+	return inst.op == opHalt || inst.op == opGoto && inst.a == m.pc
+}
+
+// Position returns the file, the line and the function of the next command. Example: "Main.vm", 12, "Main.main"
+func (m *Machine) Position() (string, int, string) {
+	p := m.positions[m.pc]
+	return p.file, p.line, p.function
+}
+
+// Step executes the next VM command. It returns [ErrHalted] without executing anything if the program has stopped.
+func (m *Machine) Step() error {
+	if m.Halted() {
+		return ErrHalted
+	}
+	if err := m.execute(m.code[m.pc]); err != nil {
+		return fmt.Errorf("%s: %w", m.positions[m.pc], err)
+	}
+	m.Steps++
+	return nil
+}
+
+// Run executes VM commands until the program halts or maxSteps commands have been executed. If maxSteps is 0 or negative, Run executes until the program halts. It returns the number of executed commands. Halting is not an error.
+func (m *Machine) Run(maxSteps int) (int, error) {
+	executed := 0
+	for maxSteps <= 0 || executed < maxSteps {
+		err := m.Step()
+		if errors.Is(err, ErrHalted) {
+			return executed, nil
+		}
+		if err != nil {
+			return executed, err
+		}
+		executed++
+	}
+	return executed, nil
+}
+
+// address returns RAM[base]+offset as an address. It returns an error if the address is out of the data memory.
+func (m *Machine) address(base, offset int) (int, error) {
+	addr := int(uint16(m.RAM[base])) + offset
+	if addr >= emulator.RAMSize {
+		return 0, fmt.Errorf("address %d is out of RAM", addr)
+	}
+	return addr, nil
+}
+
+// push pushes value to the stack.
+func (m *Machine) push(value int16) error {
+	sp := int(uint16(m.RAM[SP]))
+	if sp >= emulator.RAMSize {
+		return fmt.Errorf("stack overflow: SP is %d", sp)
+	}
+	m.RAM[sp] = value
+	m.RAM[SP]++
+	return nil
+}
+
+// pop pops a value from the stack.
+func (m *Machine) pop() (int16, error) {
+	sp := int(uint16(m.RAM[SP])) - 1
+	if sp < 0 || sp >= emulator.RAMSize {
+		return 0, fmt.Errorf("stack underflow: SP is %d", sp+1)
+	}
+	m.RAM[SP]--
+	return m.RAM[sp], nil
+}
+
+// write writes value to RAM[addr]. Writes to the keyboard memory map are ignored as in the Hack platform.
+func (m *Machine) write(addr int, value int16) {
+	if addr != emulator.KBD {
+		m.RAM[addr] = value
+	}
+}
+
+// execute executes an instruction and moves to the next one.
+func (m *Machine) execute(inst instruction) error {
+	next := m.pc + 1
+	switch inst.op {
+	case opPushConstant:
+		if err := m.push(int16(inst.a)); err != nil {
+			return err
+		}
+	case opPushSegment:
+		addr, err := m.address(inst.a, inst.b)
+		if err != nil {
+			return err
+		}
+		if err := m.push(m.RAM[addr]); err != nil {
+			return err
+		}
+	case opPushFixed:
+		if err := m.push(m.RAM[inst.a]); err != nil {
+			return err
+		}
+	case opPopSegment:
+		addr, err := m.address(inst.a, inst.b)
+		if err != nil {
+			return err
+		}
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		m.write(addr, v)
+	case opPopFixed:
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		m.RAM[inst.a] = v
+	case opNeg, opNot:
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		if inst.op == opNeg {
+			v = -v
+		} else {
+			v = ^v
+		}
+		m.push(v)
+	case opAdd, opSub, opEq, opGt, opLt, opAnd, opOr:
+		y, err := m.pop()
+		if err != nil {
+			return err
+		}
+		x, err := m.pop()
+		if err != nil {
+			return err
+		}
+		if m.translatorComparisons && (inst.op == opGt || inst.op == opLt) {
+			// the translated code compares x-y with 0
+			x, y = x-y, 0
+		}
+		m.push(binary(inst.op, x, y))
+	case opGoto:
+		next = inst.a
+	case opIfGoto:
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		if v != 0 {
+			next = inst.a
+		}
+	case opFunction:
+		for range inst.b {
+			if err := m.push(0); err != nil {
+				return err
+			}
+		}
+	case opCall:
+		// push the return address, LCL, ARG, THIS and THAT, then ARG=SP-5-nArgs and LCL=SP
+		for _, v := range []int16{int16(uint16(next)), m.RAM[LCL], m.RAM[ARG], m.RAM[THIS], m.RAM[THAT]} {
+			if err := m.push(v); err != nil {
+				return err
+			}
+		}
+		m.RAM[ARG] = m.RAM[SP] - 5 - int16(inst.b)
+		m.RAM[LCL] = m.RAM[SP]
+		next = inst.a
+	case opReturn:
+		frame := int(uint16(m.RAM[LCL]))
+		if frame < 5 || frame > emulator.RAMSize {
+			return fmt.Errorf("invalid frame: LCL is %d", frame)
+		}
+		ret := int(uint16(m.RAM[frame-5]))
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		arg, err := m.address(ARG, 0)
+		if err != nil {
+			return err
+		}
+		m.RAM[arg] = v
+		m.RAM[SP] = int16(arg + 1)
+		m.RAM[THAT] = m.RAM[frame-1]
+		m.RAM[THIS] = m.RAM[frame-2]
+		m.RAM[ARG] = m.RAM[frame-3]
+		m.RAM[LCL] = m.RAM[frame-4]
+		if ret >= len(m.code) {
+			return fmt.Errorf("invalid return address %d", ret)
+		}
+		next = ret
+	}
+	m.pc = next
+	return nil
+}
+
+// binary returns the result of a binary arithmetic or logical command. true is -1 and false is 0. gt and lt compare x and y as signed numbers. Example: gt of 32767 and -1 is true
+func binary(op opcode, x, y int16) int16 {
+	boolean := func(b bool) int16 {
+		if b {
+			return -1
+		}
+		return 0
+	}
+	switch op {
+	case opAdd:
+		return x + y
+	case opSub:
+		return x - y
+	case opEq:
+		return boolean(x == y)
+	case opGt:
+		return boolean(x > y)
+	case opLt:
+		return boolean(x < y)
+	case opAnd:
+		return x & y
+	}
+	return x | y
+}
@@ -0,0 +1,321 @@
+package vminterpreter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/assembler/hack"
+	"github.com/Kaichi-Irie/nand2tetris-go/emulator"
+	"github.com/Kaichi-Irie/nand2tetris-go/vm/vmtranslator"
+)
+
+// setup is the RAM set by the test scripts of nand2tetris before a single VM file runs.
+var setup = map[int]int16{SP: 256, LCL: 300, ARG: 400, THIS: 3000, THAT: 3010}
+
+// TestInterpreterMatchesEmulator tests that the interpreter leaves the same RAM as the translated code running on the CPU emulator, except for the scratch registers.
+func TestInterpreterMatchesEmulator(t *testing.T) {
+	files := []string{"SimpleAdd", "StackTest", "BasicTest", "PointerTest", "StaticTest", "BasicLoop", "FibonacciSeries", "Overflow"}
+	// Overflow compares numbers whose difference overflows 16 bits
+	overflow := "push constant 32767\npush constant 1\nneg\ngt\npop temp 0\npush constant 32767\nneg\npush constant 2\nlt\npop temp 1\npush constant 32767\npush constant 1\nneg\nlt\npop temp 2\n"
+	for _, name := range files {
+		t.Run(name, func(t *testing.T) {
+			vmCode := []byte(overflow)
+			if name != "Overflow" {
+				var err error
+				if vmCode, err = os.ReadFile(filepath.Join("../vm_files", name+".vm")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			m, err := Load([]vmtranslator.Source{{Name: name, File: bytes.NewReader(vmCode)}}, Options{TranslatorComparisons: true})
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			c := translateAndLoad(t, name, vmCode)
+			for addr, v := range setup {
+				m.RAM[addr], c.RAM[addr] = v, v
+			}
+			// FibonacciSeries computes 6 numbers into RAM[3000..]
+			m.RAM[400], m.RAM[401] = 6, 3000
+			c.RAM[400], c.RAM[401] = 6, 3000
+
+			if _, err := m.Run(100000); err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if !m.Halted() {
+				t.Fatalf("interpreter did not halt")
+			}
+			if _, err := c.Run(1000000); err != nil {
+				t.Fatalf("emulator failed: %v", err)
+			}
+			for addr := range 4096 {
+				// R13..R15 are the scratch registers of the translated code
+				if addr >= 13 && addr <= 15 {
+					continue
+				}
+				if m.RAM[addr] != c.RAM[addr] {
+					t.Errorf("RAM[%d] is %d, want %d", addr, m.RAM[addr], c.RAM[addr])
+				}
+			}
+		})
+	}
+}
+
+// translateAndLoad translates and assembles a VM file and loads it into a new Computer.
+func translateAndLoad(t *testing.T, name string, vmCode []byte) *emulator.Computer {
+	t.Helper()
+	var asm bytes.Buffer
+	if _, err := vmtranslator.TranslateSources(&asm, []vmtranslator.Source{{Name: name, File: bytes.NewReader(vmCode)}}, vmtranslator.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := hack.Assemble(&asm, hack.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := emulator.New()
+	if err := c.LoadWords(result.Words); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// TestInterpreterDirs tests programs with the bootstrap code against the expected RAM of the test scripts of nand2tetris.
+func TestInterpreterDirs(t *testing.T) {
+	tests := []struct {
+		dir      string
+		expected map[int]int16
+	}{
+		{"FibonacciElement", map[int]int16{0: 262, 261: 3}},
+		{"StaticsTest", map[int]int16{0: 263, 261: -2, 262: 8}},
+		{"NestedCall", map[int]int16{0: 261, 1: 261, 2: 256, 3: 4000, 4: 5000, 5: 135, 6: 246}},
+	}
+	for _, test := range tests {
+		t.Run(test.dir, func(t *testing.T) {
+			m, err := LoadPath(filepath.Join("../vm_files", test.dir))
+			if err != nil {
+				t.Fatalf("LoadPath failed: %v", err)
+			}
+			if _, err := m.Run(100000); err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if !m.Halted() {
+				t.Fatalf("program did not halt")
+			}
+			for addr, v := range test.expected {
+				if m.RAM[addr] != v {
+					t.Errorf("RAM[%d] is %d, want %d", addr, m.RAM[addr], v)
+				}
+			}
+		})
+	}
+}
+
+// TestOptimizedProgramsMatch tests that the VM optimizer does not change the RAM that the programs leave, except for the stack and the scratch registers.
+func TestOptimizedProgramsMatch(t *testing.T) {
+	tests := []struct {
+		path      string
+		bootstrap bool
+	}{
+		{"SimpleAdd.vm", false}, {"StackTest.vm", false}, {"BasicTest.vm", false}, {"PointerTest.vm", false}, {"StaticTest.vm", false}, {"BasicLoop.vm", false}, {"FibonacciSeries.vm", false},
+		{"FibonacciElement", true}, {"StaticsTest", true}, {"NestedCall", true},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			files := []string{filepath.Join("../vm_files", test.path)}
+			if test.bootstrap {
+				files, _ = filepath.Glob(filepath.Join("../vm_files", test.path, "*.vm"))
+			}
+			run := func(optimize bool) *Machine {
+				var sources []vmtranslator.Source
+				for _, file := range files {
+					code := readCommands(t, file, optimize)
+					sources = append(sources, vmtranslator.Source{Name: strings.TrimSuffix(filepath.Base(file), ".vm"), File: strings.NewReader(code)})
+				}
+				m, err := Load(sources, Options{Bootstrap: test.bootstrap})
+				if err != nil {
+					t.Fatalf("Load failed: %v", err)
+				}
+				if !test.bootstrap {
+					for addr, v := range setup {
+						m.RAM[addr] = v
+					}
+					m.RAM[400], m.RAM[401] = 6, 3000
+				}
+				if _, err := m.Run(100000); err != nil || !m.Halted() {
+					t.Fatalf("Run failed or did not halt: %v", err)
+				}
+				return m
+			}
+			m, optimized := run(false), run(true)
+			for addr := range 4096 {
+				if addr >= 13 && addr <= 15 || addr >= int(m.RAM[SP]) && addr < 2048 {
+					continue
+				}
+				if m.RAM[addr] != optimized.RAM[addr] {
+					t.Errorf("RAM[%d] is %d, want %d", addr, optimized.RAM[addr], m.RAM[addr])
+				}
+			}
+		})
+	}
+}
+
+// readCommands reads a VM file and returns its commands, optimized by the VM optimizer if optimize is true.
+func readCommands(t *testing.T, file string, optimize bool) string {
+	t.Helper()
+	vmFile, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vmFile.Close()
+	commands, err := vmtranslator.Parse(vmFile, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if optimize {
+		commands = vmtranslator.OptimizeCommands(commands)
+	}
+	var lines []string
+	for _, c := range commands {
+		lines = append(lines, string(c.Text))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{"push constant 1\nmul\npush temp 8\n", "Main.vm:2: unknown command \"mul\" (mul)\nMain.vm:3: temp index 8 is out of range 0..7 (push temp 8)"},
+		{"function Main.f 0\ngoto END\n", "Main.vm:2 (Main.f): undefined label Main.f$END"},
+		{"function Main.f 0\nlabel L\nlabel L\n", "Main.vm:3 (Main.f): label L is already defined"},
+		{"call Math.multiply 2\n", "Main.vm:1: undefined function Math.multiply"},
+		{manyStatics(241), "Main.vm:241: static variable Main.240 is at RAM[256], beyond the static segment RAM[16..255]"},
+	}
+	for _, test := range tests {
+		_, err := Load([]vmtranslator.Source{{Name: "Main", File: strings.NewReader(test.code)}}, Options{})
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Load(%q) returned %v, want %s", test.code, err, test.expected)
+		}
+	}
+	// invalid commands are the errors of the VM parser
+	_, err := Load([]vmtranslator.Source{{Name: "Main", File: strings.NewReader("pop pointer 2\n")}}, Options{})
+	var parseErr *vmtranslator.ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 1 {
+		t.Errorf("Load returned %v, want a ParseError", err)
+	}
+	if _, err := Load([]vmtranslator.Source{{Name: "Main", File: strings.NewReader("function Main.main 0\n")}}, Options{Bootstrap: true}); err == nil {
+		t.Errorf("Load with the bootstrap code and no Sys.init returned no error")
+	}
+}
+
+// manyStatics returns VM code that pushes static 0..n-1.
+func manyStatics(n int) string {
+	var b strings.Builder
+	for i := range n {
+		fmt.Fprintf(&b, "push static %d\n", i)
+	}
+	return b.String()
+}
+
+// TestComparisons tests that gt and lt compare signed numbers, and compare their difference with 0 with Options.TranslatorComparisons.
+func TestComparisons(t *testing.T) {
+	code := "push constant 32767\npush constant 1\nneg\ngt\npop temp 0\npush constant 32767\nneg\npush constant 2\nlt\npop temp 1\npush constant 2\npush constant 1\ngt\npop temp 2\n"
+	tests := []struct {
+		opts     Options
+		expected [3]int16
+	}{
+		{Options{}, [3]int16{-1, -1, -1}},
+		{Options{TranslatorComparisons: true}, [3]int16{0, 0, -1}},
+	}
+	for _, test := range tests {
+		m, err := Load([]vmtranslator.Source{{Name: "Main", File: strings.NewReader(code)}}, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.RAM[SP] = 256
+		if _, err := m.Run(100); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		if got := [3]int16(m.RAM[TempBase : TempBase+3]); got != test.expected {
+			t.Errorf("with %+v, temp 0..2 is %v, want %v", test.opts, got, test.expected)
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	m, err := Load([]vmtranslator.Source{{Name: "Main", File: strings.NewReader("function Main.main 0\nadd\n")}}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Run(0)
+	if want := "Main.vm:2 (Main.main): stack underflow: SP is 0"; err == nil || err.Error() != want {
+		t.Errorf("Run returned %v, want %s", err, want)
+	}
+	if file, line, function := m.Position(); file != "Main.vm" || line != 2 || function != "Main.main" {
+		t.Errorf("Position() = %s, %d, %s, want Main.vm, 2, Main.main", file, line, function)
+	}
+}
+
+func TestMemoryMap(t *testing.T) {
+	// the keyboard is read only and the screen is a part of RAM
+	code := "push constant 16384\npop pointer 1\npush constant 1\npop that 0\npush constant 24576\npop pointer 1\npush that 0\npop temp 0\npush constant 7\npop that 0\n"
+	m, err := Load([]vmtranslator.Source{{Name: "Main", File: strings.NewReader(code)}}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.RAM[SP] = 256
+	m.SetKey(65)
+	if _, err := m.Run(0); err != nil {
+		t.Fatal(err)
+	}
+	if m.Screen()[0] != 1 {
+		t.Errorf("SCREEN[0] is %d, want 1", m.Screen()[0])
+	}
+	if m.RAM[TempBase] != 65 || m.RAM[emulator.KBD] != 65 {
+		t.Errorf("temp 0 is %d and KBD is %d, want 65 and 65", m.RAM[TempBase], m.RAM[emulator.KBD])
+	}
+}
+
+// BenchmarkFibonacci compares the interpreter with the translated code on the CPU emulator.
+func BenchmarkFibonacci(b *testing.B) {
+	sys := "function Sys.init 0\npush constant 18\ncall Main.fibonacci 1\npop temp 0\nlabel END\ngoto END\n"
+	main := "function Main.fibonacci 0\npush argument 0\npush constant 2\nlt\nif-goto BASE\npush argument 0\npush constant 2\nsub\ncall Main.fibonacci 1\npush argument 0\npush constant 1\nsub\ncall Main.fibonacci 1\nadd\nreturn\nlabel BASE\npush argument 0\nreturn\n"
+	sources := func() []vmtranslator.Source {
+		return []vmtranslator.Source{{Name: "Main", File: strings.NewReader(main)}, {Name: "Sys", File: strings.NewReader(sys)}}
+	}
+	b.Run("interpreter", func(b *testing.B) {
+		for b.Loop() {
+			m, err := Load(sources(), Options{Bootstrap: true})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := m.Run(0); err != nil || m.RAM[TempBase] != 2584 {
+				b.Fatalf("fibonacci(18) is %d: %v", m.RAM[TempBase], err)
+			}
+		}
+	})
+	b.Run("emulator", func(b *testing.B) {
+		var asm bytes.Buffer
+		if _, err := vmtranslator.TranslateSources(&asm, sources(), vmtranslator.Options{Bootstrap: true}); err != nil {
+			b.Fatal(err)
+		}
+		result, err := hack.Assemble(&asm, hack.Options{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for b.Loop() {
+			c := emulator.New()
+			if err := c.LoadWords(result.Words); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := c.Run(0); err != nil || c.RAM[TempBase] != 2584 {
+				b.Fatalf("fibonacci(18) is %d: %v", c.RAM[TempBase], err)
+			}
+		}
+	})
+}
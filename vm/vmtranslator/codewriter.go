@@ -14,6 +14,7 @@ type CodeWriter struct {
 	CommandCount int            // for generating unique labels
 	FunctionName string         // for generating unique return labels
 	ReturnCount  map[string]int // for generating unique return labels
+	OptimizeVM   bool           // if true, Tranlate passes the commands of each file through OptimizeCommands before writing them
 }
 
 // NewCodeWriter creates a new asm file with the given path and returns a CodeWriter. CodeWriter.FileNameStem is set to "", so it must be set before calling WriteCommand.
@@ -274,12 +275,14 @@ func resolveLabel(functionName string, labelBase string) string {
 
 // WriteCommand writes the assembly code for the given VM command to the output file. It returns an error if the command is invalid. It also updates the internal state of the CodeWriter, which is used for generating unique labels.
 func (cw *CodeWriter) WriteCommand(gotoCommand VMCommand) error {
+	c, err := parseCommand(gotoCommand)
+	if err != nil {
+		return err
+	}
 	// output the command as a comment
 	io.WriteString(cw, "// "+string(gotoCommand)+"\n")
-	ctype := getCommandType(gotoCommand)
 	var asmcommand string
-	var err error
-	switch ctype {
+	switch c.Type {
 	case C_ARITHMETIC:
 		asmcommand, err = TranslateArithmetic(gotoCommand, cw.CommandCount)
 		cw.CommandCount++
@@ -287,31 +290,31 @@ func (cw *CodeWriter) WriteCommand(gotoCommand VMCommand) error {
 		if cw.VmFileStem == "" {
 			return fmt.Errorf("fileNameStem is not set")
 		}
-		asmcommand, err = TranslatePushPop(ctype, arg1(gotoCommand), arg2(gotoCommand), cw.VmFileStem)
+		asmcommand, err = TranslatePushPop(c.Type, c.Arg1, c.Arg2, cw.VmFileStem)
 	case C_LABEL:
-		label := resolveLabel(cw.FunctionName, arg1(gotoCommand))
+		label := resolveLabel(cw.FunctionName, c.Arg1)
 		asmcommand, err = TranslateLabel(label)
 	case C_GOTO:
-		label := resolveLabel(cw.FunctionName, arg1(gotoCommand))
+		label := resolveLabel(cw.FunctionName, c.Arg1)
 		asmcommand, err = TranslateGoto(label)
 	case C_IF:
-		label := resolveLabel(cw.FunctionName, arg1(gotoCommand))
+		label := resolveLabel(cw.FunctionName, c.Arg1)
 		asmcommand, err = TranslateIf(label)
 	case C_FUNCTION:
-		asmcommand, err = TranslateFunction(arg1(gotoCommand), arg2(gotoCommand))
-		cw.FunctionName = arg1(gotoCommand)
+		asmcommand, err = TranslateFunction(c.Arg1, c.Arg2)
+		cw.FunctionName = c.Arg1
 	case C_CALL:
-		cnt, ok := cw.ReturnCount[arg1(gotoCommand)]
+		cnt, ok := cw.ReturnCount[c.Arg1]
 		if !ok {
 			cnt = 0
-			cw.ReturnCount[arg1(gotoCommand)] = 0
+			cw.ReturnCount[c.Arg1] = 0
 		}
-		asmcommand, err = TranslateCall(arg1(gotoCommand), arg2(gotoCommand), cnt)
-		cw.ReturnCount[arg1(gotoCommand)]++
+		asmcommand, err = TranslateCall(c.Arg1, c.Arg2, cnt)
+		cw.ReturnCount[c.Arg1]++
 	case C_RETURN:
 		asmcommand, err = TranslateReturn()
 	default:
-		return fmt.Errorf("invalid command type %d", ctype)
+		return fmt.Errorf("invalid command type %d", c.Type)
 	}
 	if err != nil {
 		return err
@@ -0,0 +1,447 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"strconv"
+)
+
+/*
+optimizer.go is an optimizer that rewrites VM code into shorter VM code with the same effect. The Jack compiler writes naive code, and each VM command it saves is several Hack instructions. It repeats the following passes on each function until nothing changes.
+
+| pass | before | after |
+|------|--------|-------|
+| constant folding | push constant 2, push constant 3, add | push constant 5 |
+| | push constant 0, add | (removed) |
+| | not, not | (removed) |
+| branch simplification | push constant 0, not, if-goto L | goto L |
+| | lt, not, if-goto L1, goto L2, label L1 | lt, if-goto L2, label L1 |
+| | goto L1 ... label L1, goto L2 | goto L2 ... label L1, goto L2 |
+| | goto L, label L | label L |
+| dead code elimination | goto L, push local 0, label M | goto L, label M |
+| | label L (not used by goto or if-goto) | (removed) |
+| push/pop forwarding | push local 0, pop local 0 | (removed) |
+| | function f 1, push constant 0, pop local 0 | function f 1 |
+| | push constant 7, pop static 0, push static 0 | push constant 7, pop static 0, push constant 7 |
+
+Push/pop forwarding follows the values of the local variables, the static variables and the temp segment that are known constants. The local variables are 0 at the start of a function, and a pop of a constant sets the value. The values are forgotten at a label and at a call, and a pop to this, that, argument or a local variable above the number of local variables forgets all of them because it can write any address.
+
+Comparisons of constants are folded only if x-y does not overflow, because the translated code of gt and lt compares x-y with 0. The first use of each static variable is never removed, because the assembler gives the addresses of the variables in the order of their first uses.
+*/
+
+// Level is an optimization level that can be given as a command line flag. "-O" is level 1, which runs the peephole optimizer on the Hack assembly code. "-O=2" is level 2, which also runs the VM optimizer before the translation. Example: flag.Var(&level, "O", "the optimization level")
+type Level int
+
+// MaxLevel is the highest optimization level.
+const MaxLevel Level = 2
+
+// String returns the level as a number.
+func (l *Level) String() string {
+	return strconv.Itoa(int(*l))
+}
+
+// Set sets the level from the value of the flag. "true" is level 1 and "false" is level 0.
+func (l *Level) Set(s string) error {
+	switch s {
+	case "true":
+		*l = 1
+		return nil
+	case "false":
+		*l = 0
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || Level(n) > MaxLevel {
+		return fmt.Errorf("want an optimization level from 0 to %d", MaxLevel)
+	}
+	*l = Level(n)
+	return nil
+}
+
+// IsBoolFlag returns true, so the flag can be given without a value.
+func (l *Level) IsBoolFlag() bool {
+	return true
+}
+
+// Apply sets the optimizer options of the level. Level 1 sets Optimize, and level 2 sets Optimize and OptimizeVM.
+func (l Level) Apply(opts *Options) {
+	opts.Optimize = l >= 1
+	opts.OptimizeVM = l >= 2
+}
+
+// OptimizeCommands returns the commands of a VM file rewritten by the VM optimizer. The commands must be valid, as returned by [Parse]. A command written by the optimizer has the line of the first command it replaces.
+func OptimizeCommands(commands []Command) []Command {
+	first := findFirstUses(commands)
+	passes := []func([]Command) ([]Command, bool){
+		foldConstants,
+		simplifyBranches,
+		func(commands []Command) ([]Command, bool) { return removeDeadCode(commands, first) },
+		func(commands []Command) ([]Command, bool) { return forwardPushPop(commands, first) },
+	}
+	var optimized []Command
+	for _, function := range splitFunctions(commands) {
+		for changed := true; changed; {
+			changed = false
+			for _, pass := range passes {
+				var c bool
+				function, c = pass(function)
+				changed = changed || c
+			}
+		}
+		optimized = append(optimized, function...)
+	}
+	return optimized
+}
+
+// firstUses is the set of the lines of the commands that use a static variable for the first time in a file. The optimizer never removes or replaces them, so the static variables get the same addresses as without the optimizer.
+type firstUses map[int]bool
+
+// findFirstUses returns the first uses of the static variables of the commands.
+func findFirstUses(commands []Command) firstUses {
+	first := firstUses{}
+	seen := map[int]bool{}
+	for _, c := range commands {
+		if (c.Type == C_PUSH || c.Type == C_POP) && c.Arg1 == "static" && !seen[c.Arg2] {
+			seen[c.Arg2] = true
+			first[c.Line] = true
+		}
+	}
+	return first
+}
+
+// has returns true if the command is the first use of a static variable.
+func (first firstUses) has(c Command) bool {
+	return (c.Type == C_PUSH || c.Type == C_POP) && c.Arg1 == "static" && first[c.Line]
+}
+
+// newCommand returns a command written by the optimizer. Example: newCommand(C_PUSH, "constant", 7, 12) is "push constant 7" at line 12
+func newCommand(ctype VMCommandType, arg1 string, arg2 int, line int) Command {
+	var text string
+	switch ctype {
+	case C_ARITHMETIC:
+		text = arg1
+	case C_PUSH:
+		text = fmt.Sprintf("push %s %d", arg1, arg2)
+	case C_GOTO:
+		text = "goto " + arg1
+	case C_IF:
+		text = "if-goto " + arg1
+	}
+	return Command{Type: ctype, Arg1: arg1, Arg2: arg2, Text: VMCommand(text), Line: line}
+}
+
+// pushConstant returns the shortest commands that push the value. A negative value is "push constant ^value" followed by "not". Example: -1 is "push constant 0", "not"
+func pushConstant(value int16, line int) []Command {
+	if value >= 0 {
+		return []Command{newCommand(C_PUSH, "constant", int(value), line)}
+	}
+	return []Command{newCommand(C_PUSH, "constant", int(^value), line), newCommand(C_ARITHMETIC, "not", 0, line)}
+}
+
+// isPushConstant returns true if the command is "push constant n".
+func isPushConstant(c Command) bool {
+	return c.Type == C_PUSH && c.Arg1 == "constant"
+}
+
+// fold returns the result of a binary arithmetic or logical command on constants. ok is false for gt and lt if x-y overflows.
+func fold(op string, x, y int16) (result int16, ok bool) {
+	boolean := func(b bool) int16 {
+		if b {
+			return -1
+		}
+		return 0
+	}
+	diff := int(x) - int(y)
+	switch op {
+	case "add":
+		return x + y, true
+	case "sub":
+		return x - y, true
+	case "and":
+		return x & y, true
+	case "or":
+		return x | y, true
+	case "eq":
+		return boolean(x == y), true
+	case "gt", "lt":
+		if diff != int(int16(diff)) {
+			return 0, false
+		}
+		if op == "gt" {
+			return boolean(diff > 0), true
+		}
+		return boolean(diff < 0), true
+	}
+	return 0, false
+}
+
+// constantAt returns the value of the longest constant expression that starts at commands[i] and pushes one value, and the index of the command after it. ok is false if commands[i] does not start a constant expression. Example: "push constant 2", "push constant 3", "add" is 5
+func constantAt(commands []Command, i int) (value int16, end int, ok bool) {
+	var stack []int16
+	for j := i; j < len(commands); j++ {
+		c := commands[j]
+		n := len(stack)
+		switch {
+		case isPushConstant(c):
+			stack = append(stack, int16(c.Arg2))
+		case c.Type == C_ARITHMETIC && (c.Arg1 == "neg" || c.Arg1 == "not"):
+			if n < 1 {
+				return value, end, ok
+			}
+			if c.Arg1 == "neg" {
+				stack[n-1] = -stack[n-1]
+			} else {
+				stack[n-1] = ^stack[n-1]
+			}
+		case c.Type == C_ARITHMETIC:
+			if n < 2 {
+				return value, end, ok
+			}
+			result, folded := fold(c.Arg1, stack[n-2], stack[n-1])
+			if !folded {
+				return value, end, ok
+			}
+			stack = append(stack[:n-2], result)
+		default:
+			return value, end, ok
+		}
+		if len(stack) == 1 {
+			value, end, ok = stack[0], j+1, true
+		}
+	}
+	return value, end, ok
+}
+
+// isIdentity returns true if the two commands do not change the stack: "not", "not", "neg", "neg" and "push constant 0" followed by "add", "sub" or "or".
+func isIdentity(c, next Command) bool {
+	if c.Type != C_ARITHMETIC && !isPushConstant(c) || next.Type != C_ARITHMETIC {
+		return false
+	}
+	switch {
+	case c.Arg1 == "not" || c.Arg1 == "neg":
+		return next.Arg1 == c.Arg1
+	case isPushConstant(c) && c.Arg2 == 0:
+		return next.Arg1 == "add" || next.Arg1 == "sub" || next.Arg1 == "or"
+	}
+	return false
+}
+
+// foldConstants replaces the constant expressions with the shortest commands that push their values, and removes the commands that do not change the stack.
+func foldConstants(commands []Command) ([]Command, bool) {
+	var out []Command
+	changed := false
+	for i := 0; i < len(commands); i++ {
+		if value, end, ok := constantAt(commands, i); ok {
+			if folded := pushConstant(value, commands[i].Line); len(folded) < end-i {
+				out = append(out, folded...)
+				i = end - 1
+				changed = true
+				continue
+			}
+		}
+		if i+1 < len(commands) && isIdentity(commands[i], commands[i+1]) {
+			i++
+			changed = true
+			continue
+		}
+		out = append(out, commands[i])
+	}
+	return out, changed
+}
+
+// labelIndexes returns the index of each label command of a function.
+func labelIndexes(commands []Command) map[string]int {
+	labels := map[string]int{}
+	for i, c := range commands {
+		if c.Type == C_LABEL {
+			labels[c.Arg1] = i
+		}
+	}
+	return labels
+}
+
+// jumpTarget returns the label that a jump to label finally reaches by following the goto commands right after the labels. It returns label if the gotos make a loop of more than one goto.
+func jumpTarget(commands []Command, labels map[string]int, label string) string {
+	visited := map[string]bool{label: true}
+	target := label
+	for {
+		i, ok := labels[target]
+		if !ok {
+			return target
+		}
+		for i < len(commands) && commands[i].Type == C_LABEL {
+			i++
+		}
+		if i == len(commands) || commands[i].Type != C_GOTO {
+			return target
+		}
+		next := commands[i].Arg1
+		if next == target {
+			// a goto to itself, such as the end of a program
+			return target
+		}
+		if visited[next] {
+			return label
+		}
+		visited[next] = true
+		target = next
+	}
+}
+
+// jumpsToNext returns true if the goto at commands[i] jumps to one of the labels right after it.
+func jumpsToNext(commands []Command, i int) bool {
+	for j := i + 1; j < len(commands) && commands[j].Type == C_LABEL; j++ {
+		if commands[j].Arg1 == commands[i].Arg1 {
+			return true
+		}
+	}
+	return false
+}
+
+// isComparison returns true if the command is eq, gt or lt, which push true or false.
+func isComparison(c Command) bool {
+	return c.Type == C_ARITHMETIC && (c.Arg1 == "eq" || c.Arg1 == "gt" || c.Arg1 == "lt")
+}
+
+// simplifyBranches removes the branches on constants and the gotos to the next command, inverts "not", "if-goto L1", "goto L2", "label L1" after a comparison, and makes the jumps to a goto jump to its label.
+func simplifyBranches(commands []Command) ([]Command, bool) {
+	labels := labelIndexes(commands)
+	var out []Command
+	changed := false
+	for i := 0; i < len(commands); i++ {
+		c := commands[i]
+		if value, end, ok := constantAt(commands, i); ok && end < len(commands) && commands[end].Type == C_IF {
+			if value != 0 {
+				out = append(out, newCommand(C_GOTO, commands[end].Arg1, 0, commands[end].Line))
+			}
+			i = end
+			changed = true
+			continue
+		}
+		// not is bitwise, so "not", "if-goto" jumps if the value is not -1. It is the same as jumping if the value is 0 only for true and false
+		if c.Type == C_ARITHMETIC && c.Arg1 == "not" && i > 0 && isComparison(commands[i-1]) && i+3 < len(commands) {
+			ifGoto, gotoCommand, label := commands[i+1], commands[i+2], commands[i+3]
+			if ifGoto.Type == C_IF && gotoCommand.Type == C_GOTO && label.Type == C_LABEL && label.Arg1 == ifGoto.Arg1 {
+				out = append(out, newCommand(C_IF, gotoCommand.Arg1, 0, ifGoto.Line), label)
+				i += 3
+				changed = true
+				continue
+			}
+		}
+		if c.Type == C_GOTO && jumpsToNext(commands, i) {
+			changed = true
+			continue
+		}
+		if c.Type == C_GOTO || c.Type == C_IF {
+			if target := jumpTarget(commands, labels, c.Arg1); target != c.Arg1 {
+				c = newCommand(c.Type, target, 0, c.Line)
+				changed = true
+			}
+		}
+		out = append(out, c)
+	}
+	return out, changed
+}
+
+// removeDeadCode removes the labels that no goto or if-goto uses, and the commands after a goto or a return that no jump reaches except the first uses of the static variables.
+func removeDeadCode(commands []Command, first firstUses) ([]Command, bool) {
+	used := map[string]bool{}
+	for _, c := range commands {
+		if c.Type == C_GOTO || c.Type == C_IF {
+			used[c.Arg1] = true
+		}
+	}
+	var out []Command
+	changed := false
+	// dead is true after a goto or a return until a used label
+	dead := false
+	for _, c := range commands {
+		switch {
+		case c.Type == C_LABEL && !used[c.Arg1]:
+			changed = true
+			continue
+		case c.Type == C_LABEL || c.Type == C_FUNCTION:
+			dead = false
+		case dead && !first.has(c):
+			changed = true
+			continue
+		}
+		out = append(out, c)
+		if c.Type == C_GOTO || c.Type == C_RETURN {
+			dead = true
+		}
+	}
+	return out, changed
+}
+
+// location is a struct that represents a word of a segment. Example: {"local", 2}
+type location struct {
+	segment string
+	index   int
+}
+
+// forwardPushPop removes the pushes and pops that copy a value to where it already is, and replaces the pushes of the variables whose values are known constants with push constant. The first uses of the static variables are kept.
+func forwardPushPop(commands []Command, first firstUses) ([]Command, bool) {
+	nLocals := 0
+	if len(commands) > 0 && commands[0].Type == C_FUNCTION {
+		nLocals = commands[0].Arg2
+	}
+	// tracked returns true if the values of the word are followed. The words above the local variables are a part of the stack
+	tracked := func(l location) bool {
+		return l.segment == "local" && l.index < nLocals || l.segment == "static" || l.segment == "temp"
+	}
+	known := map[location]int16{}
+	var out []Command
+	changed := false
+	for i := 0; i < len(commands); i++ {
+		c := commands[i]
+		var next Command
+		if i+1 < len(commands) {
+			next = commands[i+1]
+		}
+		switch c.Type {
+		case C_FUNCTION:
+			clear(known)
+			for j := range nLocals {
+				known[location{"local", j}] = 0
+			}
+		case C_LABEL, C_CALL, C_GOTO, C_RETURN:
+			clear(known)
+		case C_PUSH:
+			l := location{c.Arg1, c.Arg2}
+			if first.has(c) {
+				break
+			}
+			// push x, pop x
+			if next.Type == C_POP && next.Arg1 == c.Arg1 && next.Arg2 == c.Arg2 && !first.has(next) {
+				i++
+				changed = true
+				continue
+			}
+			// push constant n, pop x where x is already n
+			if dest := (location{next.Arg1, next.Arg2}); isPushConstant(c) && next.Type == C_POP && tracked(dest) && !first.has(next) {
+				if value, ok := known[dest]; ok && int(value) == c.Arg2 {
+					i++
+					changed = true
+					continue
+				}
+			}
+			if value, ok := known[l]; ok && tracked(l) && value >= 0 {
+				c = newCommand(C_PUSH, "constant", int(value), c.Line)
+				changed = true
+			}
+		case C_POP:
+			l := location{c.Arg1, c.Arg2}
+			switch {
+			case tracked(l):
+				delete(known, l)
+				if len(out) > 0 && isPushConstant(out[len(out)-1]) {
+					known[l] = int16(out[len(out)-1].Arg2)
+				}
+			case l.segment != "pointer":
+				clear(known)
+			}
+		}
+		out = append(out, c)
+	}
+	return out, changed
+}
@@ -0,0 +1,122 @@
+package vmtranslator
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/progress"
+	"github.com/google/go-cmp/cmp"
+)
+
+// optimize parses the VM code, optimizes it and returns the optimized commands, one per line.
+func optimize(t *testing.T, code string) string {
+	t.Helper()
+	commands, err := Parse(strings.NewReader(code), "Main.vm")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	var lines []string
+	for _, c := range OptimizeCommands(commands) {
+		lines = append(lines, string(c.Text))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestOptimizeCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{"fold arithmetic", "push constant 2\npush constant 3\nadd\npush constant 4\nsub\npop temp 0", "push constant 1\npop temp 0"},
+		{"fold to a negative value", "push constant 1\npush constant 3\nsub\npop temp 0", "push constant 1\nnot\npop temp 0"},
+		{"fold comparisons", "push constant 7\npush constant 8\nlt\npush constant 0\neq\npop temp 0", "push constant 0\npop temp 0"},
+		{"keep a comparison that overflows", "push constant 32767\npush constant 1\nneg\ngt\npop temp 0", "push constant 32767\npush constant 1\nneg\ngt\npop temp 0"},
+		{"remove identities", "push local 0\nnot\nnot\npush constant 0\nadd\nneg\nneg\npop temp 0", "push local 0\npop temp 0"},
+		{"branch on true", "label LOOP\npush constant 0\nnot\nif-goto LOOP\npush constant 1", "label LOOP\ngoto LOOP"},
+		{"branch on false", "push constant 0\nif-goto END\npush constant 1\nlabel END", "push constant 1"},
+		{"invert a comparison", "push local 0\npush local 1\nlt\nnot\nif-goto ELSE\ngoto END\nlabel ELSE\npush constant 1\npop temp 0\nlabel END", "push local 0\npush local 1\nlt\nif-goto END\npush constant 1\npop temp 0\nlabel END"},
+		{"keep not on a number", "push local 0\nnot\nif-goto ELSE\ngoto END\nlabel ELSE\npush constant 1\npop temp 0\nlabel END", "push local 0\nnot\nif-goto ELSE\ngoto END\nlabel ELSE\npush constant 1\npop temp 0\nlabel END"},
+		{"jump to a goto", "push local 0\nif-goto A\npush constant 1\npop temp 0\nlabel A\ngoto B\nlabel B\nlabel C\ngoto C", "push local 0\nif-goto C\npush constant 1\npop temp 0\nlabel C\ngoto C"},
+		{"dead code", "label END\npush local 0\npop temp 0\ngoto END\npush local 1\nlabel UNUSED\npush constant 2\nreturn", "label END\npush local 0\npop temp 0\ngoto END"},
+		{"push and pop the same word", "push that 2\npop that 2\npush local 3\npop local 3", ""},
+		{"locals start at 0", "function Main.f 2\npush constant 0\npop local 0\npush constant 5\npop local 1\npush local 1\npush local 0\nadd\nreturn", "function Main.f 2\npush constant 5\npop local 1\npush constant 5\nreturn"},
+		{"forget values at a label", "function Main.f 1\nlabel LOOP\npush local 0\nif-goto LOOP\npush constant 0\nreturn", "function Main.f 1\nlabel LOOP\npush local 0\nif-goto LOOP\npush constant 0\nreturn"},
+		{"forget values at a call", "function Main.f 0\npush constant 1\npop static 0\ncall Main.g 0\npop temp 0\npush static 0\nreturn", "function Main.f 0\npush constant 1\npop static 0\ncall Main.g 0\npop temp 0\npush static 0\nreturn"},
+		{"forget values at a pop to that", "function Main.f 1\npush constant 1\npop temp 0\npop that 0\npush temp 0\npush local 0\nreturn", "function Main.f 1\npush constant 1\npop temp 0\npop that 0\npush temp 0\npush local 0\nreturn"},
+		{"keep the first use of a static variable", "push static 1\npop static 1\ngoto END\npush static 0\nlabel END\npush static 0\npop static 0", "push static 1\npop static 1\ngoto END\npush static 0\nlabel END"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.expected, optimize(t, test.code)); diff != "" {
+				t.Errorf("OptimizeCommands mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestOptimizeCommandsLines(t *testing.T) {
+	commands, err := Parse(strings.NewReader("function Main.f 0\npush constant 2\npush constant 3\nadd\nreturn\n"), "Main.vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Command{
+		{Type: C_FUNCTION, Arg1: "Main.f", Arg2: 0, Text: "function Main.f 0", Line: 1},
+		{Type: C_PUSH, Arg1: "constant", Arg2: 5, Text: "push constant 5", Line: 2},
+		{Type: C_RETURN, Text: "return", Line: 5},
+	}
+	if diff := cmp.Diff(expected, OptimizeCommands(commands)); diff != "" {
+		t.Errorf("OptimizeCommands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected Options
+	}{
+		{nil, Options{}},
+		{[]string{"-O"}, Options{Optimize: true}},
+		{[]string{"-O=2"}, Options{Optimize: true, OptimizeVM: true}},
+		{[]string{"-O=false"}, Options{}},
+	}
+	for _, test := range tests {
+		var level Level
+		fs := flag.NewFlagSet("vm", flag.ContinueOnError)
+		fs.Var(&level, "O", "")
+		if err := fs.Parse(test.args); err != nil {
+			t.Fatalf("Parse(%v) failed: %v", test.args, err)
+		}
+		var opts Options
+		level.Apply(&opts)
+		if opts != test.expected {
+			t.Errorf("%v gives %+v, want %+v", test.args, opts, test.expected)
+		}
+	}
+	var level Level
+	if err := level.Set("3"); err == nil {
+		t.Errorf("Set(3) returned no error")
+	}
+}
+
+func TestTranslateSourcesOptimizeVM(t *testing.T) {
+	code := "function Main.main 1\npush constant 0\npop local 0\npush constant 2\npush constant 3\nadd\nreturn\n"
+	var reports []progress.Event
+	opts := Options{OptimizeVM: true, Progress: progress.Func(func(e progress.Event) {
+		if e.Kind == progress.Report {
+			reports = append(reports, e)
+		}
+	})}
+	var asm bytes.Buffer
+	if _, err := TranslateSources(&asm, []Source{{Name: "Main", File: strings.NewReader(code)}}, opts); err != nil {
+		t.Fatalf("TranslateSources failed: %v", err)
+	}
+	if len(reports) != 1 || reports[0].Count != 3 || reports[0].Message != "optimized 7 -> 3 VM commands (saved 4)" {
+		t.Errorf("TranslateSources reported %+v, want one report of 7 -> 3 VM commands", reports)
+	}
+	if !strings.Contains(asm.String(), "// push constant 5\n") || strings.Contains(asm.String(), "// add\n") {
+		t.Errorf("TranslateSources did not write the optimized commands:\n%s", asm.String())
+	}
+}
@@ -2,6 +2,7 @@ package vmtranslator
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
@@ -46,6 +47,7 @@ type CodeScanner struct {
 	MultiLineCommentInternalPrefix string
 	MultiLineCommentEnd            string
 	isInComment                    bool
+	line                           int // the line number of the current line, starting at 1
 }
 
 // New creates a new CodeScanner with the given reader and comment prefix
@@ -58,6 +60,8 @@ type Parser struct {
 	scanner        CodeScanner
 	currentCommand VMCommand
 	currentType    VMCommandType
+	File           string // the name of the VM file used in errors. Example: "Main.vm"
+	err            error
 }
 
 // NewParser creates a new Parser with the given reader and comment prefix. It uses a [CodeScanner] to read the file. commentPrefix is the prefix that indicates a comment. Example: "//"
@@ -66,6 +70,73 @@ func NewParser(r io.Reader, commentPrefix string) Parser {
 	return Parser{scanner: cs}
 }
 
+// ParseError is an error of a VM command. File and Line are the position of the command, Text is the command and Msg describes the problem. Example: {"Main.vm", 3, "push temp 8", "temp index 8 is out of range 0..7"}
+type ParseError struct {
+	File string
+	Line int
+	Text string
+	Msg  string
+}
+
+// Error returns the error in the form "file:line: message (command)". Example: "Main.vm:3: temp index 8 is out of range 0..7 (push temp 8)"
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s (%s)", e.File, e.Line, e.Msg, e.Text)
+}
+
+// ParseErrors is a list of the errors of a VM file in the order of the lines. errors.As finds each *ParseError in it.
+type ParseErrors []*ParseError
+
+// Error returns the errors, one per line.
+func (errs ParseErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, e := range errs {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the errors for errors.Is and errors.As.
+func (errs ParseErrors) Unwrap() []error {
+	list := make([]error, len(errs))
+	for i, e := range errs {
+		list[i] = e
+	}
+	return list
+}
+
+// Command is a struct that represents a valid VM command and its line. Arg1 and Arg2 are the arguments as returned by arg1 and arg2, and are empty if the command does not have them. Example: {C_PUSH, "local", 2, "push local 2", 7}
+type Command struct {
+	Type VMCommandType
+	Arg1 string
+	Arg2 int
+	Text VMCommand
+	Line int
+}
+
+// Parse reads all the commands of a VM file. file is the name used in errors. It checks every command, and if some are invalid, it returns [ParseErrors] that lists all of them.
+func Parse(r io.Reader, file string) ([]Command, error) {
+	cs := New(r, "//")
+	var commands []Command
+	var errs ParseErrors
+	for cs.Scan() {
+		text := VMCommand(cs.Text())
+		command, err := parseCommand(text)
+		if err != nil {
+			errs = append(errs, &ParseError{File: file, Line: cs.Line(), Text: string(text), Msg: err.Error()})
+			continue
+		}
+		command.Line = cs.Line()
+		commands = append(commands, command)
+	}
+	if err := cs.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return commands, nil
+}
+
 // isEmptyLine returns true if the line is empty
 func (cs CodeScanner) isEmptyLine(line string) bool {
 	return len(line) == 0
@@ -105,11 +176,12 @@ func (cs CodeScanner) Text() string {
 }
 
 // Scan reads the next line from the scanner and skips empty lines and comments. It returns false if there are no more lines.
-func (cs CodeScanner) Scan() bool {
+func (cs *CodeScanner) Scan() bool {
 	ok := cs.scanner.Scan()
 	if !ok {
 		return false
 	}
+	cs.line++
 	line := cs.Text()
 	// skip empty or comment line
 	if cs.isEmptyLine(line) || cs.isCommentLine(line) {
@@ -118,75 +190,174 @@ func (cs CodeScanner) Scan() bool {
 	return true
 }
 
-// getCommandType returns the type of the given command.
-func getCommandType(command VMCommand) VMCommandType {
+// Line returns the line number of the current line, starting at 1.
+func (cs CodeScanner) Line() int {
+	return cs.line
+}
+
+// Err returns the first error of the underlying reader.
+func (cs CodeScanner) Err() error {
+	return cs.scanner.Err()
+}
+
+// getCommandType returns the type of the given command. It returns an error if the command is empty or unknown.
+func getCommandType(command VMCommand) (VMCommandType, error) {
 	// split the command into words
 	words := strings.Fields(string(command))
+	if len(words) == 0 {
+		return 0, fmt.Errorf("empty command")
+	}
 	switch words[0] {
 	case "add", "sub", "neg", "eq", "gt", "lt", "and", "or", "not":
-		return C_ARITHMETIC
+		return C_ARITHMETIC, nil
 	case "push":
-		return C_PUSH
+		return C_PUSH, nil
 	case "pop":
-		return C_POP
+		return C_POP, nil
 	case "label":
-		return C_LABEL
+		return C_LABEL, nil
 	case "goto":
-		return C_GOTO
+		return C_GOTO, nil
 	case "if-goto":
-		return C_IF
+		return C_IF, nil
 	case "function":
-		return C_FUNCTION
+		return C_FUNCTION, nil
 	case "return":
-		return C_RETURN
+		return C_RETURN, nil
 	case "call":
-		return C_CALL
-	default:
-		panic("unknown command")
+		return C_CALL, nil
 	}
+	return 0, fmt.Errorf("unknown command %q", words[0])
 }
 
-// advance reads the next instruction from the input and makes it the current instruction. It returns false if there are no more instructions. advance ignores empty lines and comments.
+// advance reads the next instruction from the input and makes it the current instruction. It returns false if there are no more instructions or the instruction is invalid. Err returns the error of an invalid instruction. advance ignores empty lines and comments.
 func (p *Parser) advance() bool {
+	if p.err != nil {
+		return false
+	}
 	ok := p.scanner.Scan()
 	if !ok {
+		p.err = p.scanner.Err()
 		return false
 	}
 	line := p.scanner.Text()
 	command := VMCommand(line)
+	c, err := parseCommand(command)
+	if err != nil {
+		p.err = &ParseError{File: p.File, Line: p.scanner.Line(), Text: line, Msg: err.Error()}
+		return false
+	}
 	p.currentCommand = command
-	p.currentType = getCommandType(command)
+	p.currentType = c.Type
 	return true
 }
 
-// arg1 returns the first argument of the current instruction. It returns the command itself if it is an arithmetic command. It panics if the command is a return command.
-func arg1(command VMCommand) string {
-	words := strings.Fields(string(command))
-	switch ctype := getCommandType(command); ctype {
+// Err returns the error that stopped advance: a [*ParseError] for an invalid instruction or an error of the reader. It returns nil at the end of the input.
+func (p *Parser) Err() error {
+	return p.err
+}
 
-	case C_RETURN:
-		panic("return command has no arguments")
-	case C_ARITHMETIC:
-		return words[0]
-	case C_PUSH, C_POP, C_LABEL, C_GOTO, C_IF, C_FUNCTION, C_CALL:
-		return words[1]
-	default:
-		panic("command has no first argument")
+// arg1 returns the first argument of the current instruction. It returns the command itself if it is an arithmetic command. It returns an error if the command is a return command or has no first argument.
+func arg1(command VMCommand) (string, error) {
+	words := strings.Fields(string(command))
+	ctype, err := getCommandType(command)
+	if err != nil {
+		return "", err
 	}
-
+	switch {
+	case ctype == C_RETURN:
+		return "", fmt.Errorf("return command has no arguments")
+	case ctype == C_ARITHMETIC:
+		return words[0], nil
+	case len(words) < 2:
+		return "", fmt.Errorf("%s command has no first argument", words[0])
+	}
+	return words[1], nil
 }
 
-// arg2 returns the second argument of the current instruction. This is valid only for push, pop, function, and call commands.
-func arg2(command VMCommand) int {
+// arg2 returns the second argument of the current instruction. This is valid only for push, pop, function, and call commands. It returns an error if the argument is missing or is not a number in 0..32767.
+func arg2(command VMCommand) (int, error) {
 	words := strings.Fields(string(command))
-	switch ctype := getCommandType(command); ctype {
+	ctype, err := getCommandType(command)
+	if err != nil {
+		return 0, err
+	}
+	switch ctype {
 	case C_PUSH, C_POP, C_FUNCTION, C_CALL:
+		if len(words) < 3 {
+			return 0, fmt.Errorf("%s command has no second argument", words[0])
+		}
 		n, err := strconv.Atoi(words[2])
-		if err != nil {
-			panic(err)
+		if err != nil || n < 0 || n > maxIndex {
+			return 0, fmt.Errorf("invalid number %q, want 0..%d", words[2], maxIndex)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("%s command has no second argument", words[0])
+}
+
+// maxIndex is the largest index, constant, nVars and nArgs. It is the largest constant of an A instruction.
+const maxIndex = 32767
+
+// segmentSizes is the number of words of the segments of a fixed size. The other segments can have any index up to maxIndex.
+var segmentSizes = map[string]int{"temp": 8, "pointer": 2}
+
+// parseCommand parses and checks a command: the number of arguments, the segment and its index, and the names of labels and functions.
+func parseCommand(command VMCommand) (Command, error) {
+	ctype, err := getCommandType(command)
+	if err != nil {
+		return Command{}, err
+	}
+	words := strings.Fields(string(command))
+	nArgs := map[VMCommandType]int{C_ARITHMETIC: 0, C_RETURN: 0, C_LABEL: 1, C_GOTO: 1, C_IF: 1, C_PUSH: 2, C_POP: 2, C_FUNCTION: 2, C_CALL: 2}[ctype]
+	if len(words)-1 != nArgs {
+		return Command{}, fmt.Errorf("%s takes %d arguments, got %d", words[0], nArgs, len(words)-1)
+	}
+	c := Command{Type: ctype, Text: command}
+	if ctype == C_RETURN {
+		return c, nil
+	}
+	if c.Arg1, err = arg1(command); err != nil {
+		return Command{}, err
+	}
+	switch ctype {
+	case C_PUSH, C_POP, C_FUNCTION, C_CALL:
+		if c.Arg2, err = arg2(command); err != nil {
+			return Command{}, err
+		}
+	}
+
+	switch ctype {
+	case C_PUSH, C_POP:
+		switch c.Arg1 {
+		case "constant":
+			if ctype == C_POP {
+				return Command{}, fmt.Errorf("cannot pop to constant segment")
+			}
+		case "local", "argument", "this", "that", "static", "temp", "pointer":
+		default:
+			return Command{}, fmt.Errorf("invalid segment %s", c.Arg1)
+		}
+		if size, ok := segmentSizes[c.Arg1]; ok && c.Arg2 >= size {
+			return Command{}, fmt.Errorf("%s index %d is out of range 0..%d", c.Arg1, c.Arg2, size-1)
+		}
+	case C_LABEL, C_GOTO, C_IF, C_FUNCTION, C_CALL:
+		if !isSymbol(c.Arg1) {
+			return Command{}, fmt.Errorf("invalid name %q", c.Arg1)
+		}
+	}
+	return c, nil
+}
+
+// isSymbol returns true if s is a valid label or function name: a sequence of letters, digits, "_", ".", ":" and "$" that does not begin with a digit.
+func isSymbol(s string) bool {
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == '.', r == ':', r == '$':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
 		}
-		return n
-	default:
-		panic("command has no second argument")
 	}
+	return s != ""
 }
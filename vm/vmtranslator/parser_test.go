@@ -1,8 +1,12 @@
 package vmtranslator
 
 import (
+	"errors"
 	"strings"
 	"testing"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/progress"
+	"github.com/google/go-cmp/cmp"
 )
 
 var source string = `
@@ -52,7 +56,7 @@ func TestCodeScanner(t *testing.T) {
 
 func TestParser(t *testing.T) {
 	cs := New(strings.NewReader(source), "//")
-	p := Parser{cs, "", C_PUSH}
+	p := Parser{scanner: cs, currentType: C_PUSH}
 	if !p.advance() {
 		t.Errorf("advance() returned false")
 	}
@@ -86,6 +90,19 @@ func TestParser(t *testing.T) {
 	if p.advance() {
 		t.Errorf("advance() returned true")
 	}
+	if p.Err() != nil {
+		t.Errorf("Err() returned %v at the end of the input", p.Err())
+	}
+
+	// an invalid command stops the parser with a ParseError
+	p = NewParser(strings.NewReader("push constant 1\npush temp 8\nadd\n"), "//")
+	p.File = "Main.vm"
+	for p.advance() {
+	}
+	var parseErr *ParseError
+	if !errors.As(p.Err(), &parseErr) || parseErr.Line != 2 || parseErr.Text != "push temp 8" {
+		t.Errorf("Err() = %v, want the ParseError of line 2", p.Err())
+	}
 }
 
 func TestGetCommandType(t *testing.T) {
@@ -112,8 +129,8 @@ func TestGetCommandType(t *testing.T) {
 		{"call", C_CALL},
 	}
 	for _, test := range tests {
-		if got := getCommandType(test.command); got != test.want {
-			t.Errorf("getCommandType(%s) = %d, want %d", test.command, got, test.want)
+		if got, err := getCommandType(test.command); err != nil || got != test.want {
+			t.Errorf("getCommandType(%s) = %d, %v, want %d", test.command, got, err, test.want)
 		}
 	}
 }
@@ -141,8 +158,8 @@ func TestArg1(t *testing.T) {
 		{"call SimpleFunction.test 2", "SimpleFunction.test"},
 	}
 	for _, test := range tests {
-		if got := arg1(test.command); got != test.want {
-			t.Errorf("arg1(%s) = %s, want %s", test.command, got, test.want)
+		if got, err := arg1(test.command); err != nil || got != test.want {
+			t.Errorf("arg1(%s) = %s, %v, want %s", test.command, got, err, test.want)
 		}
 	}
 }
@@ -158,8 +175,83 @@ func TestArg2(t *testing.T) {
 		{"call SimpleFunction.test 2", 2},
 	}
 	for _, test := range tests {
-		if got := arg2(test.command); got != test.want {
-			t.Errorf("arg2(%s) = %d, want %d", test.command, got, test.want)
+		if got, err := arg2(test.command); err != nil || got != test.want {
+			t.Errorf("arg2(%s) = %d, %v, want %d", test.command, got, err, test.want)
 		}
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+	code := `push constant 7
+mul
+push temp 8
+pop pointer 2
+pop constant 1
+push local
+push heap 0
+push local x
+push constant 32768
+label 1LOOP
+return 0
+goto
+add
+`
+	expected := ParseErrors{
+		{"Main.vm", 2, "mul", `unknown command "mul"`},
+		{"Main.vm", 3, "push temp 8", "temp index 8 is out of range 0..7"},
+		{"Main.vm", 4, "pop pointer 2", "pointer index 2 is out of range 0..1"},
+		{"Main.vm", 5, "pop constant 1", "cannot pop to constant segment"},
+		{"Main.vm", 6, "push local", "push takes 2 arguments, got 1"},
+		{"Main.vm", 7, "push heap 0", "invalid segment heap"},
+		{"Main.vm", 8, "push local x", `invalid number "x", want 0..32767`},
+		{"Main.vm", 9, "push constant 32768", `invalid number "32768", want 0..32767`},
+		{"Main.vm", 10, "label 1LOOP", `invalid name "1LOOP"`},
+		{"Main.vm", 11, "return 0", "return takes 0 arguments, got 1"},
+		{"Main.vm", 12, "goto", "goto takes 1 arguments, got 0"},
+	}
+	_, err := Parse(strings.NewReader(code), "Main.vm")
+	var errs ParseErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Parse returned %v, want ParseErrors", err)
+	}
+	if diff := cmp.Diff(expected, errs); diff != "" {
+		t.Errorf("Parse errors mismatch (-want +got):\n%s", diff)
+	}
+	var first *ParseError
+	if !errors.As(err, &first) || first.Line != 2 {
+		t.Errorf("errors.As found %v, want the error of line 2", first)
+	}
+	if want := `Main.vm:2: unknown command "mul" (mul)`; first.Error() != want {
+		t.Errorf("Error() = %s, want %s", first.Error(), want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	commands, err := Parse(strings.NewReader(source+"function Main.main 2\nreturn\n"), "Main.vm")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	expected := []Command{
+		{C_PUSH, "constant", 7, "push constant 7", 4},
+		{C_PUSH, "constant", 8, "push constant 8", 8},
+		{C_ARITHMETIC, "add", 0, "add", 10},
+		{C_FUNCTION, "Main.main", 2, "function Main.main 2", 18},
+		{C_RETURN, "", 0, "return", 19},
+	}
+	if diff := cmp.Diff(expected, commands); diff != "" {
+		t.Errorf("Parse mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestTranslateInvalidCommand tests that the translator returns the error of an invalid command instead of panicking.
+func TestTranslateInvalidCommand(t *testing.T) {
+	var asm strings.Builder
+	_, err := TranslateSources(&asm, []Source{{Name: "Main", File: strings.NewReader("push constant 1\npush temp 8\n")}}, Options{})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.File != "Main.vm" || parseErr.Line != 2 || parseErr.Text != "push temp 8" {
+		t.Errorf("TranslateSources returned %v, want the ParseError of Main.vm:2", err)
+	}
+	if err := VMTranslatorWithOptions("NoSuchFile.vm", Options{Progress: progress.Discard}); err == nil {
+		t.Errorf("VMTranslator of a missing file returned no error")
+	}
+}
@@ -0,0 +1,208 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+/*
+verify.go computes the depth of the working stack at every command of each function without running the program, and reports the code that would corrupt the stack. The depth is the number of values above the local variables, so it is 0 after "function f n". It follows goto and if-goto to their labels and reports:
+
+| problem | example |
+|---------|---------|
+| a return with an empty stack, which returns a local variable or the saved frame | function f 0, return |
+| a label reached with different depths, such as a loop that pushes one more value each time | label L, push constant 1, goto L |
+| a command that pops below the frame: pop, arithmetic, if-goto and call with fewer values than they take | push constant 1, add |
+| a goto or if-goto to a label that is not defined in the function | goto END |
+
+Commands that no path reaches, such as the commands after a return until the next label, are not checked.
+*/
+
+// StackError is a problem found by VerifyStack. File and Line are the position of the command, Text is the command, Function is the function it belongs to and Msg describes the problem. Example: {"Main.vm", 5, "add", "Main.f", "add pops below the frame: it takes 2 values, but the stack has 1"}
+type StackError struct {
+	File     string
+	Line     int
+	Text     string
+	Function string
+	Msg      string
+}
+
+// Error returns the error in the form "file:line: function: message (command)". The function is omitted for the commands before the first function. Example: "Main.vm:5: Main.f: add pops below the frame: it takes 2 values, but the stack has 1 (add)"
+func (e *StackError) Error() string {
+	if e.Function == "" {
+		return fmt.Sprintf("%s:%d: %s (%s)", e.File, e.Line, e.Msg, e.Text)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s (%s)", e.File, e.Line, e.Function, e.Msg, e.Text)
+}
+
+// StackErrors is a list of the problems of a VM file in the order of the lines. errors.As finds each *StackError in it.
+type StackErrors []*StackError
+
+// Error returns the errors, one per line.
+func (errs StackErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, e := range errs {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the errors for errors.Is and errors.As.
+func (errs StackErrors) Unwrap() []error {
+	list := make([]error, len(errs))
+	for i, e := range errs {
+		list[i] = e
+	}
+	return list
+}
+
+// FunctionStack is a struct that represents the stack depths of a function computed by VerifyStack. Commands are the commands of the function starting at its function command, and Depths[i] is the depth before Commands[i], or -1 if no path reaches it. Name is "" for the commands before the first function command.
+type FunctionStack struct {
+	Name     string
+	Commands []Command
+	Depths   []int
+	MaxDepth int // the largest depth of the function
+}
+
+// VerifyStack computes the stack depths of each function of the commands returned by [Parse]. file is the name of the VM file used in errors. If the stack can be corrupted, it returns [StackErrors] that lists all the problems along with the depths.
+func VerifyStack(commands []Command, file string) ([]FunctionStack, error) {
+	var functions []FunctionStack
+	var errs StackErrors
+	for _, function := range splitFunctions(commands) {
+		fs, fsErrs := verifyFunction(function, file)
+		functions = append(functions, fs)
+		errs = append(errs, fsErrs...)
+	}
+	if len(errs) > 0 {
+		slices.SortStableFunc(errs, func(a, b *StackError) int { return a.Line - b.Line })
+		return functions, errs
+	}
+	return functions, nil
+}
+
+// VerifyStackFile parses a VM file and verifies its stack depths. Invalid commands are returned as [ParseErrors].
+func VerifyStackFile(vmFile io.Reader, file string) ([]FunctionStack, error) {
+	commands, err := Parse(vmFile, file)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyStack(commands, file)
+}
+
+// splitFunctions splits the commands at the function commands. Each part but the commands before the first function starts with its function command.
+func splitFunctions(commands []Command) [][]Command {
+	var functions [][]Command
+	start := 0
+	for i := 1; i <= len(commands); i++ {
+		if i < len(commands) && commands[i].Type != C_FUNCTION {
+			continue
+		}
+		if i > start {
+			functions = append(functions, commands[start:i])
+		}
+		start = i
+	}
+	return functions
+}
+
+// stackEffect returns how many values the command pops and pushes.
+func stackEffect(c Command) (pops, pushes int) {
+	switch c.Type {
+	case C_PUSH:
+		return 0, 1
+	case C_POP, C_IF:
+		return 1, 0
+	case C_ARITHMETIC:
+		if c.Arg1 == "neg" || c.Arg1 == "not" {
+			return 1, 1
+		}
+		return 2, 1
+	case C_CALL:
+		return c.Arg2, 1
+	case C_RETURN:
+		return 1, 0
+	}
+	return 0, 0
+}
+
+// verifyFunction computes the depths of the commands of one function by following every path from its first command.
+func verifyFunction(commands []Command, file string) (FunctionStack, StackErrors) {
+	fs := FunctionStack{Commands: commands, Depths: make([]int, len(commands))}
+	if commands[0].Type == C_FUNCTION {
+		fs.Name = commands[0].Arg1
+	}
+	for i := range fs.Depths {
+		fs.Depths[i] = -1
+	}
+	labels := map[string]int{}
+	for i, c := range commands {
+		if c.Type == C_LABEL {
+			labels[c.Arg1] = i
+		}
+	}
+
+	var errs StackErrors
+	report := func(i int, format string, args ...any) {
+		c := commands[i]
+		errs = append(errs, &StackError{File: file, Line: c.Line, Text: string(c.Text), Function: fs.Name, Msg: fmt.Sprintf(format, args...)})
+	}
+	// mismatched is the set of labels already reported as reached with different depths
+	mismatched := map[int]bool{}
+	// work is the list of the commands whose depth is known and whose successors are not visited yet
+	work := []int{0}
+	fs.Depths[0] = 0
+	// reach sets the depth of the command at target, and reports a join with a different depth
+	reach := func(target, depth int) {
+		switch {
+		case target >= len(commands):
+		case fs.Depths[target] == -1:
+			fs.Depths[target] = depth
+			work = append(work, target)
+		case fs.Depths[target] != depth && !mismatched[target]:
+			mismatched[target] = true
+			report(target, "label %s is reached with stack depth %d and %d", commands[target].Arg1, fs.Depths[target], depth)
+		}
+	}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		c, depth := commands[i], fs.Depths[i]
+		fs.MaxDepth = max(fs.MaxDepth, depth)
+
+		pops, pushes := stackEffect(c)
+		if c.Type == C_RETURN && depth == 0 {
+			report(i, "return with an empty stack")
+			continue
+		}
+		if depth < pops {
+			values := "values"
+			if pops == 1 {
+				values = "value"
+			}
+			report(i, "%s pops below the frame: it takes %d %s, but the stack has %d", strings.Fields(string(c.Text))[0], pops, values, depth)
+			// the code after it is checked as if the stack were empty
+			depth = pops
+		}
+		next := depth - pops + pushes
+		fs.MaxDepth = max(fs.MaxDepth, next)
+
+		switch c.Type {
+		case C_RETURN:
+			continue
+		case C_GOTO, C_IF:
+			target, ok := labels[c.Arg1]
+			if !ok {
+				report(i, "undefined label %s", c.Arg1)
+			} else {
+				reach(target, next)
+			}
+			if c.Type == C_GOTO {
+				continue
+			}
+		}
+		reach(i+1, next)
+	}
+	return fs, errs
+}
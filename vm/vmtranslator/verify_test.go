@@ -0,0 +1,97 @@
+package vmtranslator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVerifyStackDepths(t *testing.T) {
+	code := `function Main.max 1
+push argument 0
+push argument 1
+gt
+if-goto FIRST
+push argument 1
+return
+label FIRST
+push argument 0
+return
+function Main.main 0
+push constant 3
+push constant 4
+call Main.max 2
+pop temp 0
+push constant 0
+return
+`
+	functions, err := VerifyStackFile(strings.NewReader(code), "Main.vm")
+	if err != nil {
+		t.Fatalf("VerifyStackFile failed: %v", err)
+	}
+	if len(functions) != 2 {
+		t.Fatalf("VerifyStackFile returned %d functions, want 2", len(functions))
+	}
+	expected := []struct {
+		name     string
+		depths   []int
+		maxDepth int
+	}{
+		{"Main.max", []int{0, 0, 1, 2, 1, 0, 1, 0, 0, 1}, 2},
+		{"Main.main", []int{0, 0, 1, 2, 1, 0, 1}, 2},
+	}
+	for i, want := range expected {
+		fs := functions[i]
+		if fs.Name != want.name || fs.MaxDepth != want.maxDepth {
+			t.Errorf("function %d is %s with max depth %d, want %s with %d", i, fs.Name, fs.MaxDepth, want.name, want.maxDepth)
+		}
+		if diff := cmp.Diff(want.depths, fs.Depths); diff != "" {
+			t.Errorf("%s depths mismatch (-want +got):\n%s", want.name, diff)
+		}
+	}
+}
+
+func TestVerifyStackErrors(t *testing.T) {
+	code := `function Main.empty 0
+return
+function Main.loop 0
+label LOOP
+push constant 1
+goto LOOP
+function Main.underflow 1
+push constant 1
+add
+pop local 0
+pop local 0
+push constant 0
+return
+function Main.jump 0
+push constant 0
+if-goto END
+push constant 0
+return
+goto DONE
+label DEAD
+add
+`
+	expected := StackErrors{
+		{"Main.vm", 2, "return", "Main.empty", "return with an empty stack"},
+		{"Main.vm", 4, "label LOOP", "Main.loop", "label LOOP is reached with stack depth 0 and 1"},
+		{"Main.vm", 9, "add", "Main.underflow", "add pops below the frame: it takes 2 values, but the stack has 1"},
+		{"Main.vm", 11, "pop local 0", "Main.underflow", "pop pops below the frame: it takes 1 value, but the stack has 0"},
+		{"Main.vm", 16, "if-goto END", "Main.jump", "undefined label END"},
+	}
+	_, err := VerifyStackFile(strings.NewReader(code), "Main.vm")
+	var errs StackErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("VerifyStackFile returned %v, want StackErrors", err)
+	}
+	if diff := cmp.Diff(expected, errs); diff != "" {
+		t.Errorf("VerifyStackFile errors mismatch (-want +got):\n%s", diff)
+	}
+	if want := "Main.vm:2: Main.empty: return with an empty stack (return)"; errs[0].Error() != want {
+		t.Errorf("Error() = %s, want %s", errs[0].Error(), want)
+	}
+}
@@ -2,20 +2,47 @@
 package vmtranslator
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"slices"
+	"time"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/assembler/hack"
+	"github.com/Kaichi-Irie/nand2tetris-go/progress"
 )
 
+// Options is a struct that controls how VMTranslator translates VM code.
+type Options struct {
+	Optimize   bool // if true, the Hack assembly code is passed through the peephole optimizer of the hack package. Comments are removed
+	OptimizeVM bool // if true, the VM commands of each file are passed through OptimizeCommands before they are translated. The numbers of VM commands before and after are reported to Progress
+	Bootstrap  bool // if true, the bootstrap code that calls Sys.init is written first. Otherwise an infinite loop is written at the end. VMTranslatorWithOptions sets it for a directory
+
+	Progress progress.Reporter // receives the progress events. The default prints the messages of VMTranslatorWithOptions to stdout and nothing for TranslateSources. progress.Discard prints nothing
+}
+
+// Source is a struct that represents a VM file to translate. Name is the base name of the file without the .vm extension and qualifies its static variables. Path is the file name in the progress events. The default is Name + ".vm". Example: {"Main", vmFile, "Pong/Main.vm"}
+type Source struct {
+	Name string
+	File io.Reader
+	Path string
+}
+
 // VMTranslator translates VM code to Hack assembly code. The input can be a .vm file or a directory containing .vm files. The output is a .asm file with the same name as the input file or directory.
 func VMTranslator(path string) error {
+	return VMTranslatorWithOptions(path, Options{})
+}
+
+// VMTranslatorWithOptions translates VM code to Hack assembly code with the given options. The translated files and "done" are reported to opts.Progress. If opts.Optimize or opts.OptimizeVM is true, it also reports how many instructions the optimizers saved.
+func VMTranslatorWithOptions(path string, opts Options) error {
+	r := progress.OrStdout(opts.Progress)
 	// path can be a .vm file or a directory containing .vm files
-	fmt.Println("VMTranslator")
+	r.Report(progress.Event{Kind: progress.Started, Tool: progress.ToolVMTranslator, Message: "VMTranslator"})
 	info, err := os.Stat(path)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	var asmFilePath string
@@ -26,7 +53,7 @@ func VMTranslator(path string) error {
 		asmFilePath = filepath.Join(path, dirName+".asm")
 		vmFilePaths, err = filepath.Glob(filepath.Join(path, "*.vm"))
 		if err != nil {
-			panic(err)
+			return err
 		}
 		// Sys.vm must be included in the list of .vm files
 		if exists := slices.Contains(vmFilePaths, filepath.Join(path, "Sys.vm")); !exists {
@@ -39,52 +66,116 @@ func VMTranslator(path string) error {
 		return fmt.Errorf("input file must be a .vm file or a directory")
 	}
 
-	codeWriter, err := NewCodeWriterFromFile(asmFilePath)
+	var sources []Source
+	for _, vmFilePath := range vmFilePaths {
+		vmFile, err := os.Open(vmFilePath)
+		if err != nil {
+			return err
+		}
+		defer vmFile.Close()
+		// the base name of the .vm file without the .vm extension. e.g. "SimpleAdd"
+		vmFileBase := filepath.Base(vmFilePath)
+		sources = append(sources, Source{Name: vmFileBase[:len(vmFileBase)-3], File: vmFile, Path: vmFilePath})
+	}
+
+	asmFile, err := os.Create(asmFilePath)
 	if err != nil {
 		return err
 	}
+	defer asmFile.Close()
 
-	if info.IsDir() {
-		// If the input is a directory, write the bootstrap code at the beginning of the .asm file. The bootstrap code initializes the stack pointer to 256 and calls Sys.init.
-		err := codeWriter.WriteBootStrap()
-		if err != nil {
-			panic(err)
+	// If the input is a directory, write the bootstrap code at the beginning of the .asm file. If the input is a file, write an infinite loop at the end
+	opts.Bootstrap = info.IsDir()
+	// the events of each file get the output file and the message of the command line
+	opts.Progress = progress.Func(func(e progress.Event) {
+		if e.Kind == progress.FileFinished {
+			e.Output = asmFilePath
+			e.Message = fmt.Sprintf("Translated %s to %s", e.File, asmFilePath)
 		}
+		r.Report(e)
+	})
+	start := time.Now()
+	report, err := TranslateSources(asmFile, sources, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Optimize {
+		r.Report(progress.Event{Kind: progress.Report, Tool: progress.ToolVMTranslator, Message: fmt.Sprint(report)})
 	}
 
-	for _, vmFilePath := range vmFilePaths {
-		vmFile, err := os.Open(vmFilePath)
-		if err != nil {
-			return err
-		}
-		defer vmFile.Close()
+	r.Report(progress.Event{Kind: progress.Finished, Tool: progress.ToolVMTranslator, Elapsed: time.Since(start), Message: "done"})
+	return nil
+}
 
-		// vmFileBase is the base name of the .vm file with the .vm extension. e.g. "SimpleAdd.vm"
-		vmFileBase := filepath.Base(vmFilePath)
-		codeWriter.VmFileStem = vmFileBase[:len(vmFileBase)-3]
-		err = Tranlate(codeWriter, vmFile)
+// TranslateSources translates the VM files in order and writes the Hack assembly code to asmFile. It prints nothing, and reports FileStarted and FileFinished events of each source to opts.Progress if it is not nil. If opts.OptimizeVM is true, it also reports a Report event with the numbers of VM commands before and after the VM optimizer, and Count is the number after. The returned report is the result of the peephole optimizer if opts.Optimize is true.
+func TranslateSources(asmFile io.Writer, sources []Source, opts Options) (hack.OptimizeReport, error) {
+	r := progress.OrDiscard(opts.Progress)
+	codeWriter := NewCodeWriter(asmFile)
+	codeWriter.OptimizeVM = opts.OptimizeVM
+	var buf bytes.Buffer
+	if opts.Optimize {
+		// write the code to a buffer and optimize it after all files are translated
+		codeWriter.File = &buf
+	}
+
+	if opts.Bootstrap {
+		// The bootstrap code initializes the stack pointer to 256 and calls Sys.init.
+		if err := codeWriter.WriteBootStrap(); err != nil {
+			return hack.OptimizeReport{}, err
+		}
+	}
+	// the numbers of VM commands before and after the VM optimizer
+	before, after := 0, 0
+	for _, source := range sources {
+		path := source.Path
+		if path == "" {
+			path = source.Name + ".vm"
+		}
+		r.Report(progress.Event{Kind: progress.FileStarted, Tool: progress.ToolVMTranslator, File: path})
+		start := time.Now()
+		codeWriter.VmFileStem = source.Name
+		count, optimized, err := translate(codeWriter, source.File, path)
 		if err != nil {
-			return fmt.Errorf("error translating %s: %w", vmFilePath, err)
+			return hack.OptimizeReport{}, err
 		}
-		fmt.Printf("Translated %s to %s\n", vmFilePath, asmFilePath)
+		before, after = before+count, after+optimized
+		r.Report(progress.Event{Kind: progress.FileFinished, Tool: progress.ToolVMTranslator, File: path, Count: count, Elapsed: time.Since(start)})
 	}
-
-	// If the input is a file, write an infinite loop at the end of the .asm file
-	if !info.IsDir() {
-		codeWriter.WriteInfinityLoop()
+	if opts.OptimizeVM {
+		r.Report(progress.Event{Kind: progress.Report, Tool: progress.ToolVMTranslator, Count: after, Message: fmt.Sprintf("optimized %d -> %d VM commands (saved %d)", before, after, before-after)})
+	}
+	if !opts.Bootstrap {
+		if err := codeWriter.WriteInfinityLoop(); err != nil {
+			return hack.OptimizeReport{}, err
+		}
 	}
 
-	fmt.Println("done")
-	return nil
+	if !opts.Optimize {
+		return hack.OptimizeReport{}, nil
+	}
+	return hack.Optimize(&buf, asmFile)
 }
 
+// Tranlate translates the commands of a VM file and writes them with cw. If cw.OptimizeVM is true, the commands are optimized first. Invalid commands are returned as [ParseErrors] in the file cw.VmFileStem + ".vm".
 func Tranlate(cw *CodeWriter, vmFile io.Reader) error {
-	parser := NewParser(vmFile, "//")
-	for parser.advance() {
-		err := cw.WriteCommand(parser.currentCommand)
-		if err != nil {
-			return err
+	_, _, err := translate(cw, vmFile, cw.VmFileStem+".vm")
+	return err
+}
+
+// translate writes the assembly code of the VM file and returns the number of VM commands in the file and the number of translated commands, which is smaller if cw.OptimizeVM is true. file is the name of the VM file used in errors. If the file has invalid commands, it returns [ParseErrors] that lists all of them and writes nothing.
+func translate(cw *CodeWriter, vmFile io.Reader, file string) (count, translated int, err error) {
+	commands, err := Parse(vmFile, file)
+	if err != nil {
+		return 0, 0, err
+	}
+	count = len(commands)
+	if cw.OptimizeVM {
+		commands = OptimizeCommands(commands)
+	}
+	for _, c := range commands {
+		if err := cw.WriteCommand(c.Text); err != nil {
+			return 0, 0, fmt.Errorf("%s:%d: %w", file, c.Line, err)
 		}
 	}
-	return nil
+	return count, len(commands), nil
 }
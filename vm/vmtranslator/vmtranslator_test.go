@@ -6,7 +6,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/Kaichi-Irie/nand2tetris-go/progress"
+	"github.com/google/go-cmp/cmp"
 )
 
 // testSingleFile tests the translation of a single .vm file to .asm file. It reads the .vm file, translates the commands to .asm, and compares the result with the expected .asm file.
@@ -37,10 +41,12 @@ func testSingleFile(vmFilePath string, asmFilePath string) error {
 		ReturnCount: make(map[string]int),
 	}
 
-	parser := NewParser(vmFile, "//")
-	for parser.advance() {
-		err := cw.WriteCommand(parser.currentCommand)
-		if err != nil {
+	commands, err := Parse(vmFile, vmFilePath)
+	if err != nil {
+		return err
+	}
+	for _, c := range commands {
+		if err := cw.WriteCommand(c.Text); err != nil {
 			return err
 		}
 	}
@@ -96,10 +102,12 @@ func testSingleDir(dirName string, asmFilePath string) error {
 		// vmFileBase is the base name of the .vm file with the .vm extension. e.g. "SimpleAdd.vm"
 		vmFileBase := filepath.Base(vmFilePath)
 		cw.VmFileStem = vmFileBase[:len(vmFileBase)-3]
-		parser := NewParser(vmFile, "//")
-		for parser.advance() {
-			err := cw.WriteCommand(parser.currentCommand)
-			if err != nil {
+		commands, err := Parse(vmFile, vmFilePath)
+		if err != nil {
+			return err
+		}
+		for _, c := range commands {
+			if err := cw.WriteCommand(c.Text); err != nil {
 				return err
 			}
 		}
@@ -154,3 +162,67 @@ func TestVMTranslationDirs(t *testing.T) {
 		}
 	}
 }
+
+// TestVMTranslatorOptimize tests that the optimized output is shorter than the output without the optimizer and has no comments.
+func TestVMTranslatorOptimize(t *testing.T) {
+	vmCode, err := os.ReadFile("../vm_files/StackTest.vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	vmFilePath := filepath.Join(dir, "StackTest.vm")
+	if err := os.WriteFile(vmFilePath, vmCode, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	opts := Options{Optimize: true, Progress: progress.Func(func(e progress.Event) {
+		if e.Message != "" {
+			messages = append(messages, e.Message)
+		}
+	})}
+	if err := VMTranslatorWithOptions(vmFilePath, opts); err != nil {
+		t.Fatalf("VMTranslatorWithOptions failed: %v", err)
+	}
+	if len(messages) != 4 || messages[1] != fmt.Sprintf("Translated %s to %s", vmFilePath, filepath.Join(dir, "StackTest.asm")) || messages[3] != "done" {
+		t.Errorf("VMTranslatorWithOptions reported %q, want the title, the translated file, the optimizer report and done", messages)
+	}
+	optimized, err := os.ReadFile(filepath.Join(dir, "StackTest.asm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile("../vm_files/StackTest.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(optimized, []byte("//")) {
+		t.Errorf("optimized code has comments")
+	}
+	if n, m := bytes.Count(optimized, []byte("\n")), bytes.Count(expected, []byte("\n")); n >= m {
+		t.Errorf("optimized code has %d lines, want less than %d", n, m)
+	}
+}
+
+// TestTranslateSourcesProgress tests that TranslateSources reports each source with the number of its VM commands.
+func TestTranslateSourcesProgress(t *testing.T) {
+	var events []progress.Event
+	sources := []Source{
+		{Name: "Main", File: strings.NewReader("push constant 7\npush constant 8\nadd\n"), Path: "Prog/Main.vm"},
+		{Name: "Util", File: strings.NewReader("// no commands\n")},
+	}
+	opts := Options{Progress: progress.Func(func(e progress.Event) {
+		e.Elapsed = 0
+		events = append(events, e)
+	})}
+	if _, err := TranslateSources(io.Discard, sources, opts); err != nil {
+		t.Fatalf("TranslateSources failed: %v", err)
+	}
+	expected := []progress.Event{
+		{Kind: progress.FileStarted, Tool: progress.ToolVMTranslator, File: "Prog/Main.vm"},
+		{Kind: progress.FileFinished, Tool: progress.ToolVMTranslator, File: "Prog/Main.vm", Count: 3},
+		{Kind: progress.FileStarted, Tool: progress.ToolVMTranslator, File: "Util.vm"},
+		{Kind: progress.FileFinished, Tool: progress.ToolVMTranslator, File: "Util.vm"},
+	}
+	if diff := cmp.Diff(expected, events); diff != "" {
+		t.Errorf("TranslateSources events mismatch (-want +got):\n%s", diff)
+	}
+}